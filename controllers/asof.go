@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+// Lo stato passato non cambia più: le risposte con as_of non vengono mai invalidate
+const (
+	asOfCacheDuration = 24 * time.Hour
+	asOfCacheControl  = "public, max-age=31536000, immutable"
+)
+
+// asOfSettled è vero se dopo asOf è già stata salvata una modifica: le modifiche
+// ancora in corso hanno un istante successivo e lo stato ad asOf non cambia più.
+// Prima di allora la risposta non va in cache.
+func asOfSettled(asOf time.Time) bool {
+	return asOf.Before(itemRepo.LastEventAt())
+}
+
+// parseAsOf legge il parametro as_of (RFC3339); found è false se il parametro è assente
+func parseAsOf(c *gin.Context) (asOf time.Time, found bool, err error) {
+	raw, found := c.GetQuery("as_of")
+	if !found {
+		return time.Time{}, false, nil
+	}
+
+	asOf, parseErr := time.Parse(time.RFC3339Nano, raw)
+	// Un istante futuro non è ancora immutabile e non può essere messo in cache
+	if parseErr != nil || asOf.After(time.Now()) {
+		return time.Time{}, true, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidAsOf)}
+	}
+	return asOf.UTC(), true, nil
+}
+
+// getItemsAsOf risponde con gli items che esistevano, fuori dal cestino, all'istante asOf
+func getItemsAsOf(c *gin.Context, asOf time.Time) {
+	cacheKey := cachePrefix + "asof:" + asOf.Format(time.RFC3339Nano) + ":all"
+
+	// Controlla se gli items sono presenti nella cache
+	val, err := getCachedItems(cacheKey, cacheFields(c))
+	if err == redis.Nil {
+		// Se non sono nella cache, ricostruiscili dalla sorgente
+		settled := asOfSettled(asOf)
+		items, err := getItemsFromSourceAsOf(asOf)
+		if err != nil {
+			abortWithError(c, asOfError(c, err))
+			return
+		}
+		// Salva gli items nella cache, se non possono più cambiare
+		if settled {
+			setCachedItems(cacheKey, cacheFields(c), items, asOfCacheDuration)
+		}
+		setAsOfCacheControl(c, settled)
+		render(c, http.StatusOK, items)
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+	} else {
+		// Se sono nella cache, restituiscili
+		var items []schemas.Item
+		json.Unmarshal([]byte(val), &items)
+		c.Header("Cache-Control", asOfCacheControl)
+		render(c, http.StatusOK, items)
+	}
+}
+
+// getItemAsOf risponde con l'item com'era all'istante asOf
+func getItemAsOf(c *gin.Context, id string, asOf time.Time) {
+	cacheKey := cachePrefix + "asof:" + asOf.Format(time.RFC3339Nano) + ":" + id
+
+	// Controlla se l'item è presente nella cache
+	val, err := getCachedItems(cacheKey, cacheFields(c))
+	if err == redis.Nil {
+		// Se non è nella cache, ricostruiscilo dalla sorgente
+		settled := asOfSettled(asOf)
+		items, err := getItemsFromSourceAsOf(asOf)
+		if err != nil {
+			abortWithError(c, asOfError(c, err))
+			return
+		}
+		var item *schemas.Item
+		for i := range items {
+			if strconv.Itoa(items[i].ID) == id {
+				item = &items[i]
+			}
+		}
+		if item == nil {
+			abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+			return
+		}
+		// Salva l'item nella cache, se non può più cambiare
+		if settled {
+			setCachedItems(cacheKey, cacheFields(c), item, asOfCacheDuration)
+		}
+		setAsOfCacheControl(c, settled)
+		render(c, http.StatusOK, item)
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+	} else {
+		// Se è nella cache, restituiscilo
+		var item schemas.Item
+		json.Unmarshal([]byte(val), &item)
+		c.Header("Cache-Control", asOfCacheControl)
+		render(c, http.StatusOK, item)
+	}
+}
+
+// setAsOfCacheControl dichiara immutabile solo uno stato che non può più cambiare
+func setAsOfCacheControl(c *gin.Context, settled bool) {
+	if settled {
+		c.Header("Cache-Control", asOfCacheControl)
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+}
+
+// asOfError converte l'errore di ListAt: un istante fuori dalla storia conservata è un parametro non valido
+func asOfError(c *gin.Context, err error) *APIError {
+	if errors.Is(err, repository.ErrHistoryTrimmed) {
+		return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgAsOfTrimmed)}
+	}
+	return &APIError{Code: codeStorageError, Err: err}
+}
+
+func getItemsFromSourceAsOf(asOf time.Time) ([]schemas.Item, error) {
+	all, err := itemRepo.ListAt(asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []schemas.Item{}
+	for _, item := range all {
+		if item.DeletedAt == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
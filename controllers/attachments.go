@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+const (
+	// mimeSniffLength è quanto del file viene letto per riconoscerne il tipo
+	mimeSniffLength = 3072
+	// I metadati degli allegati di ogni item sono un hash in Redis con l'ID
+	// dell'allegato come campo, così sopravvivono ai riavvii come i file
+	attachmentsPrefix = "attachments:"
+)
+
+var blobStore repository.BlobStore
+
+var maxAttachmentSize int64 = 10 << 20
+var allowedAttachmentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+}
+
+// SetBlobStore imposta dove vengono salvati i file allegati
+func SetBlobStore(store repository.BlobStore) {
+	blobStore = store
+}
+
+// SetAttachmentLimits imposta la dimensione massima in byte e i tipi MIME ammessi per gli allegati
+func SetAttachmentLimits(maxSize int64, allowedTypes []string) {
+	if maxSize > 0 {
+		maxAttachmentSize = maxSize
+	}
+	if len(allowedTypes) > 0 {
+		allowedAttachmentTypes = allowedTypes
+	}
+}
+
+// SetAttachments sostituisce i metadati di tutti gli allegati
+func SetAttachments(attachments map[int][]schemas.Attachment) {
+	var keys []string
+	iter := rdb.Scan(0, attachmentsPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) > 0 {
+		rdb.Del(keys...)
+	}
+
+	for _, list := range attachments {
+		for _, attachment := range list {
+			saveAttachmentToSource(attachment)
+		}
+	}
+}
+
+func attachmentsKey(itemID int) string {
+	return attachmentsPrefix + strconv.Itoa(itemID)
+}
+
+// @Summary Upload an attachment
+// @Description Attach a photo or a PDF to an item. The type is detected from the content, not from the file name
+// @Accept multipart/form-data
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Item ID"
+// @Param file formData file true "File to attach"
+// @Success 201 {object} schemas.Attachment
+// @Failure 400 {object} schemas.Problem "missing_parameter"
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Failure 413 {object} schemas.Problem "attachment_too_large"
+// @Failure 415 {object} schemas.Problem "unsupported_media_type"
+// @Failure 500 {object} schemas.Problem "storage_error, cache_error"
+// @Router /items/{id}/attachments [post]
+func UploadAttachment(c *gin.Context) {
+	id := c.Param("id")
+	item := getItemFromSourceByID(id)
+	if item == nil {
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+		return
+	}
+
+	// Il margine copre le intestazioni multipart, il limite sul file è controllato sotto
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentSize+1<<20)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeMissingParameter, Detail: localize(c, msgMissingFile)})
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			abortWithError(c, &APIError{Code: codeMissingParameter, Detail: localize(c, msgMissingFile)})
+			return
+		} else if err != nil {
+			abortUpload(c, err)
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			continue
+		}
+
+		attachment, err := storeAttachment(c, item.ID, part)
+		part.Close()
+		if err != nil {
+			abortUpload(c, err)
+			return
+		}
+
+		render(c, http.StatusCreated, attachment)
+		return
+	}
+}
+
+// storeAttachment riconosce il tipo del file e lo salva nel BlobStore senza caricarlo tutto in memoria
+func storeAttachment(c *gin.Context, itemID int, part *multipart.Part) (*schemas.Attachment, error) {
+	head := make([]byte, mimeSniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	detected := mimetype.Detect(head)
+	if !mimetype.EqualsAny(detected.String(), allowedAttachmentTypes...) {
+		return nil, &APIError{Code: codeUnsupportedMediaType, Detail: localize(c, msgUnsupportedAttachment, detected.String())}
+	}
+
+	attachment := schemas.Attachment{
+		ID:          newRandomID(),
+		ItemID:      itemID,
+		FileName:    filepath.Base(part.FileName()),
+		ContentType: detected.String(),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	// Legge un byte oltre il limite per accorgersi dei file troppo grandi
+	content := io.LimitReader(io.MultiReader(bytes.NewReader(head), part), maxAttachmentSize+1)
+	key := attachmentKey(itemID, attachment.ID)
+	size, err := blobStore.Put(key, content)
+	if err != nil {
+		blobStore.Delete(key)
+		return nil, err
+	}
+	if size > maxAttachmentSize {
+		blobStore.Delete(key)
+		return nil, &APIError{Code: codeAttachmentTooLarge, Detail: localize(c, msgAttachmentTooLarge, strconv.FormatInt(maxAttachmentSize, 10))}
+	}
+	attachment.Size = size
+
+	if err := saveAttachmentToSource(attachment); err != nil {
+		blobStore.Delete(key)
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+	return &attachment, nil
+}
+
+// abortUpload converte gli errori di lettura del multipart nel problem corretto
+func abortUpload(c *gin.Context, err error) {
+	var apiErr *APIError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &apiErr):
+		abortWithError(c, apiErr)
+	case errors.As(err, &maxBytesErr):
+		abortWithError(c, &APIError{Code: codeAttachmentTooLarge, Detail: localize(c, msgAttachmentTooLarge, strconv.FormatInt(maxAttachmentSize, 10))})
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		abortWithError(c, &APIError{Code: codeMalformedBody, Detail: err.Error()})
+	default:
+		abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+	}
+}
+
+// @Summary List the attachments of an item
+// @Description Retrieve the metadata of every file attached to an item
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Item ID"
+// @Success 200 {array} schemas.Attachment
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Router /items/{id}/attachments [get]
+func GetAttachments(c *gin.Context) {
+	id := c.Param("id")
+	if getItemFromSourceByID(id) == nil {
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+		return
+	}
+
+	render(c, http.StatusOK, getAttachmentsFromSource(parseItemID(id)))
+}
+
+// @Summary Download an attachment
+// @Description Download the content of an attachment. Range requests are supported, so large files can be resumed
+// @Produce application/octet-stream
+// @Param id path int true "Item ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file "Partial Content"
+// @Failure 404 {object} schemas.Problem "item_not_found, attachment_not_found"
+// @Failure 416 "Range Not Satisfiable"
+// @Router /items/{id}/attachments/{attachmentId} [get]
+func DownloadAttachment(c *gin.Context) {
+	id := c.Param("id")
+	if getItemFromSourceByID(id) == nil {
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+		return
+	}
+
+	attachment := getAttachmentFromSource(parseItemID(id), c.Param("attachmentId"))
+	if attachment == nil {
+		abortWithError(c, &APIError{Code: codeAttachmentNotFound, Detail: localize(c, msgAttachmentNotFound)})
+		return
+	}
+
+	blob, err := blobStore.Open(attachmentKey(attachment.ItemID, attachment.ID))
+	if errors.Is(err, repository.ErrBlobNotFound) {
+		abortWithError(c, &APIError{Code: codeAttachmentNotFound, Detail: localize(c, msgAttachmentNotFound)})
+		return
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+		return
+	}
+	defer blob.Close()
+
+	// ServeContent gestisce Range, If-Range e If-Modified-Since
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	http.ServeContent(c.Writer, c.Request, attachment.FileName, attachment.CreatedAt, blob)
+}
+
+// @Summary Delete an attachment
+// @Description Delete a single attachment of an item
+// @Param id path int true "Item ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} schemas.Problem "attachment_not_found"
+// @Failure 500 {object} schemas.Problem "storage_error, cache_error"
+// @Router /items/{id}/attachments/{attachmentId} [delete]
+func DeleteAttachment(c *gin.Context) {
+	itemID := parseItemID(c.Param("id"))
+	attachmentID := c.Param("attachmentId")
+
+	deleted, err := deleteAttachmentFromSource(itemID, attachmentID)
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	if !deleted {
+		abortWithError(c, &APIError{Code: codeAttachmentNotFound, Detail: localize(c, msgAttachmentNotFound)})
+		return
+	}
+	if err := blobStore.Delete(attachmentKey(itemID, attachmentID)); err != nil {
+		abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// deleteItemAttachments elimina metadati e file di tutti gli allegati di un item
+func deleteItemAttachments(itemID int) error {
+	if err := rdb.Del(attachmentsKey(itemID)).Err(); err != nil {
+		return err
+	}
+
+	if blobStore == nil {
+		return nil
+	}
+	return blobStore.DeletePrefix("items/" + strconv.Itoa(itemID))
+}
+
+func attachmentKey(itemID int, attachmentID string) string {
+	return "items/" + strconv.Itoa(itemID) + "/" + attachmentID
+}
+
+func newRandomID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Funzioni per interagire con i metadati degli allegati
+func getAttachmentsFromSource(itemID int) []schemas.Attachment {
+	values, err := rdb.HVals(attachmentsKey(itemID)).Result()
+	if err != nil {
+		log.Printf("allegati dell'item %d: %v", itemID, err)
+	}
+
+	attachments := []schemas.Attachment{}
+	for _, value := range values {
+		var attachment schemas.Attachment
+		if err := json.Unmarshal([]byte(value), &attachment); err == nil {
+			attachments = append(attachments, attachment)
+		}
+	}
+	// L'hash non ha un ordine: gli allegati sono restituiti dal più vecchio
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments
+}
+
+func getAttachmentFromSource(itemID int, attachmentID string) *schemas.Attachment {
+	value, err := rdb.HGet(attachmentsKey(itemID), attachmentID).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("allegato %s dell'item %d: %v", attachmentID, itemID, err)
+		}
+		return nil
+	}
+
+	var attachment schemas.Attachment
+	if err := json.Unmarshal([]byte(value), &attachment); err != nil {
+		return nil
+	}
+	return &attachment
+}
+
+func saveAttachmentToSource(attachment schemas.Attachment) error {
+	data, err := json.Marshal(attachment)
+	if err != nil {
+		return err
+	}
+	return rdb.HSet(attachmentsKey(attachment.ItemID), attachment.ID, data).Err()
+}
+
+func deleteAttachmentFromSource(itemID int, attachmentID string) (bool, error) {
+	n, err := rdb.HDel(attachmentsKey(itemID), attachmentID).Result()
+	return n > 0, err
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gin-try/schemas"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+// Comportamento di DeleteCategory quando la categoria contiene ancora items
+const (
+	CategoryDeleteRestrict = "restrict"
+	CategoryDeleteCascade  = "cascade"
+)
+
+const categoryCachePrefix = "categories:"
+
+// categoriesStore è letta insieme da handler, gRPC, job e rendering v2: ogni accesso passa da categoriesMu
+var categoriesMu sync.RWMutex
+var categoriesStore = []schemas.Category{}
+var categoryDeleteMode = CategoryDeleteRestrict
+
+// SetCategories sostituisce il contenuto della sorgente dati delle categorie
+func SetCategories(categories []schemas.Category) {
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+	categoriesStore = append([]schemas.Category{}, categories...)
+}
+
+// SetCategoryDeleteMode sceglie se l'eliminazione di una categoria non vuota viene
+// rifiutata (restrict) o elimina anche i suoi items (cascade)
+func SetCategoryDeleteMode(mode string) error {
+	switch mode {
+	case CategoryDeleteRestrict, CategoryDeleteCascade:
+		categoryDeleteMode = mode
+		return nil
+	}
+	return fmt.Errorf("unknown category delete mode %q", mode)
+}
+
+// @Summary Get all categories
+// @Description Retrieve a list of all categories
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Success 200 {array} schemas.Category
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /categories [get]
+func GetCategories(c *gin.Context) {
+	cacheKey := categoryCachePrefix + "all"
+
+	// Controlla se le categorie sono presenti nella cache
+	val, err := rdb.Get(cacheKey).Result()
+	if err == redis.Nil {
+		// Se non sono nella cache, recuperale dalla sorgente
+		var categories []schemas.Category = getCategoriesFromSource()
+		// Salva le categorie nella cache
+		jsonData, _ := json.Marshal(categories)
+		rdb.Set(cacheKey, jsonData, cacheDuration)
+		render(c, http.StatusOK, categories)
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+	} else {
+		// Se sono nella cache, restituiscile
+		var categories []schemas.Category
+		json.Unmarshal([]byte(val), &categories)
+		render(c, http.StatusOK, categories)
+	}
+}
+
+// @Summary Get category by ID
+// @Description Retrieve a category by its ID
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Category ID"
+// @Success 200 {object} schemas.Category
+// @Failure 404 {object} schemas.Problem "category_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /categories/{id} [get]
+func GetCategoryByID(c *gin.Context) {
+	id := c.Param("id")
+	cacheKey := categoryCachePrefix + id
+
+	// Controlla se la categoria è presente nella cache
+	val, err := rdb.Get(cacheKey).Result()
+	if err == redis.Nil {
+		// Se non è nella cache, recuperala dalla sorgente
+		category := getCategoryFromSourceByID(id)
+		if category == nil {
+			abortWithError(c, &APIError{Code: codeCategoryNotFound, Detail: localize(c, msgCategoryNotFound)})
+			return
+		}
+		// Salva la categoria nella cache
+		jsonData, _ := json.Marshal(category)
+		rdb.Set(cacheKey, jsonData, cacheDuration)
+		render(c, http.StatusOK, category)
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+	} else {
+		// Se è nella cache, restituiscila
+		var category schemas.Category
+		json.Unmarshal([]byte(val), &category)
+		render(c, http.StatusOK, category)
+	}
+}
+
+// @Summary Get the items of a category
+// @Description Retrieve all items that belong to a category
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Category ID"
+// @Success 200 {array} schemas.Item
+// @Failure 404 {object} schemas.Problem "category_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /categories/{id}/items [get]
+func GetCategoryItems(c *gin.Context) {
+	id := c.Param("id")
+	cacheKey := categoryCachePrefix + id + ":items"
+
+	// Controlla se gli items della categoria sono presenti nella cache
+	val, err := rdb.Get(cacheKey).Result()
+	if err == redis.Nil {
+		// Se non sono nella cache, recuperali dalla sorgente
+		if getCategoryFromSourceByID(id) == nil {
+			abortWithError(c, &APIError{Code: codeCategoryNotFound, Detail: localize(c, msgCategoryNotFound)})
+			return
+		}
+		var items []schemas.Item = getItemsFromSourceByCategory(parseItemID(id))
+		// Salva gli items nella cache
+		jsonData, _ := json.Marshal(items)
+		rdb.Set(cacheKey, jsonData, cacheDuration)
+		render(c, http.StatusOK, items)
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+	} else {
+		// Se sono nella cache, restituiscili
+		var items []schemas.Item
+		json.Unmarshal([]byte(val), &items)
+		render(c, http.StatusOK, items)
+	}
+}
+
+// @Summary Create a new category
+// @Description Create a new category with the provided JSON data
+// @Accept json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param category body schemas.Category true "Category object"
+// @Success 201 {object} schemas.Category
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Router /categories [post]
+func CreateCategory(c *gin.Context) {
+	var newCategory schemas.Category
+	if err := bindCategory(c, &newCategory, 0); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	newCategory.Name = strings.TrimSpace(newCategory.Name)
+	newCategory.Description = strings.TrimSpace(newCategory.Description)
+	newCategory.CreatedAt = time.Now().UTC()
+	newCategory.UpdatedAt = newCategory.CreatedAt
+	// La sorgente dati assegna il nuovo ID
+	newCategory = saveCategoryToSource(newCategory)
+
+	// Invalida la cache di tutte le categorie
+	rdb.Del(categoryCachePrefix + "all")
+
+	render(c, http.StatusCreated, newCategory)
+}
+
+// @Summary Update a category by ID
+// @Description Update a category by its ID with the provided JSON data
+// @Accept json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Category ID"
+// @Param category body schemas.Category true "Updated category object"
+// @Success 200 {object} schemas.Category
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 404 {object} schemas.Problem "category_not_found"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Router /categories/{id} [put]
+func UpdateCategory(c *gin.Context) {
+	id := c.Param("id")
+
+	var updatedCategory schemas.Category
+	if err := bindCategory(c, &updatedCategory, parseItemID(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	existing := getCategoryFromSourceByID(id)
+	if existing == nil {
+		abortWithError(c, &APIError{Code: codeCategoryNotFound, Detail: localize(c, msgCategoryNotFound)})
+		return
+	}
+	updatedCategory.ID = existing.ID
+	updatedCategory.Name = strings.TrimSpace(updatedCategory.Name)
+	updatedCategory.Description = strings.TrimSpace(updatedCategory.Description)
+	updatedCategory.CreatedAt = existing.CreatedAt
+	updatedCategory.UpdatedAt = time.Now().UTC()
+	updateCategoryInSource(id, updatedCategory)
+
+	// Invalida la cache della singola categoria e di tutte le categorie
+	rdb.Del(categoryCachePrefix+id, categoryCachePrefix+"all")
+
+	render(c, http.StatusOK, updatedCategory)
+}
+
+// @Summary Delete category by ID
+// @Description Delete a category by its ID. Depending on the server configuration a category that still has items is either refused (restrict) or deleted together with its items (cascade)
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Category ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} schemas.Problem "category_not_found"
+// @Failure 409 {object} schemas.Problem "category_not_empty"
+// @Router /categories/{id} [delete]
+func DeleteCategory(c *gin.Context) {
+	id := c.Param("id")
+
+	if getCategoryFromSourceByID(id) == nil {
+		abortWithError(c, &APIError{Code: codeCategoryNotFound, Detail: localize(c, msgCategoryNotFound)})
+		return
+	}
+
+	items := getItemsFromSourceByCategory(parseItemID(id))
+	if len(items) > 0 {
+		if categoryDeleteMode == CategoryDeleteRestrict {
+			abortWithError(c, &APIError{Code: codeCategoryNotEmpty, Detail: localize(c, msgCategoryNotEmpty, strconv.Itoa(len(items)))})
+			return
+		}
+
+		// Cascade: elimina gli items della categoria e la loro cache
+		for _, item := range items {
+			if err := deleteItemFromSource(strconv.Itoa(item.ID)); err != nil {
+				abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+				return
+			}
+			rdb.Del(itemCacheKeys(strconv.Itoa(item.ID))...)
+			recordRevision(c, schemas.ActionDelete, &item, nil)
+		}
+		rdb.Del(itemCacheKeys("all")...)
+	}
+
+	deleteCategoryFromSource(id)
+
+	// Elimina la categoria e i suoi items dalla cache
+	rdb.Del(categoryCachePrefix+id, categoryCachePrefix+id+":items", categoryCachePrefix+"all")
+
+	c.Status(http.StatusNoContent)
+}
+
+// invalidateCategoryItems elimina dalla cache la lista degli items delle categorie indicate
+func invalidateCategoryItems(categoryIDs ...int) {
+	for _, categoryID := range categoryIDs {
+		if categoryID != 0 {
+			rdb.Del(categoryCachePrefix + strconv.Itoa(categoryID) + ":items")
+		}
+	}
+}
+
+// Funzioni per interagire con la sorgente dati delle categorie. Restituiscono
+// copie, così chi legge non condivide la slice con chi la modifica.
+func getCategoriesFromSource() []schemas.Category {
+	categoriesMu.RLock()
+	defer categoriesMu.RUnlock()
+	return append([]schemas.Category{}, categoriesStore...)
+}
+
+func getCategoryFromSourceByID(id string) *schemas.Category {
+	categoriesMu.RLock()
+	defer categoriesMu.RUnlock()
+	for _, category := range categoriesStore {
+		if strconv.Itoa(category.ID) == id {
+			return &category
+		}
+	}
+	return nil
+}
+
+func getItemsFromSourceByCategory(categoryID int) []schemas.Item {
+	items := []schemas.Item{}
+	for _, item := range getItemsFromSource() {
+		if item.CategoryID == categoryID {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func categoryNameTaken(name string, excludeID int) bool {
+	categoriesMu.RLock()
+	defer categoriesMu.RUnlock()
+	for _, category := range categoriesStore {
+		if category.ID != excludeID && strings.EqualFold(strings.TrimSpace(category.Name), strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveCategoryToSource assegna alla categoria l'ID successivo al più alto e la aggiunge
+func saveCategoryToSource(category schemas.Category) schemas.Category {
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+	maxID := 0
+	for _, existing := range categoriesStore {
+		maxID = max(maxID, existing.ID)
+	}
+	category.ID = maxID + 1
+	categoriesStore = append(categoriesStore, category)
+	return category
+}
+
+func updateCategoryInSource(id string, updatedCategory schemas.Category) bool {
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+	for i, category := range categoriesStore {
+		if strconv.Itoa(category.ID) == id {
+			categoriesStore[i] = updatedCategory
+			return true
+		}
+	}
+	return false
+}
+
+func deleteCategoryFromSource(id string) bool {
+	categoriesMu.Lock()
+	defer categoriesMu.Unlock()
+	for i, category := range categoriesStore {
+		if strconv.Itoa(category.ID) == id {
+			categoriesStore = append(categoriesStore[:i], categoriesStore[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
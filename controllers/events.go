@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"gin-try/schemas"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+	// subscriberBuffer è quanti eventi può accumulare un client lento prima di essere disconnesso
+	subscriberBuffer = 64
+)
+
+var eventHeartbeat = 15 * time.Second
+var itemEvents = newItemEventBroker(1000)
+
+// SetEventBufferSize imposta quanti eventi recenti vengono conservati per chi
+// riprende lo stream con Last-Event-ID; il buffer riparte vuoto
+func SetEventBufferSize(size int) {
+	if size > 0 {
+		itemEvents = newItemEventBroker(size)
+	}
+}
+
+// itemEventBroker numera gli eventi, conserva gli ultimi in un buffer limitato
+// e li inoltra ai client collegati
+type itemEventBroker struct {
+	mu          sync.Mutex
+	seq         int64
+	size        int
+	buffer      []schemas.ItemEvent
+	subscribers map[chan schemas.ItemEvent]struct{}
+}
+
+func newItemEventBroker(size int) *itemEventBroker {
+	return &itemEventBroker{size: size, subscribers: map[chan schemas.ItemEvent]struct{}{}}
+}
+
+// publish assegna l'ID all'evento e lo restituisce
+func (b *itemEventBroker) publish(event schemas.ItemEvent) schemas.ItemEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.ID = b.seq
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > b.size {
+		b.buffer = append([]schemas.ItemEvent(nil), b.buffer[len(b.buffer)-b.size:]...)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Il client non sta al passo: viene disconnesso e riprenderà con Last-Event-ID
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return event
+}
+
+// subscribe registra un nuovo client e restituisce gli eventi successivi a
+// lastID ancora nel buffer. gap è vero se alcuni eventi non sono più disponibili.
+func (b *itemEventBroker) subscribe(lastID int64, resume bool) (ch chan schemas.ItemEvent, replay []schemas.ItemEvent, gap bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if resume {
+		// Un ID più grande dell'ultimo evento viene da prima di un riavvio del server
+		gap = lastID > b.seq || (lastID < b.seq && (len(b.buffer) == 0 || b.buffer[0].ID > lastID+1))
+		for _, event := range b.buffer {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch = make(chan schemas.ItemEvent, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+	return ch, replay, gap
+}
+
+func (b *itemEventBroker) unsubscribe(ch chan schemas.ItemEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *itemEventBroker) lastID() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq
+}
+
+// @Summary Stream item changes
+// @Description Server-Sent Events stream with one created, updated or deleted event for every change to an item. Reconnecting with Last-Event-ID replays the events missed in the meantime; if some of them are no longer available a reset event is sent first and the client should reload the items
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Param last_event_id query int false "Same as the Last-Event-ID header, for clients that cannot set headers"
+// @Success 200 {object} schemas.ItemEvent "One event per change"
+// @Failure 400 {object} schemas.Problem "invalid_parameter"
+// @Router /items/events [get]
+func GetItemEvents(c *gin.Context) {
+	lastEventID := c.GetHeader(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			abortWithError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidLastEventID)})
+			return
+		}
+	}
+
+	broker := itemEvents
+	events, replay, gap := broker.subscribe(lastID, lastEventID != "")
+	defer broker.unsubscribe(events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Disattiva il buffering dei reverse proxy come nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if gap {
+		c.Render(-1, sse.Event{Event: "reset", Id: strconv.FormatInt(broker.lastID(), 10), Data: "reload the items"})
+	}
+	for _, event := range replay {
+		renderItemEvent(c, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			renderItemEvent(c, event)
+		case <-heartbeat.C:
+			// I commenti mantengono aperta la connessione attraverso i proxy
+			c.Writer.WriteString(": keepalive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func renderItemEvent(c *gin.Context, event schemas.ItemEvent) {
+	c.Render(-1, sse.Event{Event: event.Type, Id: strconv.FormatInt(event.ID, 10), Data: event})
+}
+
+// publishItemEvent notifica una modifica registrata nello storico agli stream SSE
+// di questa replica, tramite Redis ai WebSocket di tutte le repliche e ai webhooks
+func publishItemEvent(action string, before, after *schemas.Item) {
+	event := schemas.ItemEvent{Type: schemas.EventUpdated, Item: copyItem(after), At: time.Now().UTC()}
+	switch action {
+	case schemas.ActionCreate:
+		event.Type = schemas.EventCreated
+	case schemas.ActionDelete:
+		event.Type = schemas.EventDeleted
+		event.Item = copyItem(before)
+	}
+	if event.Item != nil {
+		event.ItemID = event.Item.ID
+	}
+
+	event = itemEvents.publish(event)
+	relayItemChange(itemChange{Event: event, Before: copyItem(before)})
+	dispatchWebhooks(event)
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"gin-try/schemas"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportBatchSize è quanti items vengono letti dalla sorgente dati per volta
+const exportBatchSize = 500
+
+// exportMediaTypes sono i formati dell'export; il primo è quello di default
+var exportMediaTypes = []string{mediaNDJSON, mediaCSV, mediaJSON}
+
+// exportFormats permette di scegliere il formato con ?format=, ad esempio da un link nel browser
+var exportFormats = map[string]string{
+	"ndjson": mediaNDJSON,
+	"csv":    mediaCSV,
+	"json":   mediaJSON,
+}
+
+var exportFileExtensions = map[string]string{
+	mediaNDJSON: "ndjson",
+	mediaCSV:    "csv",
+	mediaJSON:   "json",
+}
+
+// @Summary Export all items
+// @Description Stream every item, or the items whose name contains name, as NDJSON (default), CSV or a JSON array.
+// @Description The format is chosen with the Accept header or the format parameter. The response is sent in chunks while the items are read, so it can be as large as the catalog.
+// @Produce application/x-ndjson,text/csv,json
+// @Param name query string false "Only items whose name contains this string, as in /items/search"
+// @Param format query string false "Format of the file, instead of the Accept header" Enums(ndjson, csv, json)
+// @Success 200 {array} schemas.Item
+// @Failure 400 {object} schemas.Problem "invalid_parameter"
+// @Failure 406 {object} schemas.Problem "not_acceptable"
+// @Router /items/export [get]
+func ExportItems(c *gin.Context) {
+	c.Header("Vary", "Accept")
+	mediaType, ok := negotiateMediaType(c.GetHeader("Accept"), exportMediaTypes)
+	if format := c.Query("format"); format != "" {
+		mediaType, ok = exportFormats[format]
+		if !ok {
+			abortWithError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidFormat, "format", "ndjson, csv, json")})
+			return
+		}
+	}
+	if !ok {
+		abortWithError(c, &APIError{Code: codeNotAcceptable, Detail: localize(c, msgNotAcceptable, strings.Join(exportMediaTypes, ", "))})
+		return
+	}
+	name := c.Query("name")
+
+	c.Header("Content-Type", mediaType+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="items.`+exportFileExtensions[mediaType]+`"`)
+	c.Status(http.StatusOK)
+
+	writer := newExportWriter(mediaType, c.Writer)
+	// Gli items vengono letti a blocchi e inviati subito: senza Content-Length la
+	// risposta usa il chunked transfer encoding e la memoria non dipende dal catalogo
+	afterID := 0
+	for {
+		batch := itemRepo.ListAfter(afterID, exportBatchSize)
+		if len(batch) == 0 {
+			break
+		}
+		for _, item := range batch {
+			afterID = item.ID
+			if item.DeletedAt != nil || name != "" && !itemNameMatches(item.Name, name) {
+				continue
+			}
+			if err := writer.write(item); err != nil {
+				// Il client si è disconnesso: la risposta è già iniziata e non può diventare un errore
+				return
+			}
+		}
+		c.Writer.Flush()
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+	writer.close()
+	c.Writer.Flush()
+}
+
+// exportWriter scrive gli items uno alla volta nel formato dell'export
+type exportWriter interface {
+	write(item schemas.Item) error
+	close() error
+}
+
+func newExportWriter(mediaType string, w io.Writer) exportWriter {
+	switch mediaType {
+	case mediaCSV:
+		return &csvExportWriter{w: csv.NewWriter(w)}
+	case mediaJSON:
+		return &jsonArrayExportWriter{w: w}
+	}
+	return &ndjsonExportWriter{w: w}
+}
+
+type ndjsonExportWriter struct {
+	w io.Writer
+}
+
+func (e *ndjsonExportWriter) write(item schemas.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *ndjsonExportWriter) close() error {
+	return nil
+}
+
+// jsonArrayExportWriter scrive un array JSON un elemento alla volta
+type jsonArrayExportWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *jsonArrayExportWriter) write(item schemas.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if !e.started {
+		separator = "["
+		e.started = true
+	}
+	_, err = io.WriteString(e.w, separator+string(data))
+	return err
+}
+
+func (e *jsonArrayExportWriter) close() error {
+	if !e.started {
+		_, err := io.WriteString(e.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+// csvExportWriter usa le stesse colonne e celle delle risposte CSV, così il file
+// può essere reimportato con POST /items/import
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (e *csvExportWriter) write(item schemas.Item) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	value, err := decodeOrdered(data)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{}
+	for _, field := range value.(orderedObject) {
+		values[field.key] = field.value
+	}
+	record := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		record[i] = csvCell(values[column])
+	}
+	if err := e.w.Write(record); err != nil {
+		return err
+	}
+	// csv.Writer ha un buffer proprio, che va svuotato a ogni riga per inviarla
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader scrive l'intestazione prima della prima riga; tutti i campi, anche
+// quelli omessi quando sono vuoti, hanno la loro colonna
+func (e *csvExportWriter) writeHeader() error {
+	if e.columns != nil {
+		return nil
+	}
+	itemType := reflect.TypeOf(schemas.Item{})
+	for i := 0; i < itemType.NumField(); i++ {
+		e.columns = append(e.columns, jsonFieldName(itemType.Field(i)))
+	}
+	return e.w.Write(e.columns)
+}
+
+func (e *csvExportWriter) close() error {
+	// Anche un export vuoto ha l'intestazione
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
@@ -0,0 +1,788 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+const (
+	graphqlDefaultPageSize = 20
+	graphqlMaxPageSize     = 100
+	graphqlMaxDepth        = 10
+	graphqlCursorPrefix    = "item:"
+)
+
+// graphqlSDL descrive lo schema esposto su /graphql
+const graphqlSDL = `
+schema {
+	query: Query
+	mutation: Mutation
+	subscription: Subscription
+}
+
+scalar Time
+
+type Item {
+	id: ID!
+	name: String!
+	description: String!
+	tags: [String!]!
+	"Importo con due decimali, ad esempio 12.50"
+	price: String!
+	quantity: Int!
+	categoryId: ID
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+type ItemEdge {
+	cursor: String!
+	node: Item!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+
+type ItemConnection {
+	edges: [ItemEdge!]!
+	pageInfo: PageInfo!
+	totalCount: Int!
+}
+
+enum ItemEventType {
+	CREATED
+	UPDATED
+	DELETED
+}
+
+type ItemEvent {
+	id: ID!
+	type: ItemEventType!
+	itemId: ID!
+	item: Item
+	at: Time!
+}
+
+input ItemInput {
+	name: String!
+	description: String
+	tags: [String!]
+	price: String
+	quantity: Int
+	categoryId: ID
+}
+
+type Query {
+	item(id: ID!): Item
+	items(first: Int, after: String, search: String): ItemConnection!
+}
+
+type Mutation {
+	createItem(input: ItemInput!): Item!
+	"Sostituisce l'item come PUT /items/{id}"
+	updateItem(id: ID!, input: ItemInput!): Item!
+	deleteItem(id: ID!): ID!
+}
+
+type Subscription {
+	itemChanged(itemId: ID, search: String): ItemEvent!
+}
+`
+
+var itemGraphQL = graphql.MustParseSchema(graphqlSDL, &graphqlResolver{}, graphql.MaxDepth(graphqlMaxDepth))
+
+// graphqlRequest porta il gin.Context ai resolver. I resolver possono girare in
+// parallelo ma gin.Context non è thread-safe: mu serializza il loro accesso.
+type graphqlRequest struct {
+	mu sync.Mutex
+	c  *gin.Context
+}
+
+type graphqlRequestKey struct{}
+
+func withGraphQLRequest(ctx context.Context, req *graphqlRequest) context.Context {
+	return context.WithValue(ctx, graphqlRequestKey{}, req)
+}
+
+// graphqlError espone un APIError come errore GraphQL, con il codice in extensions
+type graphqlError struct {
+	message string
+	code    string
+	errors  []schemas.FieldError
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code, "status": problemStatus(e.code)}
+	if len(e.errors) > 0 {
+		extensions["errors"] = e.errors
+	}
+	return extensions
+}
+
+// toGraphQLError traduce un errore come fa ErrorHandler: la causa interna viene loggata e mai mostrata
+func toGraphQLError(c *gin.Context, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &APIError{Code: codeInternalError, Err: err}
+	}
+	if apiErr.Err != nil {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, apiErr)
+	}
+
+	message := apiErr.Detail
+	if message == "" {
+		message = localize(c, "title_"+apiErr.Code)
+	}
+	return &graphqlError{message: message, code: apiErr.Code, errors: apiErr.Errors}
+}
+
+// graphqlResolver è la radice di query, mutation e subscription. Usa le stesse
+// funzioni degli handler REST, quindi la stessa cache e la stessa sorgente dati.
+type graphqlResolver struct{}
+
+// run esegue fn con il gin.Context della richiesta e traduce l'errore restituito
+func (r *graphqlResolver) run(ctx context.Context, fn func(c *gin.Context) error) error {
+	req := ctx.Value(graphqlRequestKey{}).(*graphqlRequest)
+	req.mu.Lock()
+	defer req.mu.Unlock()
+
+	if err := fn(req.c); err != nil {
+		return toGraphQLError(req.c, err)
+	}
+	return nil
+}
+
+func (r *graphqlResolver) Item(ctx context.Context, args struct{ ID graphql.ID }) (*itemResolver, error) {
+	var result *itemResolver
+	err := r.run(ctx, func(c *gin.Context) error {
+		item, err := loadItem(c, string(args.ID), nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == codeItemNotFound {
+			// In GraphQL un item inesistente è null, non un errore
+			return nil
+		} else if err != nil {
+			return err
+		}
+		result = &itemResolver{item: *item}
+		return nil
+	})
+	return result, err
+}
+
+type itemsArgs struct {
+	First  *int32
+	After  *string
+	Search *string
+}
+
+func (r *graphqlResolver) Items(ctx context.Context, args itemsArgs) (*itemConnectionResolver, error) {
+	var result *itemConnectionResolver
+	err := r.run(ctx, func(c *gin.Context) error {
+		first := graphqlDefaultPageSize
+		if args.First != nil {
+			first = int(*args.First)
+		}
+		if first < 0 || first > graphqlMaxPageSize {
+			return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidPageSize, "first", strconv.Itoa(graphqlMaxPageSize))}
+		}
+		afterID := 0
+		if args.After != nil {
+			var ok bool
+			if afterID, ok = decodeItemCursor(*args.After); !ok {
+				return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidCursor, "after")}
+			}
+		}
+
+		var items []schemas.Item
+		var err error
+		if args.Search != nil && *args.Search != "" {
+			items, err = searchItems(*args.Search, nil)
+		} else {
+			items, err = loadItems(nil)
+		}
+		if err != nil {
+			return err
+		}
+		result = newItemConnection(items, first, afterID)
+		return nil
+	})
+	return result, err
+}
+
+// itemInput è l'input delle mutation; i campi omessi valgono come in un body JSON senza quei campi
+type itemInput struct {
+	Name        string
+	Description *string
+	Tags        *[]string
+	Price       *string
+	Quantity    *int32
+	CategoryID  *graphql.ID
+}
+
+// toItem converte l'input e lo valida con le stesse regole del body REST
+func (in itemInput) toItem(c *gin.Context, excludeID int) (schemas.Item, error) {
+	item := schemas.Item{Name: in.Name}
+	if in.Description != nil {
+		item.Description = *in.Description
+	}
+	if in.Tags != nil {
+		item.Tags = *in.Tags
+	}
+	if in.Quantity != nil {
+		item.Quantity = int(*in.Quantity)
+	}
+
+	var inputErrors []schemas.FieldError
+	if in.Price != nil {
+		var err error
+		if item.Price, err = schemas.ParsePrice(*in.Price); err != nil {
+			inputErrors = append(inputErrors, invalidPrice(c))
+		}
+	}
+	if in.CategoryID != nil {
+		item.CategoryID = parseItemID(string(*in.CategoryID))
+		if item.CategoryID <= 0 {
+			item.CategoryID = 0
+			inputErrors = append(inputErrors, schemas.FieldError{
+				Field:   "category_id",
+				Rule:    "exists",
+				Message: localize(c, msgUnknownCategory, "category_id"),
+			})
+		}
+	}
+	return item, validateItem(c, &item, excludeID, inputErrors)
+}
+
+func (r *graphqlResolver) CreateItem(ctx context.Context, args struct{ Input itemInput }) (*itemResolver, error) {
+	var result *itemResolver
+	err := r.run(ctx, func(c *gin.Context) error {
+		newItem, err := args.Input.toItem(c, 0)
+		if err != nil {
+			return err
+		}
+		created, err := createItem(c, newItem)
+		if err != nil {
+			return err
+		}
+		result = &itemResolver{item: *created}
+		return nil
+	})
+	return result, err
+}
+
+func (r *graphqlResolver) UpdateItem(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input itemInput
+}) (*itemResolver, error) {
+	var result *itemResolver
+	err := r.run(ctx, func(c *gin.Context) error {
+		id := string(args.ID)
+		updatedItem, err := args.Input.toItem(c, parseItemID(id))
+		if err != nil {
+			return err
+		}
+		updated, err := updateItem(c, id, updatedItem)
+		if err != nil {
+			return err
+		}
+		result = &itemResolver{item: *updated}
+		return nil
+	})
+	return result, err
+}
+
+func (r *graphqlResolver) DeleteItem(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	err := r.run(ctx, func(c *gin.Context) error {
+		return deleteItem(c, string(args.ID))
+	})
+	return args.ID, err
+}
+
+func (r *graphqlResolver) ItemChanged(ctx context.Context, args struct {
+	ItemID *graphql.ID
+	Search *string
+}) (<-chan *itemEventResolver, error) {
+	var filter itemFilter
+	err := r.run(ctx, func(c *gin.Context) error {
+		if args.ItemID != nil {
+			if filter.itemID = parseItemID(string(*args.ItemID)); filter.itemID <= 0 {
+				return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidItemID, "itemId")}
+			}
+		}
+		if args.Search != nil {
+			filter.search = *args.Search
+		}
+		if filter.itemID != 0 && filter.search != "" {
+			return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidSubscription)}
+		}
+		return nil
+	})
+	if err != nil {
+		// Per le subscription la libreria non legge le extensions dall'errore del resolver
+		gqlErr := err.(*graphqlError)
+		return nil, &gqlerrors.QueryError{Message: gqlErr.message, Path: []interface{}{"itemChanged"}, Extensions: gqlErr.Extensions(), ResolverError: err}
+	}
+
+	listener := &graphqlListener{filter: filter, events: make(chan *itemEventResolver, subscriberBuffer)}
+	subscribers.add(listener)
+	go func() {
+		<-ctx.Done()
+		subscribers.remove(listener)
+		listener.close()
+	}()
+	return listener.events, nil
+}
+
+// graphqlListener riceve dall'hub le modifiche per una subscription itemChanged
+type graphqlListener struct {
+	filter itemFilter
+	events chan *itemEventResolver
+	mu     sync.Mutex
+	closed bool
+}
+
+func (l *graphqlListener) deliver(change itemChange) {
+	if !l.filter.matches(change) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	select {
+	case l.events <- &itemEventResolver{event: change.Event}:
+	default:
+		// Il client non sta al passo: chiudere il canale termina la subscription
+		l.closed = true
+		close(l.events)
+	}
+}
+
+func (l *graphqlListener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.events)
+	}
+}
+
+type itemResolver struct {
+	item schemas.Item
+}
+
+func (r *itemResolver) ID() graphql.ID {
+	return graphql.ID(strconv.Itoa(r.item.ID))
+}
+
+func (r *itemResolver) Name() string {
+	return r.item.Name
+}
+
+func (r *itemResolver) Description() string {
+	return r.item.Description
+}
+
+func (r *itemResolver) Tags() []string {
+	if r.item.Tags == nil {
+		return []string{}
+	}
+	return r.item.Tags
+}
+
+func (r *itemResolver) Price() string {
+	return r.item.Price.String()
+}
+
+func (r *itemResolver) Quantity() int32 {
+	return int32(r.item.Quantity)
+}
+
+func (r *itemResolver) CategoryID() *graphql.ID {
+	if r.item.CategoryID == 0 {
+		return nil
+	}
+	id := graphql.ID(strconv.Itoa(r.item.CategoryID))
+	return &id
+}
+
+func (r *itemResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.item.CreatedAt}
+}
+
+func (r *itemResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.item.UpdatedAt}
+}
+
+// I cursori sono opachi per il client: codificano l'ID dell'ultimo item della pagina.
+// Gli items sono ordinati per ID, quindi un cursore resta valido anche se l'item viene eliminato.
+func encodeItemCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(graphqlCursorPrefix + strconv.Itoa(id)))
+}
+
+func decodeItemCursor(cursor string) (int, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(data), graphqlCursorPrefix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(data), graphqlCursorPrefix))
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+type itemConnectionResolver struct {
+	edges       []*itemEdgeResolver
+	hasNextPage bool
+	totalCount  int
+}
+
+// newItemConnection restituisce al massimo first items con ID maggiore di afterID
+func newItemConnection(items []schemas.Item, first, afterID int) *itemConnectionResolver {
+	connection := &itemConnectionResolver{edges: []*itemEdgeResolver{}, totalCount: len(items)}
+	for _, item := range items {
+		if item.ID <= afterID {
+			continue
+		}
+		if len(connection.edges) == first {
+			connection.hasNextPage = true
+			break
+		}
+		connection.edges = append(connection.edges, &itemEdgeResolver{item: item})
+	}
+	return connection
+}
+
+func (r *itemConnectionResolver) Edges() []*itemEdgeResolver {
+	return r.edges
+}
+
+func (r *itemConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.edges) > 0 {
+		cursor := r.edges[len(r.edges)-1].Cursor()
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+func (r *itemConnectionResolver) TotalCount() int32 {
+	return int32(r.totalCount)
+}
+
+type itemEdgeResolver struct {
+	item schemas.Item
+}
+
+func (r *itemEdgeResolver) Cursor() string {
+	return encodeItemCursor(r.item.ID)
+}
+
+func (r *itemEdgeResolver) Node() *itemResolver {
+	return &itemResolver{item: r.item}
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+type itemEventResolver struct {
+	event schemas.ItemEvent
+}
+
+func (r *itemEventResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.event.ID, 10))
+}
+
+func (r *itemEventResolver) Type() string {
+	return strings.ToUpper(r.event.Type)
+}
+
+func (r *itemEventResolver) ItemID() graphql.ID {
+	return graphql.ID(strconv.Itoa(r.event.ItemID))
+}
+
+func (r *itemEventResolver) Item() *itemResolver {
+	if r.event.Item == nil {
+		return nil
+	}
+	return &itemResolver{item: *r.event.Item}
+}
+
+func (r *itemEventResolver) At() graphql.Time {
+	return graphql.Time{Time: r.event.At}
+}
+
+// @Summary Execute a GraphQL operation
+// @Description Run a query (item, items with cursor pagination and search) or a mutation (createItem, updateItem, deleteItem) against the same store and cache as the REST endpoints. Resolver errors carry the problem code in extensions.code. Subscriptions are served over WebSocket by GET /graphql
+// @Accept json
+// @Produce json
+// @Param operation body schemas.GraphQLRequest true "GraphQL operation"
+// @Param X-Actor header string false "Who is performing the change"
+// @Success 200 {object} schemas.GraphQLResponse
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Router /graphql [post]
+func PostGraphQL(c *gin.Context) {
+	var operation schemas.GraphQLRequest
+	fieldErrors, err := bindJSON(c, &operation)
+	if err == nil {
+		err = validationFailed(c, fieldErrors)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	ctx := withGraphQLRequest(c.Request.Context(), &graphqlRequest{c: c})
+	response := itemGraphQL.Exec(ctx, operation.Query, operation.OperationName, operation.Variables)
+	c.JSON(http.StatusOK, response)
+}
+
+// graphqlWSProtocol è il sottoprotocollo WebSocket delle subscription GraphQL
+const graphqlWSProtocol = "graphql-transport-ws"
+
+// Codici di chiusura definiti dal protocollo graphql-transport-ws
+const (
+	graphqlCloseInvalidMessage  = 4400
+	graphqlCloseUnauthorized    = 4401
+	graphqlCloseSubscriberTaken = 4409
+	graphqlCloseTooManyInits    = 4429
+)
+
+var graphqlUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, Subprotocols: []string{graphqlWSProtocol}}
+
+// graphqlWSConn è una connessione graphql-transport-ws con le sue operazioni attive, indicizzate per ID
+type graphqlWSConn struct {
+	conn       *websocket.Conn
+	request    *graphqlRequest
+	send       chan schemas.GraphQLWSMessage
+	done       chan struct{}
+	closeOnce  sync.Once
+	mu         sync.Mutex
+	acked      bool
+	operations map[string]context.CancelFunc
+}
+
+// @Summary Run GraphQL subscriptions over WebSocket
+// @Description Open a WebSocket with the graphql-transport-ws subprotocol: after connection_init/connection_ack, every subscribe message runs an operation and its results are pushed as next messages, followed by complete. The itemChanged subscription receives the changes made on any replica, optionally filtered by itemId or by a search term
+// @Param Upgrade header string true "websocket"
+// @Param Sec-WebSocket-Protocol header string true "graphql-transport-ws"
+// @Success 101 {object} schemas.GraphQLWSMessage "Switching Protocols"
+// @Router /graphql [get]
+func GraphQLSubscriptions(c *gin.Context) {
+	conn, err := graphqlUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// L'upgrader ha già risposto al client
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	w := &graphqlWSConn{
+		conn:       conn,
+		request:    &graphqlRequest{c: c},
+		send:       make(chan schemas.GraphQLWSMessage, subscriberBuffer),
+		done:       make(chan struct{}),
+		operations: map[string]context.CancelFunc{},
+	}
+	defer w.close()
+
+	go w.writeLoop()
+	w.readLoop(withGraphQLRequest(ctx, w.request))
+}
+
+// readLoop gestisce i messaggi del client finché la connessione resta aperta
+func (w *graphqlWSConn) readLoop(ctx context.Context) {
+	w.conn.SetReadLimit(wsMaxMessageSize)
+	w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	w.conn.SetPongHandler(func(string) error {
+		return w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg schemas.GraphQLWSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			w.closeWith(graphqlCloseInvalidMessage, "Invalid message")
+			return
+		}
+		if !w.handle(ctx, msg) {
+			return
+		}
+	}
+}
+
+// handle gestisce un messaggio e restituisce false se la connessione è stata chiusa
+func (w *graphqlWSConn) handle(ctx context.Context, msg schemas.GraphQLWSMessage) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch msg.Type {
+	case schemas.GraphQLWSConnectionInit:
+		if w.acked {
+			w.closeWith(graphqlCloseTooManyInits, "Too many initialisation requests")
+			return false
+		}
+		w.acked = true
+		w.enqueue(schemas.GraphQLWSMessage{Type: schemas.GraphQLWSConnectionAck})
+	case schemas.GraphQLWSPing:
+		w.enqueue(schemas.GraphQLWSMessage{Type: schemas.GraphQLWSPong})
+	case schemas.GraphQLWSPong:
+	case schemas.GraphQLWSSubscribe:
+		if !w.acked {
+			w.closeWith(graphqlCloseUnauthorized, "Unauthorized")
+			return false
+		}
+		var operation schemas.GraphQLRequest
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &operation) != nil || operation.Query == "" {
+			w.closeWith(graphqlCloseInvalidMessage, "Invalid message")
+			return false
+		}
+		if _, found := w.operations[msg.ID]; found {
+			w.closeWith(graphqlCloseSubscriberTaken, "Subscriber for "+msg.ID+" already exists")
+			return false
+		}
+		opCtx, cancel := context.WithCancel(ctx)
+		w.operations[msg.ID] = cancel
+		go w.execute(opCtx, msg.ID, operation)
+	case schemas.GraphQLWSComplete:
+		// Il client non vuole più risultati: l'operazione non invia il complete
+		if cancel, found := w.operations[msg.ID]; found {
+			cancel()
+			delete(w.operations, msg.ID)
+		}
+	default:
+		w.closeWith(graphqlCloseInvalidMessage, "Invalid message")
+		return false
+	}
+	return true
+}
+
+// execute esegue un'operazione e ne invia i risultati; query e mutation hanno un solo risultato
+func (w *graphqlWSConn) execute(ctx context.Context, id string, operation schemas.GraphQLRequest) {
+	responses, err := itemGraphQL.Subscribe(ctx, operation.Query, operation.OperationName, operation.Variables)
+	if err != nil {
+		payload, _ := json.Marshal([]schemas.GraphQLError{{Message: err.Error()}})
+		w.finish(id, schemas.GraphQLWSMessage{ID: id, Type: schemas.GraphQLWSError, Payload: payload})
+		return
+	}
+
+	first := true
+	for response := range responses {
+		if ctx.Err() != nil {
+			// Il canale va comunque svuotato, altrimenti la libreria resta bloccata
+			continue
+		}
+		resp := response.(*graphql.Response)
+		if first && resp.Data == nil && len(resp.Errors) > 0 {
+			// Un'operazione non valida riceve un error al posto di next e complete
+			payload, _ := json.Marshal(resp.Errors)
+			w.finish(id, schemas.GraphQLWSMessage{ID: id, Type: schemas.GraphQLWSError, Payload: payload})
+			return
+		}
+		first = false
+		payload, _ := json.Marshal(resp)
+		w.mu.Lock()
+		w.enqueue(schemas.GraphQLWSMessage{ID: id, Type: schemas.GraphQLWSNext, Payload: payload})
+		w.mu.Unlock()
+	}
+	w.finish(id, schemas.GraphQLWSMessage{ID: id, Type: schemas.GraphQLWSComplete})
+}
+
+// finish invia l'ultimo messaggio dell'operazione, se il client non l'ha già completata
+func (w *graphqlWSConn) finish(id string, msg schemas.GraphQLWSMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if cancel, found := w.operations[id]; found {
+		cancel()
+		delete(w.operations, id)
+		w.enqueue(msg)
+	}
+}
+
+func (w *graphqlWSConn) enqueue(msg schemas.GraphQLWSMessage) {
+	select {
+	case w.send <- msg:
+	case <-w.done:
+	default:
+		// Il client non sta al passo: la connessione viene chiusa e dovrà riconnettersi
+		w.close()
+	}
+}
+
+// closeWith chiude la connessione con uno dei codici del protocollo
+func (w *graphqlWSConn) closeWith(code int, reason string) {
+	w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+	w.close()
+}
+
+func (w *graphqlWSConn) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.conn.Close()
+	})
+}
+
+// writeLoop è l'unica goroutine che scrive i messaggi sulla connessione
+func (w *graphqlWSConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	defer w.close()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case msg := <-w.send:
+			w.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := w.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"gin-try/proto/itemspb"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain identifica gli errori di questo servizio nei dettagli ErrorInfo
+const grpcErrorDomain = "items.v1"
+
+// NewGRPCServer restituisce un server gRPC con ItemService e la reflection, per
+// poter usare client come grpcurl senza il file .proto
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	itemspb.RegisterItemServiceServer(server, &itemServer{})
+	reflection.Register(server)
+	return server
+}
+
+// itemServer implementa ItemService con le stesse funzioni degli handler REST
+type itemServer struct {
+	itemspb.UnimplementedItemServiceServer
+}
+
+// grpcContext costruisce il gin.Context richiesto dalle funzioni condivise con
+// gli handler REST: i metadata della chiamata (accept-language, x-actor) diventano
+// gli header della richiesta
+func grpcContext(ctx context.Context) *gin.Context {
+	method, _ := grpc.Method(ctx)
+	header := http.Header{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+	}
+	return detachedContext(ctx, http.MethodPost, method, header)
+}
+
+// detachedContext costruisce un gin.Context che non risponde a nessun client, per
+// usare le funzioni condivise fuori da un handler HTTP (gRPC, job in background)
+func detachedContext(ctx context.Context, method, path string, header http.Header) *gin.Context {
+	req, _ := http.NewRequestWithContext(ctx, method, path, nil)
+	req.Header = header
+
+	c, _ := gin.CreateTestContext(&discardResponseWriter{header: http.Header{}})
+	c.Request = req
+	return c
+}
+
+// discardResponseWriter accoglie gli header scritti dalle funzioni condivise, che non vengono inviati
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+// grpcError traduce un errore in uno status gRPC con il codice del problem in
+// ErrorInfo.reason e gli errori di validazione in BadRequest
+func grpcError(c *gin.Context, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &APIError{Code: codeInternalError, Err: err}
+	}
+	if apiErr.Err != nil {
+		log.Printf("%s: %v", c.Request.URL.Path, apiErr)
+	}
+
+	message := apiErr.Detail
+	if message == "" {
+		message = localize(c, "title_"+apiErr.Code)
+	}
+	st := status.New(grpcCode(problemStatus(apiErr.Code)), message)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: apiErr.Code, Domain: grpcErrorDomain}}
+	if len(apiErr.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fe := range apiErr.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       "item." + fe.Field,
+				Description: fe.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// grpcCode sceglie il codice gRPC corrispondente allo status HTTP del problem
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
+
+func (s *itemServer) ListItems(ctx context.Context, req *itemspb.ListItemsRequest) (*itemspb.ListItemsResponse, error) {
+	c := grpcContext(ctx)
+	items, err := loadItems(nil)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	return &itemspb.ListItemsResponse{Items: toProtoItems(items)}, nil
+}
+
+func (s *itemServer) GetItem(ctx context.Context, req *itemspb.GetItemRequest) (*itemspb.Item, error) {
+	c := grpcContext(ctx)
+	item, err := loadItem(c, strconv.FormatInt(req.GetId(), 10), nil)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	return toProtoItem(*item), nil
+}
+
+func (s *itemServer) SearchItems(ctx context.Context, req *itemspb.SearchItemsRequest) (*itemspb.ListItemsResponse, error) {
+	c := grpcContext(ctx)
+	if req.GetName() == "" {
+		return nil, grpcError(c, &APIError{Code: codeMissingParameter, Detail: localize(c, msgMissingName)})
+	}
+	items, err := searchItems(req.GetName(), nil)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	return &itemspb.ListItemsResponse{Items: toProtoItems(items)}, nil
+}
+
+func (s *itemServer) CreateItem(ctx context.Context, req *itemspb.CreateItemRequest) (*itemspb.Item, error) {
+	c := grpcContext(ctx)
+	newItem, err := fromProtoInput(c, req.GetItem(), 0)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	created, err := createItem(c, newItem)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	return toProtoItem(*created), nil
+}
+
+func (s *itemServer) UpdateItem(ctx context.Context, req *itemspb.UpdateItemRequest) (*itemspb.Item, error) {
+	c := grpcContext(ctx)
+	updatedItem, err := fromProtoInput(c, req.GetItem(), int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	updated, err := updateItem(c, strconv.FormatInt(req.GetId(), 10), updatedItem)
+	if err != nil {
+		return nil, grpcError(c, err)
+	}
+	return toProtoItem(*updated), nil
+}
+
+func (s *itemServer) DeleteItem(ctx context.Context, req *itemspb.DeleteItemRequest) (*emptypb.Empty, error) {
+	c := grpcContext(ctx)
+	if err := deleteItem(c, strconv.FormatInt(req.GetId(), 10)); err != nil {
+		return nil, grpcError(c, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *itemServer) WatchItems(req *itemspb.WatchItemsRequest, stream itemspb.ItemService_WatchItemsServer) error {
+	c := grpcContext(stream.Context())
+	if req.GetItemId() < 0 {
+		return grpcError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidItemID, "item_id")})
+	}
+	if req.GetItemId() != 0 && req.GetSearch() != "" {
+		return grpcError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidSubscription)})
+	}
+
+	watcher := &grpcWatcher{
+		filter:   itemFilter{itemID: int(req.GetItemId()), search: req.GetSearch()},
+		events:   make(chan schemas.ItemEvent, subscriberBuffer),
+		overflow: make(chan struct{}),
+	}
+	subscribers.add(watcher)
+	defer subscribers.remove(watcher)
+
+	// Gli header inviati subito dicono al client che il watch è attivo
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-watcher.overflow:
+			return status.Error(codes.ResourceExhausted, localize(c, msgSlowConsumer))
+		case event := <-watcher.events:
+			if err := stream.Send(toProtoEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcWatcher riceve dall'hub le modifiche per una chiamata WatchItems
+type grpcWatcher struct {
+	filter       itemFilter
+	events       chan schemas.ItemEvent
+	overflow     chan struct{}
+	overflowOnce sync.Once
+}
+
+func (w *grpcWatcher) deliver(change itemChange) {
+	if !w.filter.matches(change) {
+		return
+	}
+	select {
+	case w.events <- change.Event:
+	default:
+		// Il client non sta al passo: lo stream viene chiuso e dovrà ricaricare gli items
+		w.overflowOnce.Do(func() { close(w.overflow) })
+	}
+}
+
+// fromProtoInput converte l'input e lo valida con le stesse regole del body REST
+func fromProtoInput(c *gin.Context, in *itemspb.ItemInput, excludeID int) (schemas.Item, error) {
+	item := schemas.Item{
+		Name:        in.GetName(),
+		Description: in.GetDescription(),
+		Tags:        in.GetTags(),
+		Quantity:    int(in.GetQuantity()),
+		CategoryID:  int(in.GetCategoryId()),
+	}
+
+	var inputErrors []schemas.FieldError
+	if in.GetPrice() != "" {
+		var err error
+		if item.Price, err = schemas.ParsePrice(in.GetPrice()); err != nil {
+			inputErrors = append(inputErrors, invalidPrice(c))
+		}
+	}
+	return item, validateItem(c, &item, excludeID, inputErrors)
+}
+
+func toProtoItem(item schemas.Item) *itemspb.Item {
+	return &itemspb.Item{
+		Id:          int64(item.ID),
+		Name:        item.Name,
+		Description: item.Description,
+		Tags:        item.Tags,
+		Price:       item.Price.String(),
+		Quantity:    int64(item.Quantity),
+		CategoryId:  int64(item.CategoryID),
+		CreatedAt:   timestamppb.New(item.CreatedAt),
+		UpdatedAt:   timestamppb.New(item.UpdatedAt),
+	}
+}
+
+func toProtoItems(items []schemas.Item) []*itemspb.Item {
+	protoItems := make([]*itemspb.Item, 0, len(items))
+	for _, item := range items {
+		protoItems = append(protoItems, toProtoItem(item))
+	}
+	return protoItems
+}
+
+var protoEventTypes = map[string]itemspb.ItemEventType{
+	schemas.EventCreated: itemspb.ItemEventType_ITEM_EVENT_TYPE_CREATED,
+	schemas.EventUpdated: itemspb.ItemEventType_ITEM_EVENT_TYPE_UPDATED,
+	schemas.EventDeleted: itemspb.ItemEventType_ITEM_EVENT_TYPE_DELETED,
+}
+
+func toProtoEvent(event schemas.ItemEvent) *itemspb.ItemEvent {
+	protoEvent := &itemspb.ItemEvent{
+		Id:     event.ID,
+		Type:   protoEventTypes[event.Type],
+		ItemId: int64(event.ItemID),
+		At:     timestamppb.New(event.At),
+	}
+	if event.Item != nil {
+		protoEvent.Item = toProtoItem(*event.Item)
+	}
+	return protoEvent
+}
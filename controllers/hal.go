@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/json"
+	"gin-try/schemas"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pageKey = "page"
+	// defaultPerPage e maxPerPage valgono quando la richiesta indica page o per_page
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// pageInfo descrive la pagina di una lista; senza page e per_page la lista è una sola pagina
+type pageInfo struct {
+	page      int
+	perPage   int
+	total     int
+	paginated bool
+}
+
+func (p pageInfo) lastPage() int {
+	if p.perPage == 0 || p.total == 0 {
+		return 1
+	}
+	return (p.total + p.perPage - 1) / p.perPage
+}
+
+// paginate restituisce la pagina di items indicata da page e per_page, tutti gli
+// items se mancano entrambi. Il totale va in X-Total-Count e i link alle altre
+// pagine nell'header Link, in tutti i formati.
+func paginate(c *gin.Context, items []schemas.Item) ([]schemas.Item, error) {
+	info := pageInfo{page: 1, perPage: len(items), total: len(items)}
+	if c.Query("page") == "" && c.Query("per_page") == "" {
+		c.Set(pageKey, info)
+		return items, nil
+	}
+
+	info.paginated = true
+	info.perPage = defaultPerPage
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return nil, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidItemID, "page")}
+		}
+		info.page = page
+	}
+	if value := c.Query("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return nil, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidPerPage, "per_page", strconv.Itoa(maxPerPage))}
+		}
+		info.perPage = perPage
+	}
+	c.Set(pageKey, info)
+
+	c.Header("X-Total-Count", strconv.Itoa(info.total))
+	for _, link := range pageLinks(c, info) {
+		c.Writer.Header().Add("Link", "<"+link.value.(halLink).Href+`>; rel="`+link.key+`"`)
+	}
+
+	start := min((info.page-1)*info.perPage, info.total)
+	end := min(start+info.perPage, info.total)
+	return items[start:end], nil
+}
+
+// pageLinks restituisce i link first, prev, next e last della lista richiesta
+func pageLinks(c *gin.Context, info pageInfo) orderedObject {
+	links := orderedObject{{"first", pageLink(c, info, 1)}}
+	if info.page > 1 {
+		links = append(links, orderedField{"prev", pageLink(c, info, min(info.page-1, info.lastPage()))})
+	}
+	if info.page < info.lastPage() {
+		links = append(links, orderedField{"next", pageLink(c, info, info.page+1)})
+	}
+	return append(links, orderedField{"last", pageLink(c, info, info.lastPage())})
+}
+
+// pageLink è l'URL della richiesta con la pagina indicata, senza page se la lista non è paginata
+func pageLink(c *gin.Context, info pageInfo, page int) halLink {
+	query := url.Values{}
+	for key, values := range c.Request.URL.Query() {
+		query[key] = values
+	}
+	if info.paginated {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(info.perPage))
+	}
+
+	href := c.Request.URL.Path
+	if encoded := query.Encode(); encoded != "" {
+		href += "?" + encoded
+	}
+	return halLink{Href: href}
+}
+
+// halLink è un link HAL
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// toHAL aggiunge i link HAL agli items: _links con le azioni possibili per un item,
+// _embedded e i link alle pagine per una lista. Gli altri valori restano invariati.
+func toHAL(c *gin.Context, obj any) any {
+	switch v := obj.(type) {
+	case schemas.Item:
+		return halItem(c, v)
+	case *schemas.Item:
+		if v != nil {
+			return halItem(c, *v)
+		}
+	case []schemas.Item:
+		return halCollection(c, v)
+	}
+	return versioned(c, obj)
+}
+
+func halItem(c *gin.Context, item schemas.Item) orderedObject {
+	data, _ := json.Marshal(versioned(c, item))
+	value, _ := decodeOrdered(data)
+	resource, _ := project(c, value).(orderedObject)
+	return append(resource, orderedField{"_links", itemLinks(c, item)})
+}
+
+// itemLinks sono i link di un item: edit accetta PUT e DELETE; un item nel cestino
+// non ha un URL proprio e può solo essere ripristinato
+func itemLinks(c *gin.Context, item schemas.Item) orderedObject {
+	itemPath := apiPath(c, "/items/"+strconv.Itoa(item.ID))
+	if item.DeletedAt != nil {
+		return orderedObject{
+			{"collection", halLink{apiPath(c, "/items/trash")}},
+			{"restore", halLink{itemPath + "/restore"}},
+			{"history", halLink{itemPath + "/history"}},
+		}
+	}
+
+	links := orderedObject{
+		{"self", halLink{itemPath}},
+		{"collection", halLink{apiPath(c, "/items")}},
+		{"edit", halLink{itemPath}},
+		{"history", halLink{itemPath + "/history"}},
+		{"attachments", halLink{itemPath + "/attachments"}},
+	}
+	if item.CategoryID != 0 {
+		links = append(links, orderedField{"category", halLink{apiPath(c, "/categories/"+strconv.Itoa(item.CategoryID))}})
+	}
+	return links
+}
+
+func halCollection(c *gin.Context, items []schemas.Item) orderedObject {
+	info, ok := c.Value(pageKey).(pageInfo)
+	if !ok {
+		info = pageInfo{page: 1, perPage: len(items), total: len(items)}
+	}
+
+	embedded := make([]any, 0, len(items))
+	for _, item := range items {
+		embedded = append(embedded, halItem(c, item))
+	}
+	links := append(orderedObject{{"self", pageLink(c, info, info.page)}}, pageLinks(c, info)...)
+	return orderedObject{
+		{"_links", links},
+		{"_embedded", orderedObject{{"items", embedded}}},
+		{"count", len(items)},
+		{"total", info.total},
+		{"page", info.page},
+		{"per_page", info.perPage},
+	}
+}
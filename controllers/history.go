@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+const (
+	actorHeader  = "X-Actor"
+	defaultActor = "anonymous"
+	// Lo storico di ogni item è un sorted set in Redis con il numero di revisione
+	// come score, così sopravvive ai riavvii ed è condiviso da tutte le repliche
+	historyPrefix = "history:"
+)
+
+func historyKey(itemID int) string {
+	return historyPrefix + strconv.Itoa(itemID)
+}
+
+// SetHistory sostituisce lo storico di tutti gli items
+func SetHistory(history map[int][]schemas.Revision) {
+	var keys []string
+	iter := rdb.Scan(0, historyPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) > 0 {
+		rdb.Del(keys...)
+	}
+
+	for itemID, revisions := range history {
+		for _, revision := range revisions {
+			data, _ := json.Marshal(revision)
+			rdb.ZAdd(historyKey(itemID), redis.Z{Score: float64(revision.Revision), Member: data})
+		}
+		rdb.Set(historyKey(itemID)+":revision", len(revisions), 0)
+	}
+}
+
+// @Summary Get the history of an item
+// @Description Retrieve every revision of an item, oldest first, including the revisions recorded before it was deleted
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Item ID"
+// @Success 200 {array} schemas.Revision
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Router /items/{id}/history [get]
+func GetItemHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	revisions := getHistoryFromSource(parseItemID(id))
+	if len(revisions) == 0 && getItemFromSourceByID(id) == nil && getTrashedItemFromSource(id) == nil {
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+		return
+	}
+
+	render(c, http.StatusOK, revisions)
+}
+
+// @Summary Revert an item to a revision
+// @Description Bring an item back to the state recorded after the given revision. A deleted item is restored as part of the revert
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Item ID"
+// @Param revision path int true "Revision number"
+// @Param X-Actor header string false "Who is performing the change"
+// @Success 200 {object} schemas.Item
+// @Failure 404 {object} schemas.Problem "item_not_found, revision_not_found"
+// @Failure 409 {object} schemas.Problem "item_name_conflict"
+// @Failure 422 {object} schemas.Problem "revision_not_revertible"
+// @Router /items/{id}/history/{revision}/revert [post]
+func RevertItem(c *gin.Context) {
+	id := c.Param("id")
+
+	revision := getRevisionFromSource(parseItemID(id), c.Param("revision"))
+	if revision == nil {
+		abortWithError(c, &APIError{Code: codeRevisionNotFound, Detail: localize(c, msgRevisionNotFound)})
+		return
+	}
+	if revision.After == nil {
+		abortWithError(c, &APIError{Code: codeRevisionNotRevertible, Detail: localize(c, msgRevisionNotRevertible)})
+		return
+	}
+
+	current := getItemFromSourceByID(id)
+	if current == nil {
+		current = getTrashedItemFromSource(id)
+	}
+	if current == nil {
+		// L'item è già stato eliminato definitivamente dal cestino
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)})
+		return
+	}
+
+	reverted := *revision.After
+	if itemNameTaken(reverted.Name, reverted.ID) {
+		abortWithError(c, &APIError{Code: codeItemNameConflict, Detail: localize(c, msgRestoreNameTaken, reverted.Name)})
+		return
+	}
+	if reverted.CategoryID != 0 && getCategoryFromSourceByID(strconv.Itoa(reverted.CategoryID)) == nil {
+		reverted.CategoryID = 0
+	}
+	reverted.CreatedAt = current.CreatedAt
+	reverted.UpdatedAt = time.Now().UTC()
+	reverted.DeletedAt = nil
+	if err := restoreItemInSource(reverted); errors.Is(err, repository.ErrNameTaken) {
+		abortWithError(c, &APIError{Code: codeItemNameConflict, Detail: localize(c, msgRestoreNameTaken, reverted.Name)})
+		return
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+		return
+	}
+
+	// Invalida la cache dell'item, di tutti gli items e delle categorie coinvolte
+	rdb.Del(itemCacheKeys(id, "all")...)
+	invalidateCategoryItems(current.CategoryID, reverted.CategoryID)
+
+	recordRevision(c, schemas.ActionRevert, current, &reverted, revision.Revision)
+
+	render(c, http.StatusOK, reverted)
+}
+
+// recordRevision aggiunge una revisione immutabile allo storico dell'item
+func recordRevision(c *gin.Context, action string, before, after *schemas.Item, revertedTo ...int) {
+	actor := c.GetHeader(actorHeader)
+	if actor == "" {
+		actor = defaultActor
+	}
+
+	itemID := 0
+	if after != nil {
+		itemID = after.ID
+	} else if before != nil {
+		itemID = before.ID
+	}
+
+	revision := schemas.Revision{
+		ItemID:    itemID,
+		Action:    action,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Before:    copyItem(before),
+		After:     copyItem(after),
+		Changes:   diffItems(before, after),
+	}
+	if len(revertedTo) > 0 {
+		revision.RevertedTo = revertedTo[0]
+	}
+
+	saveRevisionToSource(revision)
+	publishItemEvent(action, before, after)
+}
+
+// copyItem evita che lo storico condivida slice con la sorgente dati
+func copyItem(item *schemas.Item) *schemas.Item {
+	if item == nil {
+		return nil
+	}
+	copied := *item
+	copied.Tags = append([]string{}, item.Tags...)
+	copied.DeletedAt = nil
+	return &copied
+}
+
+// diffItems confronta i campi JSON dei due stati; i timestamp gestiti dal server non sono considerati
+func diffItems(before, after *schemas.Item) []schemas.FieldChange {
+	beforeFields := itemFields(before)
+	afterFields := itemFields(after)
+
+	var names []string
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []schemas.FieldChange{}
+	for _, name := range names {
+		if name == "created_at" || name == "updated_at" || name == "deleted_at" {
+			continue
+		}
+		if !reflect.DeepEqual(beforeFields[name], afterFields[name]) {
+			changes = append(changes, schemas.FieldChange{Field: name, Before: beforeFields[name], After: afterFields[name]})
+		}
+	}
+	return changes
+}
+
+func itemFields(item *schemas.Item) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if item == nil {
+		return fields
+	}
+	data, _ := json.Marshal(item)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// Funzioni per interagire con lo storico della sorgente dati
+func getHistoryFromSource(itemID int) []schemas.Revision {
+	values, err := rdb.ZRange(historyKey(itemID), 0, -1).Result()
+	if err != nil {
+		log.Printf("storico dell'item %d: %v", itemID, err)
+	}
+	return decodeRevisions(values)
+}
+
+func getRevisionFromSource(itemID int, revision string) *schemas.Revision {
+	if _, err := strconv.Atoi(revision); err != nil {
+		return nil
+	}
+	values, _ := rdb.ZRangeByScore(historyKey(itemID), redis.ZRangeBy{Min: revision, Max: revision}).Result()
+	if revisions := decodeRevisions(values); len(revisions) > 0 {
+		return &revisions[0]
+	}
+	return nil
+}
+
+func decodeRevisions(values []string) []schemas.Revision {
+	revisions := []schemas.Revision{}
+	for _, value := range values {
+		var revision schemas.Revision
+		if err := json.Unmarshal([]byte(value), &revision); err == nil {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions
+}
+
+// saveRevisionToSource numera la revisione con un contatore per item, atomico
+// anche tra repliche diverse, e la aggiunge allo storico senza scadenza
+func saveRevisionToSource(revision schemas.Revision) {
+	key := historyKey(revision.ItemID)
+	number, err := rdb.Incr(key + ":revision").Result()
+	if err == nil {
+		revision.Revision = int(number)
+		data, _ := json.Marshal(revision)
+		err = rdb.ZAdd(key, redis.Z{Score: float64(number), Member: data}).Err()
+	}
+	if err != nil {
+		log.Printf("storico dell'item %d: %v", revision.ItemID, err)
+	}
+}
@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/it"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	it_translations "github.com/go-playground/validator/v10/translations/it"
+)
+
+// Chiavi dei messaggi restituiti dagli handler
+const (
+	msgItemNotFound          = "item_not_found"
+	msgMissingName           = "missing_name"
+	msgInvalidAsOf           = "invalid_as_of"
+	msgAsOfTrimmed           = "as_of_trimmed"
+	msgInvalidLastEventID    = "invalid_last_event_id"
+	msgMalformedMessage      = "malformed_message"
+	msgUnknownMessageType    = "unknown_message_type"
+	msgMissingSubscriptionID = "missing_subscription_id"
+	msgInvalidSubscription   = "invalid_subscription"
+	msgInvalidItemID         = "invalid_item_id"
+	msgInvalidCursor         = "invalid_cursor"
+	msgInvalidPageSize       = "invalid_page_size"
+	msgInvalidPerPage        = "invalid_per_page"
+	msgInvalidPrice          = "invalid_price"
+	msgSlowConsumer          = "slow_consumer"
+	msgValidationFailed      = "validation_failed"
+	msgIDMismatch            = "id_mismatch"
+	msgNameTaken             = "name_taken"
+	msgItemNotInTrash        = "item_not_in_trash"
+	msgRestoreNameTaken      = "restore_name_taken"
+	msgRevisionNotFound      = "revision_not_found"
+	msgRevisionNotRevertible = "revision_not_revertible"
+	msgMissingFile           = "missing_file"
+	msgUnsupportedAttachment = "unsupported_attachment"
+	msgUnsupportedBody       = "unsupported_body"
+	msgNotAcceptable         = "not_acceptable"
+	msgAttachmentTooLarge    = "attachment_too_large"
+	msgAttachmentNotFound    = "attachment_not_found"
+	msgCategoryNotFound      = "category_not_found"
+	msgCategoryNameTaken     = "category_name_taken"
+	msgCategoryNotEmpty      = "category_not_empty"
+	msgUnknownCategory       = "unknown_category"
+	msgWebhookNotFound       = "webhook_not_found"
+	msgPrivateWebhookURL     = "private_webhook_url"
+	msgImportNotFound        = "import_not_found"
+	msgImportTooLarge        = "import_too_large"
+	msgJobNotFound           = "job_not_found"
+	msgJobFinished           = "job_finished"
+	msgInvalidBoolean        = "invalid_boolean"
+	msgInvalidFormat         = "invalid_format"
+	msgIdempotencyExpired    = "idempotency_expired"
+	msgIdempotencyMismatch   = "idempotency_mismatch"
+	msgIdempotencyInProgress = "idempotency_in_progress"
+)
+
+// messageCatalogs contiene i messaggi per ogni lingua supportata; l'inglese è il fallback
+var messageCatalogs = map[string]map[string]string{
+	"en": {
+		msgItemNotFound:          "Item not found",
+		msgMissingName:           "Missing name query parameter",
+		msgInvalidAsOf:           "as_of must be an RFC3339 timestamp that is not in the future",
+		msgAsOfTrimmed:           "as_of is older than the history kept in memory; the event log store (ITEM_STORE=eventlog) keeps it all",
+		msgInvalidLastEventID:    "Last-Event-ID must be a non-negative integer",
+		msgMalformedMessage:      "Messages must be JSON objects",
+		msgUnknownMessageType:    "{0} is not a known message type",
+		msgMissingSubscriptionID: "Missing subscription id",
+		msgInvalidSubscription:   "A subscription can filter by item_id or by search, not both",
+		msgInvalidItemID:         "{0} must be a positive integer",
+		msgInvalidCursor:         "{0} is not a valid cursor",
+		msgInvalidPageSize:       "{0} must be between 0 and {1}",
+		msgInvalidPerPage:        "{0} must be between 1 and {1}",
+		msgInvalidPrice:          "{0} must be a decimal number with at most 2 decimal places",
+		msgSlowConsumer:          "The client is not keeping up with the changes, watch again and reload the items",
+		msgValidationFailed:      "One or more fields are not valid",
+		msgIDMismatch:            "{0} must match the item in the URL",
+		msgNameTaken:             "{0} is already used by another item",
+		msgItemNotInTrash:        "Item not found in the trash",
+		msgRestoreNameTaken:      "Another item is already named {0}, rename it before restoring",
+		msgRevisionNotFound:      "Revision not found",
+		msgRevisionNotRevertible: "A deletion cannot be reverted to, use the restore endpoint or pick an earlier revision",
+		msgMissingFile:           "The multipart form must contain a file field",
+		msgUnsupportedAttachment: "Files of type {0} cannot be attached",
+		msgUnsupportedBody:       "Request bodies of type {0} are not supported, use one of: {1}",
+		msgNotAcceptable:         "None of the formats in Accept is available, use one of: {0}",
+		msgAttachmentTooLarge:    "Attachments can be at most {0} bytes",
+		msgAttachmentNotFound:    "Attachment not found",
+		msgCategoryNotFound:      "Category not found",
+		msgCategoryNameTaken:     "{0} is already used by another category",
+		msgCategoryNotEmpty:      "The category still contains {0} items",
+		msgUnknownCategory:       "{0} does not refer to an existing category",
+		msgWebhookNotFound:       "Webhook not found",
+		msgPrivateWebhookURL:     "{0} must not point to a loopback, private or link-local address",
+		msgImportNotFound:        "Import not found",
+		msgImportTooLarge:        "Imports can be at most {0} bytes",
+		msgJobNotFound:           "Job not found",
+		msgJobFinished:           "The job is already {0}",
+		msgInvalidBoolean:        "{0} must be true or false",
+		msgInvalidFormat:         "{0} must be one of: {1}",
+		msgIdempotencyExpired:    "Idempotency key expired, retry the request",
+		msgIdempotencyMismatch:   "Idempotency key already used with a different request body",
+		msgIdempotencyInProgress: "A request with this idempotency key is still in progress",
+
+		"title_" + codeItemNotFound:          "Item not found",
+		"title_" + codeItemNameConflict:      "Item name conflict",
+		"title_" + codeRevisionNotFound:      "Revision not found",
+		"title_" + codeRevisionNotRevertible: "Revision not revertible",
+		"title_" + codeAttachmentNotFound:    "Attachment not found",
+		"title_" + codeAttachmentTooLarge:    "Attachment too large",
+		"title_" + codeUnsupportedMediaType:  "Unsupported media type",
+		"title_" + codeNotAcceptable:         "Not acceptable",
+		"title_" + codeCategoryNotFound:      "Category not found",
+		"title_" + codeCategoryNotEmpty:      "Category not empty",
+		"title_" + codeWebhookNotFound:       "Webhook not found",
+		"title_" + codeImportNotFound:        "Import not found",
+		"title_" + codeImportTooLarge:        "Import too large",
+		"title_" + codeJobNotFound:           "Job not found",
+		"title_" + codeJobFinished:           "Job already finished",
+		"title_" + codeRouteNotFound:         "Route not found",
+		"title_" + codeMissingParameter:      "Missing parameter",
+		"title_" + codeInvalidParameter:      "Invalid parameter",
+		"title_" + codeMalformedBody:         "Malformed request body",
+		"title_" + codeValidationFailed:      "Validation failed",
+		"title_" + codeIdempotencyKeyReused:  "Idempotency key reused",
+		"title_" + codeIdempotencyInProgress: "Request in progress",
+		"title_" + codeIdempotencyKeyExpired: "Idempotency key expired",
+		"title_" + codeCacheError:            "Cache error",
+		"title_" + codeStorageError:          "Storage error",
+		"title_" + codeInternalError:         "Internal server error",
+	},
+	"it": {
+		msgItemNotFound:          "Item non trovato",
+		msgMissingName:           "Parametro di query name mancante",
+		msgInvalidAsOf:           "as_of deve essere un timestamp RFC3339 non futuro",
+		msgAsOfTrimmed:           "as_of precede la storia conservata in memoria; il log degli eventi (ITEM_STORE=eventlog) la conserva tutta",
+		msgInvalidLastEventID:    "Last-Event-ID deve essere un intero non negativo",
+		msgMalformedMessage:      "I messaggi devono essere oggetti JSON",
+		msgUnknownMessageType:    "{0} non è un tipo di messaggio valido",
+		msgMissingSubscriptionID: "Id della sottoscrizione mancante",
+		msgInvalidSubscription:   "Una sottoscrizione può filtrare per item_id o per search, non per entrambi",
+		msgInvalidItemID:         "{0} deve essere un intero positivo",
+		msgInvalidCursor:         "{0} non è un cursore valido",
+		msgInvalidPageSize:       "{0} deve essere compreso tra 0 e {1}",
+		msgInvalidPerPage:        "{0} deve essere compreso tra 1 e {1}",
+		msgInvalidPrice:          "{0} deve essere un numero decimale con al massimo 2 cifre decimali",
+		msgSlowConsumer:          "Il client non sta al passo con le modifiche, riavvia il watch e ricarica gli items",
+		msgValidationFailed:      "Uno o più campi non sono validi",
+		msgIDMismatch:            "{0} deve coincidere con l'item indicato nell'URL",
+		msgNameTaken:             "{0} è già usato da un altro item",
+		msgItemNotInTrash:        "Item non trovato nel cestino",
+		msgRestoreNameTaken:      "Un altro item si chiama già {0}, rinominalo prima del ripristino",
+		msgRevisionNotFound:      "Revisione non trovata",
+		msgRevisionNotRevertible: "Non è possibile tornare a un'eliminazione, usa il ripristino o scegli una revisione precedente",
+		msgMissingFile:           "Il form multipart deve contenere il campo file",
+		msgUnsupportedAttachment: "I file di tipo {0} non possono essere allegati",
+		msgUnsupportedBody:       "I body di tipo {0} non sono supportati, usa uno tra: {1}",
+		msgNotAcceptable:         "Nessuno dei formati in Accept è disponibile, usa uno tra: {0}",
+		msgAttachmentTooLarge:    "Gli allegati possono essere al massimo di {0} byte",
+		msgAttachmentNotFound:    "Allegato non trovato",
+		msgCategoryNotFound:      "Categoria non trovata",
+		msgCategoryNameTaken:     "{0} è già usato da un'altra categoria",
+		msgCategoryNotEmpty:      "La categoria contiene ancora {0} items",
+		msgUnknownCategory:       "{0} non corrisponde a nessuna categoria",
+		msgWebhookNotFound:       "Webhook non trovato",
+		msgPrivateWebhookURL:     "{0} non può puntare a un indirizzo di loopback, privato o link-local",
+		msgImportNotFound:        "Import non trovato",
+		msgImportTooLarge:        "Gli import possono essere al massimo di {0} byte",
+		msgJobNotFound:           "Job non trovato",
+		msgJobFinished:           "Il job è già nello stato {0}",
+		msgInvalidBoolean:        "{0} deve essere true o false",
+		msgInvalidFormat:         "{0} deve essere uno tra: {1}",
+		msgIdempotencyExpired:    "Idempotency key scaduta, ripeti la richiesta",
+		msgIdempotencyMismatch:   "Idempotency key già usata con un body diverso",
+		msgIdempotencyInProgress: "Una richiesta con questa idempotency key è ancora in corso",
+
+		"title_" + codeItemNotFound:          "Item non trovato",
+		"title_" + codeItemNameConflict:      "Conflitto sul nome dell'item",
+		"title_" + codeRevisionNotFound:      "Revisione non trovata",
+		"title_" + codeRevisionNotRevertible: "Revisione non ripristinabile",
+		"title_" + codeAttachmentNotFound:    "Allegato non trovato",
+		"title_" + codeAttachmentTooLarge:    "Allegato troppo grande",
+		"title_" + codeUnsupportedMediaType:  "Tipo di file non supportato",
+		"title_" + codeNotAcceptable:         "Formato non disponibile",
+		"title_" + codeCategoryNotFound:      "Categoria non trovata",
+		"title_" + codeCategoryNotEmpty:      "Categoria non vuota",
+		"title_" + codeWebhookNotFound:       "Webhook non trovato",
+		"title_" + codeImportNotFound:        "Import non trovato",
+		"title_" + codeImportTooLarge:        "Import troppo grande",
+		"title_" + codeJobNotFound:           "Job non trovato",
+		"title_" + codeJobFinished:           "Job già concluso",
+		"title_" + codeRouteNotFound:         "Rotta non trovata",
+		"title_" + codeMissingParameter:      "Parametro mancante",
+		"title_" + codeInvalidParameter:      "Parametro non valido",
+		"title_" + codeMalformedBody:         "Body della richiesta non valido",
+		"title_" + codeValidationFailed:      "Validazione non riuscita",
+		"title_" + codeIdempotencyKeyReused:  "Idempotency key riutilizzata",
+		"title_" + codeIdempotencyInProgress: "Richiesta in corso",
+		"title_" + codeIdempotencyKeyExpired: "Idempotency key scaduta",
+		"title_" + codeCacheError:            "Errore della cache",
+		"title_" + codeStorageError:          "Errore di salvataggio",
+		"title_" + codeInternalError:         "Errore interno del server",
+	},
+}
+
+// validationCatalogs contiene i messaggi delle regole di validazione personalizzate
+var validationCatalogs = map[string]map[string]string{
+	"en": {
+		"itemname": "{0} may only contain letters, digits, spaces and _ . , ' ( ) & -",
+		"http_url": "{0} must be an http or https URL",
+	},
+	"it": {
+		"itemname": "{0} può contenere solo lettere, cifre, spazi e _ . , ' ( ) & -",
+		"http_url": "{0} deve essere un URL http o https",
+	},
+}
+
+var uni = ut.New(en.New(), en.New(), it.New())
+
+// registerTranslations carica i cataloghi e le traduzioni del validator per ogni lingua
+func registerTranslations(v *validator.Validate) {
+	register := map[string]func(*validator.Validate, ut.Translator) error{
+		"en": en_translations.RegisterDefaultTranslations,
+		"it": it_translations.RegisterDefaultTranslations,
+	}
+
+	for locale, registerDefaults := range register {
+		trans, _ := uni.GetTranslator(locale)
+		if err := registerDefaults(v, trans); err != nil {
+			panic(err)
+		}
+		for key, text := range messageCatalogs[locale] {
+			if err := trans.Add(key, text, true); err != nil {
+				panic(err)
+			}
+		}
+		for tag, text := range validationCatalogs[locale] {
+			text := text
+			err := v.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+				return trans.Add(tag, text, true)
+			}, func(trans ut.Translator, fe validator.FieldError) string {
+				msg, _ := trans.T(fe.Tag(), fe.Field())
+				return msg
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// translatorFor sceglie la lingua della risposta in base all'header Accept-Language
+func translatorFor(c *gin.Context) ut.Translator {
+	trans, _ := uni.FindTranslator(acceptedLocales(c.GetHeader("Accept-Language"))...)
+	c.Header("Content-Language", trans.Locale())
+	return trans
+}
+
+// localize restituisce il messaggio con la chiave indicata nella lingua del client
+func localize(c *gin.Context, key string, params ...string) string {
+	msg, err := translatorFor(c).T(key, params...)
+	if err != nil {
+		return key
+	}
+	return msg
+}
+
+// acceptedLocales ordina le lingue di Accept-Language per peso (es. "it-IT,it;q=0.9,en;q=0.8")
+func acceptedLocales(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	var locales []string
+	for _, lang := range langs {
+		// "it-IT" viene provato come "it_IT" e poi come "it"
+		locale := strings.ReplaceAll(lang.locale, "-", "_")
+		locales = append(locales, locale)
+		if base, _, found := strings.Cut(locale, "_"); found {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
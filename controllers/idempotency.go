@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	idempotencyPrefix = "idempotency:"
+)
+
+var idempotencyWindow = 24 * time.Hour
+
+// idempotencyLease è per quanto tempo una richiesta in corso tiene prenotata la
+// sua chiave: se l'handler va in panic o il processo si ferma, la chiave torna
+// libera dopo il lease invece che dopo l'intera finestra
+var idempotencyLease = time.Minute
+
+// idempotencyRecord è ciò che viene salvato in Redis per ogni Idempotency-Key
+type idempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	Completed   bool   `json:"completed"`
+}
+
+// SetIdempotencyWindow imposta per quanto tempo una Idempotency-Key viene ricordata
+func SetIdempotencyWindow(window time.Duration) {
+	if window > 0 {
+		idempotencyWindow = window
+	}
+}
+
+// SetIdempotencyLease imposta per quanto tempo una richiesta in corso tiene
+// prenotata la sua chiave; deve superare la durata della richiesta più lenta
+func SetIdempotencyLease(lease time.Duration) {
+	if lease > 0 {
+		idempotencyLease = lease
+	}
+}
+
+// responseRecorder cattura la risposta scritta dall'handler per poterla salvare
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency rende idempotenti le richieste che portano l'header Idempotency-Key:
+// un retry con lo stesso body riceve la risposta originale, un retry con un body
+// diverso riceve 422.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, &APIError{Code: codeMalformedBody, Detail: err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+		cacheKey := idempotencyPrefix + c.Request.Method + ":" + c.FullPath() + ":" + key
+
+		// Prenota la chiave per la durata del lease: solo la prima richiesta esegue
+		// l'handler, e la risposta completata viene poi ricordata per l'intera finestra
+		pending, _ := json.Marshal(idempotencyRecord{RequestHash: requestHash})
+		reserved, err := rdb.SetNX(cacheKey, pending, idempotencyLease).Result()
+		if err != nil {
+			abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+			return
+		}
+
+		if !reserved {
+			val, err := rdb.Get(cacheKey).Result()
+			if err == redis.Nil {
+				// La chiave è scaduta nel frattempo, il client può riprovare
+				abortWithError(c, &APIError{Code: codeIdempotencyKeyExpired, Detail: localize(c, msgIdempotencyExpired)})
+				return
+			} else if err != nil {
+				abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+				return
+			}
+
+			var record idempotencyRecord
+			json.Unmarshal([]byte(val), &record)
+			if record.RequestHash != requestHash {
+				abortWithError(c, &APIError{Code: codeIdempotencyKeyReused, Detail: localize(c, msgIdempotencyMismatch)})
+				return
+			}
+			if !record.Completed {
+				abortWithError(c, &APIError{Code: codeIdempotencyInProgress, Detail: localize(c, msgIdempotencyInProgress)})
+				return
+			}
+
+			// Restituisce la risposta originale
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.Status, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Le risposte di errore non vengono memorizzate, così il client può correggere e riprovare.
+		// Un handler che chiama abortWithError non ha ancora scritto nulla: la risposta la
+		// scrive ErrorHandler più tardi, quindi qui lo stato sarebbe ancora 200.
+		status := c.Writer.Status()
+		if len(c.Errors) > 0 || c.IsAborted() || status < http.StatusOK || status >= http.StatusBadRequest {
+			rdb.Del(cacheKey)
+			return
+		}
+
+		completed, _ := json.Marshal(idempotencyRecord{
+			RequestHash: requestHash,
+			Status:      status,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+			Completed:   true,
+		})
+		rdb.Set(cacheKey, completed, idempotencyWindow)
+	}
+}
@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gin-try/schemas"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+const (
+	importPrefix = "imports:"
+	// importJobTTL è per quanto tempo lo stato di un import resta consultabile
+	importJobTTL = 24 * time.Hour
+	// importProgressEvery è ogni quante righe viene salvato l'avanzamento
+	importProgressEvery = 500
+	// maxImportErrors è quante righe non valide vengono riportate nel job
+	maxImportErrors = 1000
+	// maxImportLine è la lunghezza massima di una riga NDJSON
+	maxImportLine = 1 << 20
+)
+
+// maxImportSize è la dimensione massima in byte del file di un import, che resta nel BlobStore fino alla fine del job
+var maxImportSize int64 = 100 << 20
+
+// errImportTooLarge indica un file di import oltre maxImportSize
+var errImportTooLarge = errors.New("import too large")
+
+// SetMaxImportSize imposta la dimensione massima in byte del file di un import
+func SetMaxImportSize(maxSize int64) {
+	if maxSize > 0 {
+		maxImportSize = maxSize
+	}
+}
+
+// importFormats associa i Content-Type accettati da ImportItems al formato del file
+var importFormats = map[string]string{
+	mediaCSV:             schemas.ImportCSV,
+	mediaNDJSON:          schemas.ImportNDJSON,
+	"application/ndjson": schemas.ImportNDJSON,
+}
+
+// @Summary Import items
+// @Description Create items from a CSV file (a header row, tags separated by ";") or from NDJSON (one item per line).
+// @Description The file is validated row by row by a queued job that any replica can run: rows with errors are skipped and reported in the import, whose progress is available at the Location URL.
+// @Description The job has the same ID as the import and can be canceled with POST /jobs/{id}/cancel.
+// @Accept text/csv,application/x-ndjson
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param dry_run query bool false "Validate the rows without saving them"
+// @Param X-Actor header string false "Who is performing the change"
+// @Success 202 {object} schemas.ImportJob
+// @Header 202 {string} Location "URL of the import status"
+// @Failure 400 {object} schemas.Problem "invalid_parameter, malformed_body"
+// @Failure 413 {object} schemas.Problem "import_too_large"
+// @Failure 415 {object} schemas.Problem "unsupported_media_type"
+// @Failure 500 {object} schemas.Problem "storage_error, cache_error"
+// @Router /items/import [post]
+func ImportItems(c *gin.Context) {
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			abortWithError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidBoolean, "dry_run")})
+			return
+		}
+	}
+	format, found := importFormats[c.ContentType()]
+	if !found {
+		abortWithError(c, &APIError{Code: codeUnsupportedMediaType, Detail: localize(c, msgUnsupportedBody, c.ContentType(), "text/csv, application/x-ndjson")})
+		return
+	}
+
+	tooLarge := &APIError{Code: codeImportTooLarge, Detail: localize(c, msgImportTooLarge, strconv.FormatInt(maxImportSize, 10))}
+	if c.Request.ContentLength > maxImportSize {
+		abortWithError(c, tooLarge)
+		return
+	}
+
+	// Il body viene salvato nel BlobStore invece che in memoria: il job lo legge
+	// riga per riga dopo la risposta, anche su un'altra replica
+	id := newRandomID()
+	size, err := saveImportPayload(id, c.Request.Body)
+	if err != nil {
+		blobStore.Delete(importPayloadKey(id))
+		var apiErr *APIError
+		if errors.Is(err, errImportTooLarge) {
+			apiErr = tooLarge
+		} else if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Code: codeMalformedBody, Detail: err.Error()}
+		}
+		abortWithError(c, apiErr)
+		return
+	}
+
+	job := schemas.ImportJob{
+		ID:         id,
+		Status:     schemas.ImportQueued,
+		Format:     format,
+		DryRun:     dryRun,
+		BytesTotal: size,
+		Errors:     []schemas.ImportError{},
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := saveImportJob(job); err != nil {
+		blobStore.Delete(importPayloadKey(id))
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	// Il job ha lo stesso ID dell'import: lo stato generico è anche in /jobs/{id}
+	if _, err := enqueueJob(c, id, schemas.JobImport, size); err != nil {
+		blobStore.Delete(importPayloadKey(id))
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Location", apiPath(c, "/items/import/"+job.ID))
+	render(c, http.StatusAccepted, job)
+}
+
+// @Summary Get the status of an import
+// @Description Retrieve the progress and the row errors of an import started with POST /items/import
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path string true "Import ID"
+// @Success 200 {object} schemas.ImportJob
+// @Failure 404 {object} schemas.Problem "import_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /items/import/{id} [get]
+func GetImportJob(c *gin.Context) {
+	job, err := loadImportJob(c.Param("id"))
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	if job == nil {
+		abortWithError(c, &APIError{Code: codeImportNotFound, Detail: localize(c, msgImportNotFound)})
+		return
+	}
+	render(c, http.StatusOK, job)
+}
+
+// runImportJob legge il file e aggiorna l'import; lo stato finale viene scritto da finishImportJob
+func runImportJob(c *gin.Context, run *jobRun) error {
+	job, err := loadImportJob(run.record.ID)
+	if err != nil {
+		return err
+	} else if job == nil {
+		return errors.New("import " + run.record.ID + " not found")
+	}
+	// Un import rimesso in coda dal reaper rilegge il file dall'inizio: i conteggi
+	// ripartono da zero e le righe già salvate vengono contate senza salvarle di nuovo
+	job.Status = schemas.ImportRunning
+	job.Processed, job.Imported, job.Failed, job.BytesRead = 0, 0, 0, 0
+	job.Errors = []schemas.ImportError{}
+	job.ErrorsTruncated = false
+	if err := saveImportJob(*job); err != nil {
+		return err
+	}
+
+	payload, err := blobStore.Open(importPayloadKey(job.ID))
+	if err != nil {
+		return err
+	}
+	defer payload.Close()
+
+	importer := &itemImporter{c: c, run: run, job: job, reader: &countingReader{r: payload}, names: map[string]bool{}}
+	switch job.Format {
+	case schemas.ImportCSV:
+		err = importer.readCSV()
+	case schemas.ImportNDJSON:
+		err = importer.readNDJSON()
+	}
+
+	job.BytesRead = importer.reader.n
+	if saveErr := saveImportJob(*job); saveErr != nil {
+		log.Printf("import %s: %v", job.ID, saveErr)
+	}
+	return err
+}
+
+// finishImportJob copia l'esito del job nell'import ed elimina il file
+func finishImportJob(result schemas.Job) {
+	defer blobStore.Delete(importPayloadKey(result.ID))
+	defer rdb.Del(importedLinesKey(result.ID))
+
+	job, err := loadImportJob(result.ID)
+	if err != nil || job == nil {
+		log.Printf("import %s: %v", result.ID, err)
+		return
+	}
+	job.FinishedAt = result.FinishedAt
+	switch result.Status {
+	case schemas.JobCompleted:
+		job.Status = schemas.ImportCompleted
+	case schemas.JobCanceled:
+		job.Status = schemas.ImportCanceled
+	default:
+		job.Status = schemas.ImportFailed
+		job.Error = result.Error
+	}
+	if err := saveImportJob(*job); err != nil {
+		log.Printf("import %s: %v", job.ID, err)
+	}
+}
+
+// itemImporter valida e salva le righe di un import
+type itemImporter struct {
+	c      *gin.Context
+	run    *jobRun
+	job    *schemas.ImportJob
+	reader *countingReader
+	// names sono i nomi già visti nel file, per trovare i duplicati in un dry run
+	names map[string]bool
+}
+
+// readCSV legge un'intestazione con i nomi dei campi JSON e una riga per item
+func (imp *itemImporter) readCSV() error {
+	reader := csv.NewReader(bufio.NewReader(imp.reader))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	}
+
+	itemType := reflect.TypeOf(schemas.Item{})
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// Una riga malformata non impedisce di leggere le successive
+			imp.job.Processed++
+			imp.rowFailed(parseErr.StartLine, &APIError{Code: codeMalformedBody, Detail: parseErr.Error()})
+			if err := imp.progress(); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		fields := map[string]textField{}
+		for i, column := range header {
+			fields[column] = textField{text: record[i]}
+		}
+		data, err := typedJSON(fields, itemType)
+		if err != nil {
+			return err
+		}
+		if err := imp.importRow(line, data); err != nil {
+			return err
+		}
+		if err := imp.progress(); err != nil {
+			return err
+		}
+	}
+}
+
+// readNDJSON legge un oggetto JSON per riga; le righe vuote vengono ignorate
+func (imp *itemImporter) readNDJSON() error {
+	scanner := bufio.NewScanner(imp.reader)
+	scanner.Buffer(make([]byte, 64<<10), maxImportLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if err := imp.importRow(line, data); err != nil {
+			return err
+		}
+		if err := imp.progress(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// importRow valida e salva un item; gli errori della riga vengono registrati nel job,
+// mentre quelli di salvataggio interrompono l'import
+func (imp *itemImporter) importRow(line int, data []byte) error {
+	imp.job.Processed++
+	if !imp.job.DryRun {
+		// Salvata da un'esecuzione precedente dello stesso import
+		if imported, err := rdb.GetBit(importedLinesKey(imp.job.ID), int64(line)).Result(); err != nil {
+			return err
+		} else if imported == 1 {
+			imp.job.Imported++
+			return nil
+		}
+	}
+
+	var item schemas.Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		imp.rowFailed(line, &APIError{Code: codeMalformedBody, Detail: err.Error()})
+		return nil
+	}
+
+	var inputErrors []schemas.FieldError
+	name := strings.ToLower(strings.TrimSpace(item.Name))
+	if imp.job.DryRun && imp.names[name] {
+		// Senza salvare, le righe precedenti non sono nella sorgente dati e checkItem non le vede
+		inputErrors = append(inputErrors, schemas.FieldError{
+			Field:   "name",
+			Rule:    "unique",
+			Message: localize(imp.c, msgNameTaken, "name"),
+		})
+	}
+	if err := validateItem(imp.c, &item, 0, inputErrors); err != nil {
+		imp.rowFailed(line, err)
+		return nil
+	}
+
+	if imp.job.DryRun {
+		imp.names[name] = true
+	} else if _, err := createItem(imp.c, item); err != nil {
+		// Il nome può essere stato preso da una scrittura concorrente dopo validateItem
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == codeValidationFailed {
+			imp.rowFailed(line, err)
+			return nil
+		}
+		return err
+	} else if err := markLineImported(imp.job.ID, line); err != nil {
+		return err
+	}
+	imp.job.Imported++
+	return nil
+}
+
+func (imp *itemImporter) rowFailed(line int, err error) {
+	imp.job.Failed++
+	if len(imp.job.Errors) >= maxImportErrors {
+		imp.job.ErrorsTruncated = true
+		return
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &APIError{Code: codeMalformedBody, Detail: err.Error()}
+	}
+	imp.job.Errors = append(imp.job.Errors, schemas.ImportError{
+		Line:   line,
+		Code:   apiErr.Code,
+		Detail: apiErr.Detail,
+		Errors: apiErr.Errors,
+	})
+}
+
+// progress salva l'avanzamento ogni importProgressEvery righe e si ferma se il job è stato annullato
+func (imp *itemImporter) progress() error {
+	if imp.job.Processed%importProgressEvery != 0 {
+		return nil
+	}
+	imp.job.BytesRead = imp.reader.n
+	if err := saveImportJob(*imp.job); err != nil {
+		log.Printf("import %s: %v", imp.job.ID, err)
+	}
+	return imp.run.progress(imp.job.BytesRead, imp.job.BytesTotal)
+}
+
+// countingReader conta i byte letti dal file, per calcolare l'avanzamento
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// importBody legge il body di un import e si ferma con errImportTooLarge appena
+// supera maxImportSize; err distingue gli errori di lettura da quelli del BlobStore
+type importBody struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (b *importBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if b.n > maxImportSize {
+		b.err = errImportTooLarge
+	} else if err != nil && err != io.EOF {
+		b.err = err
+	}
+	if b.err != nil {
+		return n, b.err
+	}
+	return n, err
+}
+
+// saveImportPayload salva body nel BlobStore e ne restituisce la dimensione; si
+// ferma con errImportTooLarge appena body supera maxImportSize
+func saveImportPayload(id string, body io.Reader) (int64, error) {
+	reader := &importBody{r: body}
+	size, err := blobStore.Put(importPayloadKey(id), reader)
+	if reader.err != nil {
+		return size, reader.err
+	} else if err != nil {
+		return size, &APIError{Code: codeStorageError, Err: err}
+	}
+	return size, nil
+}
+
+// importPayloadKey è la chiave del file dell'import nel BlobStore
+func importPayloadKey(id string) string {
+	return "imports/" + id
+}
+
+// importedLinesKey è la bitmap delle righe già salvate dall'import
+func importedLinesKey(id string) string {
+	return importPrefix + id + ":lines"
+}
+
+func markLineImported(id string, line int) error {
+	pipe := rdb.TxPipeline()
+	pipe.SetBit(importedLinesKey(id), int64(line), 1)
+	pipe.Expire(importedLinesKey(id), importJobTTL)
+	_, err := pipe.Exec()
+	return err
+}
+
+// Funzioni per interagire con lo stato degli import, salvato in Redis perché
+// qualunque istanza possa rispondere a GetImportJob
+func saveImportJob(job schemas.ImportJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(importPrefix+job.ID, data, importJobTTL).Err()
+}
+
+func loadImportJob(id string) (*schemas.ImportJob, error) {
+	val, err := rdb.Get(importPrefix + id).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var job schemas.ImportJob
+	if err := json.Unmarshal([]byte(val), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
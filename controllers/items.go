@@ -3,6 +3,8 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"gin-try/repository"
 	"gin-try/schemas"
 	"net/http"
 	"strconv"
@@ -15,200 +17,373 @@ import (
 
 var ctx = context.Background()
 var rdb *redis.Client
-var itemsStore = []schemas.Item{
-	{ID: 1, Name: "item one"},
-	{ID: 2, Name: "item two"},
-}
+var seededAt = time.Now().UTC()
+var itemRepo repository.ItemRepository = repository.NewMemoryItemRepository([]schemas.Item{
+	{ID: 1, Name: "item one", Tags: []string{}, CreatedAt: seededAt, UpdatedAt: seededAt},
+	{ID: 2, Name: "item two", Tags: []string{}, CreatedAt: seededAt, UpdatedAt: seededAt},
+})
 
 // SetRedis imposta la connessione a Redis per i controllers
 func SetRedis(redisClient *redis.Client) {
 	rdb = redisClient
 }
 
+// SetItemRepository imposta la sorgente dati degli items
+func SetItemRepository(repo repository.ItemRepository) {
+	itemRepo = repo
+}
+
+// SetItems sostituisce la sorgente dati con un repository in memoria che contiene gli items indicati
+func SetItems(items []schemas.Item) {
+	SetItemRepository(repository.NewMemoryItemRepository(items))
+}
+
 const (
 	cacheDuration = 10 * time.Minute
 	cachePrefix   = "items:"
 )
 
 // @Summary Get all items
-// @Description Retrieve a list of all items
-// @Produce json
+// @Description Retrieve a list of all items, or the list as it was at the instant given by as_of; page and per_page split it into pages linked from the Link header
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param as_of query string false "RFC3339 instant in the past, e.g. 2024-06-07T18:00:00Z"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name"
+// @Param page query int false "Page number, starting from 1"
+// @Param per_page query int false "Items per page, at most 100 (default 20 when page is set)"
 // @Success 200 {array} schemas.Item
+// @Failure 400 {object} schemas.Problem "invalid_parameter"
+// @Failure 500 {object} schemas.Problem "cache_error, storage_error"
 // @Router /items [get]
 func GetItems(c *gin.Context) {
-	cacheKey := cachePrefix + "all"
+	if err := parseProjection(c); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if asOf, found, err := parseAsOf(c); err != nil {
+		abortWithError(c, err)
+		return
+	} else if found {
+		getItemsAsOf(c, asOf)
+		return
+	}
 
-	// Controlla se gli items sono presenti nella cache
-	val, err := rdb.Get(cacheKey).Result()
-	if err == redis.Nil {
-		// Se non sono nella cache, recuperali dalla sorgente
-		var items []schemas.Item = getItemsFromSource()
-		// Salva gli items nella cache
-		jsonData, _ := json.Marshal(items)
-		rdb.Set(cacheKey, jsonData, cacheDuration)
-		c.JSON(http.StatusOK, items)
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	} else {
-		// Se sono nella cache, restituiscili
-		var items []schemas.Item
-		json.Unmarshal([]byte(val), &items)
-		c.JSON(http.StatusOK, items)
+	items, err := loadItems(cacheFields(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	page, err := paginate(c, items)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
+	render(c, http.StatusOK, page)
 }
 
 // @Summary Get item by ID
-// @Description Retrieve an item by its ID
-// @Produce json
+// @Description Retrieve an item by its ID, or its state at the instant given by as_of
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
 // @Param id path int true "Item ID"
+// @Param as_of query string false "RFC3339 instant in the past, e.g. 2024-06-07T18:00:00Z"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name"
 // @Success 200 {object} schemas.Item
+// @Failure 400 {object} schemas.Problem "invalid_parameter"
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error, storage_error"
 // @Router /items/{id} [get]
 func GetItemsByID(c *gin.Context) {
 	id := c.Param("id")
-	cacheKey := cachePrefix + id
+	if err := parseProjection(c); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if asOf, found, err := parseAsOf(c); err != nil {
+		abortWithError(c, err)
+		return
+	} else if found {
+		getItemAsOf(c, id, asOf)
+		return
+	}
 
-	// Controlla se l'item è presente nella cache
-	val, err := rdb.Get(cacheKey).Result()
-	if err == redis.Nil {
-		// Se non è nella cache, recuperalo dalla sorgente
-		item := getItemFromSourceByID(id)
-		if item == nil {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Item not found"})
-			return
-		}
-		// Salva l'item nella cache
-		jsonData, _ := json.Marshal(item)
-		rdb.Set(cacheKey, jsonData, cacheDuration)
-		c.JSON(http.StatusOK, item)
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	} else {
-		// Se è nella cache, restituiscilo
-		var item schemas.Item
-		json.Unmarshal([]byte(val), &item)
-		c.JSON(http.StatusOK, item)
+	item, err := loadItem(c, id, cacheFields(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
+	render(c, http.StatusOK, item)
 }
 
 // @Summary Search items by name
 // @Description Retrieve items whose name contains the specified string
-// @Produce json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
 // @Param name query string true "Item name to search"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name"
+// @Param page query int false "Page number, starting from 1"
+// @Param per_page query int false "Items per page, at most 100 (default 20 when page is set)"
 // @Success 200 {array} schemas.Item
+// @Failure 400 {object} schemas.Problem "missing_parameter, invalid_parameter"
+// @Failure 500 {object} schemas.Problem "cache_error"
 // @Router /items/search [get]
 func SearchItemsByName(c *gin.Context) {
 	name := c.Query("name")
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing name query parameter"})
+		abortWithError(c, &APIError{Code: codeMissingParameter, Detail: localize(c, msgMissingName)})
+		return
+	}
+	if err := parseProjection(c); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	cacheKey := cachePrefix + "search:" + name
-
-	// Controlla se gli items sono presenti nella cache
-	val, err := rdb.Get(cacheKey).Result()
-	if err == redis.Nil {
-		// Se non sono nella cache, recuperali dalla sorgente
-		var foundItems []schemas.Item = searchItemsFromSourceByName(name)
-		// Salva gli items nella cache
-		jsonData, _ := json.Marshal(foundItems)
-		rdb.Set(cacheKey, jsonData, cacheDuration)
-		c.JSON(http.StatusOK, foundItems)
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	} else {
-		// Se sono nella cache, restituiscili
-		var foundItems []schemas.Item
-		json.Unmarshal([]byte(val), &foundItems)
-		c.JSON(http.StatusOK, foundItems)
+	foundItems, err := searchItems(name, cacheFields(c))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	page, err := paginate(c, foundItems)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
+	render(c, http.StatusOK, page)
 }
 
 // @Summary Delete item by ID
-// @Description Delete an item by its ID
-// @Produce json
+// @Description Move an item to the trash; it can be restored until the trash retention expires
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
 // @Param id path int true "Item ID"
+// @Param X-Actor header string false "Who is performing the change"
 // @Success 204 "No Content"
+// @Failure 404 {object} schemas.Problem "item_not_found"
 // @Router /items/{id} [delete]
 func DeleteItem(c *gin.Context) {
-	id := c.Param("id")
-
-	// Elimina l'item dalla sorgente
-	if !deleteItemFromSource(id) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Item not found"})
+	if err := deleteItem(c, c.Param("id")); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	// Elimina l'item dalla cache
-	cacheKey := cachePrefix + id
-	rdb.Del(cacheKey)
-
-	// Elimina la cache di tutti gli items
-	rdb.Del(cachePrefix + "all")
-
-	c.JSON(http.StatusNoContent, gin.H{"message": "Item deleted"})
+	render(c, http.StatusNoContent, gin.H{"message": "Item deleted"})
 }
 
 // @Summary Create a new item
-// @Description Create a new item with the provided JSON data
-// @Accept json
-// @Produce json
+// @Description Create a new item; the body can be JSON, XML, YAML, MessagePack or a CSV header plus one row
+// @Accept json,xml,application/yaml,application/msgpack,text/csv,application/vnd.api+json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param Idempotency-Key header string false "Key that makes retries of the same request safe"
+// @Param X-Actor header string false "Who is performing the change"
 // @Param item body schemas.Item true "Item object"
 // @Success 201 {object} schemas.Item
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 406 {object} schemas.Problem "not_acceptable"
+// @Failure 409 {object} schemas.Problem "idempotency_in_progress, idempotency_key_expired"
+// @Failure 415 {object} schemas.Problem "unsupported_media_type"
+// @Failure 422 {object} schemas.Problem "validation_failed, idempotency_key_reused"
 // @Router /items [post]
 func CreateItem(c *gin.Context) {
 	var newItem schemas.Item
-	if err := c.BindJSON(&newItem); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if err := bindItem(c, &newItem, 0); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	created, err := createItem(c, newItem)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	newItem.ID = len(getItemsFromSource()) + 1 // Genera un nuovo ID
-	saveItemToSource(newItem)
-
-	// Invalida la cache di tutti gli items
-	rdb.Del(cachePrefix + "all")
 
-	c.JSON(http.StatusCreated, newItem)
+	render(c, http.StatusCreated, created)
 }
 
 // @Summary Update an item by ID
-// @Description Update an item by its ID with the provided JSON data
-// @Accept json
-// @Produce json
+// @Description Update an item by its ID; the body can be JSON, XML, YAML, MessagePack or a CSV header plus one row
+// @Accept json,xml,application/yaml,application/msgpack,text/csv,application/vnd.api+json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
 // @Param id path int true "Item ID"
+// @Param X-Actor header string false "Who is performing the change"
 // @Param item body schemas.Item true "Updated item object"
 // @Success 200 {object} schemas.Item
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Failure 406 {object} schemas.Problem "not_acceptable"
+// @Failure 415 {object} schemas.Problem "unsupported_media_type"
+// @Failure 422 {object} schemas.Problem "validation_failed"
 // @Router /items/{id} [put]
 func UpdatedItem(c *gin.Context) {
 	id := c.Param("id")
 
 	var updatedItem schemas.Item
-	if err := c.BindJSON(&updatedItem); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if err := bindItem(c, &updatedItem, parseItemID(id)); err != nil {
+		abortWithError(c, err)
 		return
 	}
-
-	if !updateItemInSource(id, updatedItem) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Item not found"})
+	updated, err := updateItem(c, id, updatedItem)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	// Invalida la cache del singolo item e di tutti gli items
+	render(c, http.StatusOK, updated)
+}
+
+// Le funzioni seguenti contengono la logica di cache e di scrittura condivisa tra
+// gli handler REST e i resolver GraphQL; gli errori sono sempre *APIError.
+
+// loadItems restituisce tutti gli items, dalla cache se presenti
+func loadItems(fields []string) ([]schemas.Item, error) {
+	cacheKey := cachePrefix + "all"
+
+	// Controlla se gli items sono presenti nella cache
+	val, err := getCachedItems(cacheKey, fields)
+	if err == redis.Nil {
+		// Se non sono nella cache, recuperali dalla sorgente
+		var items []schemas.Item = getItemsFromSource()
+		// Salva gli items nella cache
+		setCachedItems(cacheKey, fields, items, cacheDuration)
+		return items, nil
+	} else if err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+
+	// Se sono nella cache, restituiscili
+	var items []schemas.Item
+	json.Unmarshal([]byte(val), &items)
+	return items, nil
+}
+
+// loadItem restituisce l'item indicato, dalla cache se presente
+func loadItem(c *gin.Context, id string, fields []string) (*schemas.Item, error) {
 	cacheKey := cachePrefix + id
-	rdb.Del(cacheKey)
-	rdb.Del(cachePrefix + "all")
 
-	c.JSON(http.StatusOK, updatedItem)
+	// Controlla se l'item è presente nella cache
+	val, err := getCachedItems(cacheKey, fields)
+	if err == redis.Nil {
+		// Se non è nella cache, recuperalo dalla sorgente
+		item := getItemFromSourceByID(id)
+		if item == nil {
+			return nil, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)}
+		}
+		// Salva l'item nella cache
+		setCachedItems(cacheKey, fields, item, cacheDuration)
+		return item, nil
+	} else if err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+
+	// Se è nella cache, restituiscilo
+	var item schemas.Item
+	json.Unmarshal([]byte(val), &item)
+	return &item, nil
+}
+
+// searchItems restituisce gli items il cui nome contiene name, dalla cache se presenti
+func searchItems(name string, fields []string) ([]schemas.Item, error) {
+	cacheKey := cachePrefix + "search:" + name
+
+	// Controlla se gli items sono presenti nella cache
+	val, err := getCachedItems(cacheKey, fields)
+	if err == redis.Nil {
+		// Se non sono nella cache, recuperali dalla sorgente
+		var foundItems []schemas.Item = searchItemsFromSourceByName(name)
+		// Salva gli items nella cache
+		setCachedItems(cacheKey, fields, foundItems, cacheDuration)
+		return foundItems, nil
+	} else if err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+
+	// Se sono nella cache, restituiscili
+	var foundItems []schemas.Item
+	json.Unmarshal([]byte(val), &foundItems)
+	return foundItems, nil
 }
 
-// Funzioni per interagire con la sorgente dati
+// createItem salva un item già validato, invalida la cache e registra la revisione
+func createItem(c *gin.Context, newItem schemas.Item) (*schemas.Item, error) {
+	normalizeItem(&newItem)
+	newItem.CreatedAt = time.Now().UTC()
+	newItem.UpdatedAt = newItem.CreatedAt
+	newItem.DeletedAt = nil
+	// La sorgente dati genera il nuovo ID e ricontrolla il nome insieme al salvataggio
+	newItem, err := saveItemToSource(newItem)
+	if errors.Is(err, repository.ErrNameTaken) {
+		return nil, validationFailed(c, []schemas.FieldError{nameTakenError(c)})
+	} else if err != nil {
+		return nil, &APIError{Code: codeStorageError, Err: err}
+	}
+
+	// Invalida la cache di tutti gli items e della sua categoria
+	rdb.Del(itemCacheKeys("all")...)
+	invalidateCategoryItems(newItem.CategoryID)
+
+	recordRevision(c, schemas.ActionCreate, nil, &newItem)
+
+	return &newItem, nil
+}
+
+// updateItem sostituisce un item esistente con uno già validato
+func updateItem(c *gin.Context, id string, updatedItem schemas.Item) (*schemas.Item, error) {
+	updatedItem.ID = parseItemID(id)
+
+	existing := getItemFromSourceByID(id)
+	if existing == nil {
+		return nil, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)}
+	}
+	normalizeItem(&updatedItem)
+	updatedItem.CreatedAt = existing.CreatedAt
+	updatedItem.UpdatedAt = time.Now().UTC()
+	updatedItem.DeletedAt = nil
+	err := updateItemInSource(updatedItem)
+	if errors.Is(err, repository.ErrNameTaken) {
+		return nil, validationFailed(c, []schemas.FieldError{nameTakenError(c)})
+	} else if err != nil {
+		return nil, &APIError{Code: codeStorageError, Err: err}
+	}
+
+	// Invalida la cache del singolo item e di tutti gli items
+	rdb.Del(itemCacheKeys(id, "all")...)
+	invalidateCategoryItems(existing.CategoryID, updatedItem.CategoryID)
+
+	recordRevision(c, schemas.ActionUpdate, existing, &updatedItem)
+
+	return &updatedItem, nil
+}
+
+// deleteItem sposta l'item nel cestino e lo elimina dalla cache
+func deleteItem(c *gin.Context, id string) error {
+	item := getItemFromSourceByID(id)
+
+	// Sposta l'item nel cestino
+	if item == nil {
+		return &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotFound)}
+	}
+	if err := deleteItemFromSource(id); err != nil {
+		return &APIError{Code: codeStorageError, Err: err}
+	}
+
+	// Elimina dalla cache l'item, tutti gli items e gli items della sua categoria
+	rdb.Del(itemCacheKeys(id, "all")...)
+	invalidateCategoryItems(item.CategoryID)
+
+	recordRevision(c, schemas.ActionDelete, item, nil)
+
+	return nil
+}
+
+// Funzioni per interagire con la sorgente dati. Gli items nel cestino (DeletedAt
+// valorizzato) sono visibili solo alle funzioni che riguardano il cestino.
 func getItemsFromSource() []schemas.Item {
-	return itemsStore
+	items := []schemas.Item{}
+	for _, item := range itemRepo.List() {
+		if item.DeletedAt == nil {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func getItemFromSourceByID(id string) *schemas.Item {
-	for _, item := range itemsStore {
-		if strconv.Itoa(item.ID) == id {
+	for _, item := range itemRepo.List() {
+		if strconv.Itoa(item.ID) == id && item.DeletedAt == nil {
 			return &item
 		}
 	}
@@ -217,34 +392,30 @@ func getItemFromSourceByID(id string) *schemas.Item {
 
 func searchItemsFromSourceByName(name string) []schemas.Item {
 	var foundItems []schemas.Item
-	for _, item := range itemsStore {
-		if strings.Contains(strings.ToLower(item.Name), strings.ToLower(name)) {
+	for _, item := range getItemsFromSource() {
+		if itemNameMatches(item.Name, name) {
 			foundItems = append(foundItems, item)
 		}
 	}
 	return foundItems
 }
 
-func deleteItemFromSource(id string) bool {
-	for i, item := range itemsStore {
-		if strconv.Itoa(item.ID) == id {
-			itemsStore = append(itemsStore[:i], itemsStore[i+1:]...)
-			return true
-		}
-	}
-	return false
+// itemNameMatches è vero se il nome contiene il termine cercato, senza distinguere maiuscole e minuscole
+func itemNameMatches(name, term string) bool {
+	return strings.Contains(strings.ToLower(name), strings.ToLower(term))
 }
 
-func saveItemToSource(item schemas.Item) {
-	itemsStore = append(itemsStore, item)
+// deleteItemFromSource sposta l'item nel cestino
+func deleteItemFromSource(id string) error {
+	return itemRepo.Delete(parseItemID(id), time.Now().UTC())
 }
 
-func updateItemInSource(id string, updatedItem schemas.Item) bool {
-	for i, item := range itemsStore {
-		if strconv.Itoa(item.ID) == id {
-			itemsStore[i] = updatedItem
-			return true
-		}
-	}
-	return false
+// saveItemToSource salva un nuovo item e restituisce l'item con l'ID assegnato,
+// successivo al più alto mai usato (anche nel cestino o eliminato definitivamente)
+func saveItemToSource(item schemas.Item) (schemas.Item, error) {
+	return itemRepo.CreateNext(item)
+}
+
+func updateItemInSource(updatedItem schemas.Item) error {
+	return itemRepo.Update(updatedItem)
 }
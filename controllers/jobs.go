@@ -0,0 +1,580 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+const (
+	jobPrefix = "jobs:"
+	// jobQueue è la lista Redis dei job da eseguire: LPUSH per accodare, BRPOPLPUSH
+	// per spostarne uno in jobProcessing, da cui esce solo quando il worker ha finito
+	jobQueue      = "jobs:queue"
+	jobProcessing = "jobs:processing"
+	// jobTTL è per quanto tempo un job resta consultabile
+	jobTTL = 24 * time.Hour
+	// jobPollTimeout è quanto un worker attende un job prima di controllare se deve fermarsi
+	jobPollTimeout = time.Second
+	// jobProgressEvery è ogni quanti elementi cache_warmup e reindex salvano l'avanzamento
+	jobProgressEvery = 100
+)
+
+// jobLease è per quanto tempo un job in esecuzione resta assegnato al suo worker
+// senza rinnovi: il worker lo rinnova finché lavora, poi il job torna in coda
+var jobLease = 30 * time.Second
+
+// SetJobLease imposta dopo quanto tempo senza rinnovi un job in esecuzione torna in coda
+func SetJobLease(lease time.Duration) {
+	if lease > 0 {
+		jobLease = lease
+	}
+}
+
+// requeueJob toglie il job da jobProcessing e lo rimette in coda, come prossimo, se
+// il suo lease non esiste: LREM fa sì che lo rimetta in coda una sola replica
+var requeueJob = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 0 and redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// errJobCanceled interrompe un job di cui è stato chiesto l'annullamento
+var errJobCanceled = errors.New("job canceled")
+
+// jobHeaders sono gli header della richiesta che restano validi nel job: l'autore
+// delle modifiche e la lingua dei messaggi
+var jobHeaders = []string{actorHeader, "Accept-Language"}
+
+// jobKind è un tipo di job: run esegue il lavoro, finish (opzionale) viene chiamata
+// alla fine, anche per un job annullato prima di partire
+type jobKind struct {
+	run    func(c *gin.Context, run *jobRun) error
+	finish func(job schemas.Job)
+}
+
+var jobKinds = map[string]jobKind{
+	schemas.JobImport:      {run: runImportJob, finish: finishImportJob},
+	schemas.JobCacheWarmup: {run: warmCache},
+	schemas.JobReindex:     {run: reindexSearches},
+}
+
+// jobRecord è il job salvato in Redis, con gli header della richiesta che lo ha creato
+type jobRecord struct {
+	schemas.Job
+	Header http.Header `json:"header,omitempty"`
+}
+
+// @Summary Start a job
+// @Description Queue a long-running operation: cache_warmup loads every item into the cache, reindex recomputes the cached searches from the items.
+// @Description Any replica can run the job; its state and progress are available at the Location URL
+// @Accept json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param X-Actor header string false "Who is performing the change"
+// @Param job body schemas.Job true "Job to start, only the type is read"
+// @Success 202 {object} schemas.Job
+// @Header 202 {string} Location "URL of the job"
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /jobs [post]
+func CreateJob(c *gin.Context) {
+	var job schemas.Job
+	fieldErrors, err := bindJSON(c, &job)
+	if err == nil {
+		err = validationFailed(c, fieldErrors)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	queued, err := enqueueJob(c, newRandomID(), job.Type, 0)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Header("Location", apiPath(c, "/jobs/"+queued.ID))
+	render(c, http.StatusAccepted, queued)
+}
+
+// @Summary Get a job
+// @Description Retrieve the state and the progress of a job
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path string true "Job ID"
+// @Success 200 {object} schemas.Job
+// @Failure 404 {object} schemas.Problem "job_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /jobs/{id} [get]
+func GetJob(c *gin.Context) {
+	record, err := loadJob(c, c.Param("id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, record.Job)
+}
+
+// @Summary Cancel a job
+// @Description A queued job is canceled at once; a running job stops at its next progress update, so the response is 202 and the job keeps running until then
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path string true "Job ID"
+// @Success 200 {object} schemas.Job
+// @Success 202 {object} schemas.Job
+// @Failure 404 {object} schemas.Problem "job_not_found"
+// @Failure 409 {object} schemas.Problem "job_finished"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /jobs/{id}/cancel [post]
+func CancelJob(c *gin.Context) {
+	record, err := loadJob(c, c.Param("id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if record.Status != schemas.JobQueued && record.Status != schemas.JobRunning {
+		abortWithError(c, &APIError{Code: codeJobFinished, Detail: localize(c, msgJobFinished, record.Status)})
+		return
+	}
+
+	// La richiesta di annullamento è una chiave a parte: il worker salva lo stato
+	// del job a ogni avanzamento e la sovrascriverebbe
+	if err := rdb.Set(jobCancelKey(record.ID), 1, jobTTL).Err(); err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	if record.Status == schemas.JobQueued {
+		// Un job in coda viene annullato subito, a meno che un worker non lo prenda nel frattempo
+		canceled, err := cancelQueuedJob(record.ID)
+		if err != nil {
+			abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+			return
+		}
+		record = canceled
+		if record.Status == schemas.JobCanceled {
+			cleanupJob(record)
+			render(c, http.StatusOK, record.Job)
+			return
+		}
+	}
+	if record.Status != schemas.JobRunning {
+		abortWithError(c, &APIError{Code: codeJobFinished, Detail: localize(c, msgJobFinished, record.Status)})
+		return
+	}
+	record.CancelRequested = true
+	render(c, http.StatusAccepted, record.Job)
+}
+
+// enqueueJob salva un job e lo mette in coda; total è l'avanzamento atteso, se già noto
+func enqueueJob(c *gin.Context, id, jobType string, total int64) (*schemas.Job, error) {
+	record := &jobRecord{
+		Job: schemas.Job{
+			ID:        id,
+			Type:      jobType,
+			Status:    schemas.JobQueued,
+			Total:     total,
+			CreatedAt: time.Now().UTC(),
+		},
+		Header: http.Header{},
+	}
+	for _, name := range jobHeaders {
+		if values := c.Request.Header.Values(name); len(values) > 0 {
+			record.Header[name] = values
+		}
+	}
+
+	if err := saveJob(record); err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+	if err := rdb.LPush(jobQueue, id).Err(); err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+	return &record.Job, nil
+}
+
+// StartJobWorkers avvia workers goroutine che eseguono i job in coda, finché ctx
+// non viene cancellato. Ogni replica può avviarne: un job viene preso da una sola.
+// Un job resta in jobProcessing finché il suo worker non ha finito, e se il worker
+// si ferma prima smette di rinnovarne il lease: il reaper lo rimette in coda.
+func StartJobWorkers(ctx context.Context, workers int) {
+	// La coda usa sempre il client e il lease con cui i worker sono stati avviati
+	client := rdb
+	lease := jobLease
+	for i := 0; i < workers; i++ {
+		go func() {
+			for ctx.Err() == nil {
+				id, err := client.BRPopLPush(jobQueue, jobProcessing, jobPollTimeout).Result()
+				if err == redis.Nil {
+					continue
+				} else if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("job queue: %v", err)
+					}
+					select {
+					case <-ctx.Done():
+					case <-time.After(jobPollTimeout):
+					}
+					continue
+				}
+				runJob(ctx, client, id, lease)
+			}
+		}()
+	}
+
+	go func() {
+		// Un job senza lease viene rimesso in coda solo se lo era già al giro
+		// precedente: il worker lo imposta subito dopo averlo preso dalla coda
+		var suspects map[string]bool
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(lease):
+			}
+			suspects = reapJobs(client, suspects)
+		}
+	}()
+}
+
+// reapJobs rimette in coda i job di jobProcessing rimasti senza lease da prima di
+// suspects e restituisce quelli senza lease adesso, da ricontrollare al giro dopo
+func reapJobs(client *redis.Client, suspects map[string]bool) map[string]bool {
+	ids, err := client.LRange(jobProcessing, 0, -1).Result()
+	if err != nil {
+		log.Printf("job reaper: %v", err)
+		return suspects
+	}
+
+	expired := map[string]bool{}
+	for _, id := range ids {
+		if n, err := client.Exists(jobLeaseKey(id)).Result(); err != nil || n > 0 {
+			continue
+		}
+		if !suspects[id] {
+			expired[id] = true
+			continue
+		}
+		requeued, err := requeueJob.Run(client, []string{jobProcessing, jobQueue, jobLeaseKey(id)}, id).Int64()
+		if err != nil {
+			log.Printf("job %s: %v", id, err)
+		} else if requeued == 1 {
+			log.Printf("job %s: worker lost, job queued again", id)
+		}
+	}
+	return expired
+}
+
+// runJob esegue il job indicato, se è ancora in coda o se il suo worker si è fermato
+func runJob(ctx context.Context, client *redis.Client, id string, lease time.Duration) {
+	if ctx.Err() != nil {
+		// Il worker si sta fermando: il job resta in jobProcessing e il reaper lo rimette in coda
+		return
+	}
+	record, err := claimJob(client, id, lease)
+	if err != nil {
+		// Il job resta in jobProcessing e il reaper lo rimette in coda
+		log.Printf("job %s: %v", id, err)
+		return
+	}
+	if record == nil {
+		// Annullato mentre era in coda, già concluso o scaduto
+		client.LRem(jobProcessing, 1, id)
+		return
+	}
+
+	// Il lease viene rinnovato finché il job è in esecuzione
+	heartbeat, stop := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeat.Done():
+				return
+			case <-ticker.C:
+				client.PExpire(jobLeaseKey(id), lease)
+			}
+		}
+	}()
+
+	run := &jobRun{ctx: ctx, record: record}
+	err = run.checkCanceled()
+	if err == nil {
+		c := detachedContext(ctx, http.MethodPost, "/jobs/"+id, record.Header)
+		err = jobKinds[record.Type].run(c, run)
+	}
+	if ctx.Err() != nil {
+		// Interrotto perché il worker si sta fermando, non concluso: senza più lease
+		// il reaper lo rimette in coda e un altro worker lo esegue di nuovo
+		stop()
+		client.Del(jobLeaseKey(id))
+		log.Printf("job %s: worker stopped, job left to the reaper", id)
+		return
+	}
+	finishJob(record, err)
+
+	stop()
+	pipe := client.TxPipeline()
+	pipe.LRem(jobProcessing, 1, id)
+	pipe.Del(jobLeaseKey(id))
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("job %s: %v", id, err)
+	}
+}
+
+// claimJob porta il job a running e gli assegna il lease in una transazione sul
+// suo stato, così un CancelJob concorrente o lo annulla prima o lo trova in
+// esecuzione. Prende anche un job running senza lease, rimesso in coda dal reaper.
+// Restituisce nil se il job non va eseguito.
+func claimJob(client *redis.Client, id string, lease time.Duration) (*jobRecord, error) {
+	for {
+		var claimed *jobRecord
+		err := client.Watch(func(tx *redis.Tx) error {
+			val, err := tx.Get(jobPrefix + id).Result()
+			if err == redis.Nil {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			var record jobRecord
+			if err := json.Unmarshal([]byte(val), &record); err != nil {
+				return err
+			}
+			switch record.Status {
+			case schemas.JobQueued:
+			case schemas.JobRunning:
+				if n, err := tx.Exists(jobLeaseKey(id)).Result(); err != nil || n > 0 {
+					return err
+				}
+			default:
+				return nil
+			}
+
+			startedAt := time.Now().UTC()
+			record.Status = schemas.JobRunning
+			record.StartedAt = &startedAt
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(jobPrefix+id, data, jobTTL)
+				pipe.Set(jobLeaseKey(id), 1, lease)
+				return nil
+			})
+			if err == nil {
+				claimed = &record
+			}
+			return err
+		}, jobPrefix+id, jobLeaseKey(id))
+		if err != redis.TxFailedErr {
+			return claimed, err
+		}
+	}
+}
+
+// cancelQueuedJob annulla il job e lo toglie dalla coda in una transazione, se è
+// ancora in coda; altrimenti restituisce il job com'è ora, per esempio già preso da un worker
+func cancelQueuedJob(id string) (*jobRecord, error) {
+	for {
+		var record jobRecord
+		err := rdb.Watch(func(tx *redis.Tx) error {
+			val, err := tx.Get(jobPrefix + id).Result()
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal([]byte(val), &record); err != nil {
+				return err
+			}
+			if record.Status != schemas.JobQueued {
+				return nil
+			}
+
+			setJobOutcome(&record, errJobCanceled)
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(jobPrefix+id, data, jobTTL)
+				pipe.LRem(jobQueue, 1, id)
+				return nil
+			})
+			return err
+		}, jobPrefix+id)
+		if err != redis.TxFailedErr {
+			return &record, err
+		}
+	}
+}
+
+// finishJob registra l'esito del job: completato senza errori, annullato con errJobCanceled, fallito altrimenti
+func finishJob(record *jobRecord, err error) {
+	setJobOutcome(record, err)
+	if err := saveJob(record); err != nil {
+		log.Printf("job %s: %v", record.ID, err)
+	}
+	cleanupJob(record)
+}
+
+func setJobOutcome(record *jobRecord, err error) {
+	finishedAt := time.Now().UTC()
+	record.FinishedAt = &finishedAt
+	record.CancelRequested = false
+	switch {
+	case err == nil:
+		record.Status = schemas.JobCompleted
+		record.Done = record.Total
+	case errors.Is(err, errJobCanceled):
+		record.Status = schemas.JobCanceled
+	default:
+		record.Status = schemas.JobFailed
+		record.Error = err.Error()
+	}
+}
+
+// cleanupJob elimina la richiesta di annullamento e chiama finish del tipo di job
+func cleanupJob(record *jobRecord) {
+	rdb.Del(jobCancelKey(record.ID))
+
+	if finish := jobKinds[record.Type].finish; finish != nil {
+		finish(record.Job)
+	}
+}
+
+// jobRun è il job in esecuzione, passato al lavoro per aggiornare l'avanzamento
+type jobRun struct {
+	ctx    context.Context
+	record *jobRecord
+}
+
+// progress salva l'avanzamento e restituisce errJobCanceled se è stato chiesto di
+// annullare il job: il lavoro deve fermarsi e restituire l'errore
+func (r *jobRun) progress(done, total int64) error {
+	r.record.Done = done
+	r.record.Total = total
+	if err := saveJob(r.record); err != nil {
+		log.Printf("job %s: %v", r.record.ID, err)
+	}
+	return r.checkCanceled()
+}
+
+func (r *jobRun) checkCanceled() error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	if n, _ := rdb.Exists(jobCancelKey(r.record.ID)).Result(); n > 0 {
+		return errJobCanceled
+	}
+	return nil
+}
+
+// warmCache carica nella cache ogni item e la lista completa, come farebbero le prime letture
+func warmCache(c *gin.Context, run *jobRun) error {
+	items := getItemsFromSource()
+	total := int64(len(items))
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		if err := rdb.Set(cachePrefix+strconv.Itoa(item.ID), data, cacheDuration).Err(); err != nil {
+			return err
+		}
+		if (i+1)%jobProgressEvery == 0 {
+			if err := run.progress(int64(i+1), total); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, _ := json.Marshal(items)
+	run.record.Total = total
+	return rdb.Set(cachePrefix+"all", data, cacheDuration).Err()
+}
+
+// reindexSearches ricalcola dagli items i risultati delle ricerche in cache, che
+// le modifiche agli items non invalidano
+func reindexSearches(c *gin.Context, run *jobRun) error {
+	var keys []string
+	iter := rdb.Scan(0, cachePrefix+"search:*", 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	// Le varianti proiettate vengono eliminate e ricalcolate alla prossima ricerca
+	var projected []string
+	iter = rdb.Scan(0, projectionsKey(cachePrefix+"search:*"), 100).Iterator()
+	for iter.Next() {
+		projected = append(projected, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(projected) > 0 {
+		if err := rdb.Del(projected...).Err(); err != nil {
+			return err
+		}
+	}
+
+	total := int64(len(keys))
+	for i, key := range keys {
+		data, _ := json.Marshal(searchItemsFromSourceByName(strings.TrimPrefix(key, cachePrefix+"search:")))
+		if err := rdb.Set(key, data, cacheDuration).Err(); err != nil {
+			return err
+		}
+		if (i+1)%jobProgressEvery == 0 {
+			if err := run.progress(int64(i+1), total); err != nil {
+				return err
+			}
+		}
+	}
+	run.record.Total = total
+	return nil
+}
+
+func jobCancelKey(id string) string {
+	return jobPrefix + id + ":cancel"
+}
+
+func jobLeaseKey(id string) string {
+	return jobPrefix + id + ":lease"
+}
+
+// Funzioni per interagire con i job, salvati in Redis perché qualunque istanza
+// possa eseguirli e rispondere a GetJob
+func saveJob(record *jobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(jobPrefix+record.ID, data, jobTTL).Err()
+}
+
+func loadJob(c *gin.Context, id string) (*jobRecord, error) {
+	val, err := rdb.Get(jobPrefix + id).Result()
+	if err == redis.Nil {
+		return nil, &APIError{Code: codeJobNotFound, Detail: localize(c, msgJobNotFound)}
+	} else if err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+
+	var record jobRecord
+	if err := json.Unmarshal([]byte(val), &record); err != nil {
+		return nil, &APIError{Code: codeCacheError, Err: err}
+	}
+	if record.Status == schemas.JobRunning {
+		n, _ := rdb.Exists(jobCancelKey(id)).Result()
+		record.CancelRequested = n > 0
+	}
+	return &record, nil
+}
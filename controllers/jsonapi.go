@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-try/schemas"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jsonapiItemsType      = "items"
+	jsonapiCategoriesType = "categories"
+)
+
+// jsonapiIncludes sono le relazioni che si possono chiedere con include
+var jsonapiIncludes = []string{"category"}
+
+// checkJSONAPIQuery controlla include prima dell'handler: la specifica chiede un
+// errore per le relazioni sconosciute e una scrittura non deve avvenire se poi
+// la risposta non può essere prodotta
+func checkJSONAPIQuery(c *gin.Context) error {
+	for _, include := range jsonapiList(c.Query("include")) {
+		if !slices.Contains(jsonapiIncludes, include) {
+			return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidFormat, "include", strings.Join(jsonapiIncludes, ", "))}
+		}
+	}
+	return nil
+}
+
+func jsonapiList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// jsonapiFields sono i campi da restituire per ogni tipo (fields[items]=name,price);
+// un tipo assente restituisce tutti i campi
+type jsonapiFields map[string][]string
+
+func (f jsonapiFields) allows(resourceType, field string) bool {
+	fields, found := f[resourceType]
+	return !found || slices.Contains(fields, field)
+}
+
+// toJSONAPI costruisce il documento JSON:API: gli items diventano resource object
+// con la categoria come relazione, le categorie richieste con include vanno in
+// included. Gli altri valori vengono restituiti in meta.
+func toJSONAPI(c *gin.Context, obj any) orderedObject {
+	fields := jsonapiFields{}
+	for resourceType, value := range c.QueryMap("fields") {
+		fields[resourceType] = jsonapiList(value)
+	}
+	includeCategory := slices.Contains(jsonapiList(c.Query("include")), "category")
+
+	var items []schemas.Item
+	var data any
+	switch v := obj.(type) {
+	case schemas.Item:
+		items = []schemas.Item{v}
+		data = jsonapiItem(c, v, fields)
+	case *schemas.Item:
+		if v == nil {
+			return orderedObject{{"data", nil}}
+		}
+		items = []schemas.Item{*v}
+		data = jsonapiItem(c, *v, fields)
+	case []schemas.Item:
+		items = v
+		resources := make([]any, 0, len(v))
+		for _, item := range v {
+			resources = append(resources, jsonapiItem(c, item, fields))
+		}
+		data = resources
+	default:
+		return orderedObject{{"meta", versioned(c, obj)}}
+	}
+
+	document := orderedObject{{"data", data}}
+	if includeCategory {
+		document = append(document, orderedField{"included", jsonapiCategories(c, items, fields)})
+	}
+
+	links := orderedObject{{"self", c.Request.URL.RequestURI()}}
+	if _, list := obj.([]schemas.Item); list {
+		if info, ok := c.Value(pageKey).(pageInfo); ok && info.paginated {
+			for _, link := range pageLinks(c, info) {
+				links = append(links, orderedField{link.key, link.value.(halLink).Href})
+			}
+			document = append(document, orderedField{"meta", orderedObject{{"total", info.total}}})
+		}
+	}
+	return append(document, orderedField{"links", links})
+}
+
+// jsonapiItem è il resource object di un item: gli attributi sono quelli della
+// versione richiesta, senza id e senza la categoria, che diventa una relazione
+func jsonapiItem(c *gin.Context, item schemas.Item, fields jsonapiFields) orderedObject {
+	data, _ := json.Marshal(versioned(c, item))
+	value, _ := decodeOrdered(data)
+
+	attributes := orderedObject{}
+	for _, field := range value.(orderedObject) {
+		switch field.key {
+		case "id", "category_id", "category":
+			continue
+		}
+		if fields.allows(jsonapiItemsType, field.key) {
+			attributes = append(attributes, field)
+		}
+	}
+
+	resource := orderedObject{
+		{"type", jsonapiItemsType},
+		{"id", strconv.Itoa(item.ID)},
+		{"attributes", attributes},
+	}
+	if fields.allows(jsonapiItemsType, "category") {
+		var category any
+		if item.CategoryID != 0 {
+			category = jsonapiIdentifier(jsonapiCategoriesType, item.CategoryID)
+		}
+		resource = append(resource, orderedField{"relationships", orderedObject{{"category", orderedObject{{"data", category}}}}})
+	}
+	// un item nel cestino non ha un URL proprio
+	if item.DeletedAt == nil {
+		resource = append(resource, orderedField{"links", orderedObject{{"self", apiPath(c, "/items/"+strconv.Itoa(item.ID))}}})
+	}
+	return resource
+}
+
+func jsonapiIdentifier(resourceType string, id int) orderedObject {
+	return orderedObject{{"type", resourceType}, {"id", strconv.Itoa(id)}}
+}
+
+// jsonapiCategories restituisce una volta sola ogni categoria degli items
+func jsonapiCategories(c *gin.Context, items []schemas.Item, fields jsonapiFields) []any {
+	categories := map[int]schemas.Category{}
+	for _, category := range getCategoriesFromSource() {
+		categories[category.ID] = category
+	}
+
+	included := []any{}
+	seen := map[int]bool{}
+	for _, item := range items {
+		category, found := categories[item.CategoryID]
+		if !found || seen[category.ID] {
+			continue
+		}
+		seen[category.ID] = true
+
+		data, _ := json.Marshal(category)
+		value, _ := decodeOrdered(data)
+		attributes := orderedObject{}
+		for _, field := range value.(orderedObject) {
+			if field.key != "id" && fields.allows(jsonapiCategoriesType, field.key) {
+				attributes = append(attributes, field)
+			}
+		}
+		included = append(included, orderedObject{
+			{"type", jsonapiCategoriesType},
+			{"id", strconv.Itoa(category.ID)},
+			{"attributes", attributes},
+			{"links", orderedObject{{"self", apiPath(c, "/categories/"+strconv.Itoa(category.ID))}}},
+		})
+	}
+	return included
+}
+
+// jsonapiDocument è il body di una richiesta JSON:API per un item
+type jsonapiDocument struct {
+	Data *struct {
+		Type          string                     `json:"type"`
+		ID            string                     `json:"id"`
+		Attributes    map[string]json.RawMessage `json:"attributes"`
+		Relationships map[string]struct {
+			Data *struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			} `json:"data"`
+		} `json:"relationships"`
+	} `json:"data"`
+}
+
+// jsonapiToJSON converte il resource object di un item nel JSON accettato dagli
+// altri endpoint: gli attributi restano invariati, id e categoria tornano campi
+func jsonapiToJSON(body []byte, _ reflect.Type) ([]byte, error) {
+	var document jsonapiDocument
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	if document.Data == nil {
+		return nil, errors.New("the document must contain a data member")
+	}
+	if document.Data.Type != jsonapiItemsType {
+		return nil, errors.New("data.type must be " + jsonapiItemsType)
+	}
+
+	object := map[string]any{}
+	for key, value := range document.Data.Attributes {
+		object[key] = value
+	}
+	if document.Data.ID != "" {
+		id, err := strconv.Atoi(document.Data.ID)
+		if err != nil {
+			return nil, errors.New("data.id must be a positive integer")
+		}
+		object["id"] = id
+	}
+	if category, found := document.Data.Relationships["category"]; found {
+		object["category_id"] = 0
+		if category.Data != nil {
+			if category.Data.Type != jsonapiCategoriesType {
+				return nil, errors.New("data.relationships.category.data.type must be " + jsonapiCategoriesType)
+			}
+			id, err := strconv.Atoi(category.Data.ID)
+			if err != nil {
+				return nil, errors.New("data.relationships.category.data.id must be a positive integer")
+			}
+			object["category_id"] = id
+		}
+	}
+	return json.Marshal(object)
+}
+
+// jsonapiErrors converte un errore negli error object JSON:API, uno per ogni
+// campo non valido; pointer indica il campo nel documento della richiesta
+func jsonapiErrors(c *gin.Context, apiErr *APIError, status int) schemas.JSONAPIErrors {
+	title := localize(c, "title_"+apiErr.Code)
+	if len(apiErr.Errors) == 0 {
+		return schemas.JSONAPIErrors{Errors: []schemas.JSONAPIError{{
+			Status: strconv.Itoa(status),
+			Code:   apiErr.Code,
+			Title:  title,
+			Detail: apiErr.Detail,
+		}}}
+	}
+
+	errs := make([]schemas.JSONAPIError, 0, len(apiErr.Errors))
+	for _, fe := range apiErr.Errors {
+		pointer := "/data/attributes/" + fe.Field
+		switch fe.Field {
+		case "id":
+			pointer = "/data/id"
+		case "category_id":
+			pointer = "/data/relationships/category"
+		}
+		errs = append(errs, schemas.JSONAPIError{
+			Status: strconv.Itoa(status),
+			Code:   apiErr.Code,
+			Title:  title,
+			Detail: fe.Message,
+			Source: &schemas.JSONAPIErrorSource{Pointer: pointer},
+		})
+	}
+	return schemas.JSONAPIErrors{Errors: errs}
+}
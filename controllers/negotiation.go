@@ -0,0 +1,712 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gin-try/schemas"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+// Formati supportati per le risposte e per i body di items
+const (
+	mediaJSON    = "application/json"
+	mediaXML     = "application/xml"
+	mediaYAML    = "application/yaml"
+	mediaMsgPack = "application/msgpack"
+	mediaCSV     = "text/csv"
+	mediaNDJSON  = "application/x-ndjson"
+	mediaHAL     = "application/hal+json"
+	mediaJSONAPI = "application/vnd.api+json"
+
+	// mediaTypeKey è la chiave del context con il formato scelto da Negotiate
+	mediaTypeKey = "mediaType"
+	// csvListSeparator separa i valori dei campi lista (es. tags) in una cella CSV
+	csvListSeparator = ";"
+)
+
+var mediaTypes = []string{mediaJSON, mediaXML, mediaYAML, mediaMsgPack, mediaCSV, mediaHAL, mediaJSONAPI}
+
+// mediaAliases riconduce i nomi alternativi più diffusi al formato canonico
+var mediaAliases = map[string]string{
+	"text/xml":              mediaXML,
+	"application/x-yaml":    mediaYAML,
+	"text/yaml":             mediaYAML,
+	"application/x-msgpack": mediaMsgPack,
+	"application/ndjson":    mediaNDJSON,
+}
+
+var mediaContentTypes = map[string]string{
+	mediaJSON:    "application/json; charset=utf-8",
+	mediaXML:     "application/xml; charset=utf-8",
+	mediaYAML:    "application/yaml; charset=utf-8",
+	mediaMsgPack: mediaMsgPack,
+	mediaCSV:     "text/csv; charset=utf-8",
+	mediaHAL:     "application/hal+json; charset=utf-8",
+	// JSON:API non ammette parametri nel media type
+	mediaJSONAPI: mediaJSONAPI,
+}
+
+// Negotiate sceglie il formato della risposta dall'header Accept prima di eseguire
+// l'handler, così una richiesta non accettabile non ha effetti
+func Negotiate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		mediaType, ok := negotiateMediaType(c.GetHeader("Accept"), mediaTypes)
+		if !ok {
+			abortWithError(c, &APIError{Code: codeNotAcceptable, Detail: localize(c, msgNotAcceptable, strings.Join(mediaTypes, ", "))})
+			return
+		}
+		c.Set(mediaTypeKey, mediaType)
+		if mediaType == mediaJSONAPI {
+			if err := checkJSONAPIQuery(c); err != nil {
+				abortWithError(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// negotiateMediaType restituisce il formato preferito tra quelli di Accept (es.
+// "application/xml;q=0.9, */*;q=0.1") e quelli supportati; senza header, o con un
+// carattere jolly, vale il primo formato supportato
+func negotiateMediaType(accept string, supported []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return supported[0], true
+	}
+
+	type weighted struct {
+		mediaType string
+		q         float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			// mime non accetta "*" da solo, che alcuni client inviano
+			if strings.TrimSpace(part) != "*" {
+				continue
+			}
+			mediaType = "*/*"
+		}
+		q := 1.0
+		if value, found := params["q"]; found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, weighted{mediaType, q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	for _, a := range accepted {
+		mediaType := a.mediaType
+		if alias, found := mediaAliases[mediaType]; found {
+			mediaType = alias
+		}
+		for _, s := range supported {
+			if mediaType == "*/*" || mediaType == s || strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(s, strings.TrimSuffix(mediaType, "*")) {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// render scrive obj nel formato scelto da Negotiate e nella versione scelta da
+// APIVersion. JSON è la rappresentazione di riferimento: gli altri formati vengono
+// prodotti a partire da essa, così nomi dei campi, prezzi e date sono gli stessi in
+// tutti i formati.
+func render(c *gin.Context, status int, obj any) {
+	mediaType := c.GetString(mediaTypeKey)
+	if mediaType == mediaHAL || mediaType == mediaJSONAPI {
+		var document any
+		if mediaType == mediaHAL {
+			document = toHAL(c, obj)
+		} else {
+			document = toJSONAPI(c, obj)
+		}
+		data, err := json.Marshal(document)
+		if err != nil {
+			abortWithError(c, &APIError{Code: codeInternalError, Err: err})
+			return
+		}
+		c.Data(status, mediaContentTypes[mediaType], data)
+		return
+	}
+
+	root := xmlRootName(reflect.TypeOf(obj))
+	obj = versioned(c, obj)
+
+	if mediaType == "" {
+		mediaType = mediaJSON
+	}
+	if _, projected := c.Get(projectionKey); mediaType == mediaJSON && !projected {
+		c.JSON(status, obj)
+		return
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeInternalError, Err: err})
+		return
+	}
+	value, err := decodeOrdered(data)
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeInternalError, Err: err})
+		return
+	}
+
+	value = project(c, value)
+
+	switch mediaType {
+	case mediaJSON:
+		data, err = json.Marshal(value)
+	case mediaXML:
+		data, err = encodeXML(value, root)
+	case mediaYAML:
+		data, err = yaml.Marshal(yamlNode(value))
+	case mediaMsgPack:
+		err = codec.NewEncoderBytes(&data, &codec.MsgpackHandle{BasicHandle: codec.BasicHandle{EncodeOptions: codec.EncodeOptions{Canonical: true}}}).Encode(plainValue(value))
+	case mediaCSV:
+		// l'intestazione di una lista vuota ha le stesse colonne degli elementi
+		header, _ := zeroElement(reflect.TypeOf(obj))
+		header, _ = project(c, header).(orderedObject)
+		data, err = encodeCSV(value, header)
+	}
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeInternalError, Err: err})
+		return
+	}
+	c.Data(status, mediaContentTypes[mediaType], data)
+}
+
+// orderedObject è un oggetto JSON che mantiene l'ordine dei campi
+type orderedObject []orderedField
+
+type orderedField struct {
+	key   string
+	value any
+}
+
+// MarshalJSON scrive i campi nell'ordine in cui sono stati letti o aggiunti
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered legge un valore JSON mantenendo l'ordine dei campi; i numeri restano json.Number
+func decodeOrdered(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeOrderedValue(dec)
+}
+
+func decodeOrderedValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		object := orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, orderedField{key.(string), value})
+		}
+		_, err = dec.Token()
+		return object, err
+	case json.Delim('['):
+		array := []any{}
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = dec.Token()
+		return array, err
+	}
+	return tok, nil
+}
+
+// scalarText restituisce il testo di un valore JSON semplice
+func scalarText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(plainValue(value))
+	return string(data)
+}
+
+// plainValue converte un valore ordinato in mappe e slice semplici, per gli encoder che non conservano l'ordine
+func plainValue(value any) any {
+	switch v := value.(type) {
+	case orderedObject:
+		object := make(map[string]any, len(v))
+		for _, field := range v {
+			object[field.key] = plainValue(field.value)
+		}
+		return object
+	case []any:
+		array := make([]any, len(v))
+		for i, item := range v {
+			array[i] = plainValue(item)
+		}
+		return array
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// xmlRootName ricava l'elemento radice dal tipo: schemas.Item diventa item, []schemas.Item diventa items
+func xmlRootName(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "response"
+	}
+	if t.Kind() == reflect.Slice {
+		return pluralName(xmlRootName(t.Elem()))
+	}
+	if t.Kind() != reflect.Struct || t.Name() == "" {
+		return "response"
+	}
+
+	var name strings.Builder
+	for i, r := range t.Name() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+		name.WriteString(strings.ToLower(string(r)))
+	}
+	return name.String()
+}
+
+func pluralName(name string) string {
+	if strings.HasSuffix(name, "y") {
+		return strings.TrimSuffix(name, "y") + "ies"
+	}
+	return name + "s"
+}
+
+// singularName dà il nome agli elementi di una lista XML: tags contiene tag, items contiene item
+func singularName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return "item"
+}
+
+func encodeXML(value any, root string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := writeXMLElement(enc, root, value); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case orderedObject:
+		for _, field := range v {
+			if err := writeXMLElement(enc, field.key, field.value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		child := singularName(name)
+		for _, item := range v {
+			if err := writeXMLElement(enc, child, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if text := scalarText(v); text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// yamlNode costruisce il documento YAML mantenendo l'ordine dei campi; le stringhe
+// restano stringhe anche quando sembrano numeri, come i prezzi
+func yamlNode(value any) *yaml.Node {
+	switch v := value.(type) {
+	case orderedObject:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range v {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.key}, yamlNode(field.value))
+		}
+		return node
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case json.Number:
+		tag := "!!int"
+		if _, err := v.Int64(); err != nil {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: scalarText(value)}
+}
+
+// encodeCSV scrive una riga per elemento della lista (un oggetto singolo è una
+// lista di un elemento). Le colonne sono i campi JSON; le liste di valori semplici
+// sono unite da csvListSeparator, gli oggetti annidati restano in JSON. header dà
+// le colonne di una lista vuota.
+func encodeCSV(value any, header orderedObject) ([]byte, error) {
+	var rows []orderedObject
+	switch v := value.(type) {
+	case orderedObject:
+		rows = append(rows, v)
+	case []any:
+		for _, item := range v {
+			row, ok := item.(orderedObject)
+			if !ok {
+				row = orderedObject{{"value", item}}
+			}
+			rows = append(rows, row)
+		}
+	default:
+		rows = append(rows, orderedObject{{"value", value}})
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	addColumns := func(row orderedObject) {
+		for _, field := range row {
+			if !seen[field.key] {
+				seen[field.key] = true
+				columns = append(columns, field.key)
+			}
+		}
+	}
+	for _, row := range rows {
+		addColumns(row)
+	}
+	if len(rows) == 0 {
+		// Una lista vuota ha comunque l'intestazione, ricavata dal tipo degli elementi
+		addColumns(header)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if len(columns) > 0 {
+		w.Write(columns)
+	}
+	for _, row := range rows {
+		values := map[string]any{}
+		for _, field := range row {
+			values[field.key] = field.value
+		}
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvCell(values[column])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvCell(value any) string {
+	array, ok := value.([]any)
+	if !ok {
+		return scalarText(value)
+	}
+	cells := make([]string, len(array))
+	for i, item := range array {
+		if _, nested := item.(orderedObject); nested {
+			return scalarText(value)
+		}
+		cells[i] = scalarText(item)
+	}
+	return strings.Join(cells, csvListSeparator)
+}
+
+// zeroElement restituisce i campi JSON di un elemento vuoto della lista di tipo t
+func zeroElement(t reflect.Type) (orderedObject, bool) {
+	if t == nil || t.Kind() != reflect.Slice {
+		return nil, false
+	}
+	data, err := json.Marshal(reflect.Zero(t.Elem()).Interface())
+	if err != nil {
+		return nil, false
+	}
+	value, err := decodeOrdered(data)
+	if err != nil {
+		return nil, false
+	}
+	object, ok := value.(orderedObject)
+	return object, ok
+}
+
+// bindBody legge il body nel formato indicato da Content-Type e lo valida come
+// bindJSON. YAML e MessagePack hanno tipi propri e vengono convertiti in JSON;
+// XML e CSV contengono solo testo, che viene convertito seguendo i tipi di obj.
+func bindBody(c *gin.Context, obj any) ([]schemas.FieldError, error) {
+	mediaType := mediaJSON
+	if contentType := c.ContentType(); contentType != "" {
+		mediaType = contentType
+		if alias, found := mediaAliases[mediaType]; found {
+			mediaType = alias
+		}
+	}
+	// un body HAL è JSON: i campi _links ed _embedded vengono ignorati
+	if mediaType == mediaJSON || mediaType == mediaHAL {
+		return bindJSON(c, obj)
+	}
+
+	var decode func([]byte, reflect.Type) ([]byte, error)
+	switch mediaType {
+	case mediaYAML:
+		decode = yamlToJSON
+	case mediaMsgPack:
+		decode = msgpackToJSON
+	case mediaXML:
+		decode = xmlToJSON
+	case mediaCSV:
+		decode = csvToJSON
+	case mediaJSONAPI:
+		decode = jsonapiToJSON
+	default:
+		return nil, &APIError{Code: codeUnsupportedMediaType, Detail: localize(c, msgUnsupportedBody, mediaType, strings.Join(mediaTypes, ", "))}
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, &APIError{Code: codeMalformedBody, Detail: err.Error()}
+	}
+	data, err := decode(body, reflect.TypeOf(obj).Elem())
+	if err != nil {
+		return nil, &APIError{Code: codeMalformedBody, Detail: err.Error()}
+	}
+	if err := binding.JSON.BindBody(data, obj); err != nil {
+		return fieldErrorsFrom(c, err)
+	}
+	return nil, nil
+}
+
+func yamlToJSON(body []byte, _ reflect.Type) ([]byte, error) {
+	var value any
+	if err := yaml.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func msgpackToJSON(body []byte, _ reflect.Type) ([]byte, error) {
+	handle := &codec.MsgpackHandle{}
+	handle.MapType = reflect.TypeOf(map[string]any(nil))
+	handle.RawToString = true
+
+	var value any
+	if err := codec.NewDecoderBytes(body, handle).Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// textField è il valore testuale di un campo letto da XML o CSV
+type textField struct {
+	text  string
+	items []string
+	list  bool
+}
+
+// xmlToJSON legge un elemento con un figlio per campo, come quelli prodotti da render:
+// i campi lista contengono un elemento per valore (<tags><tag>a</tag></tags>)
+func xmlToJSON(body []byte, t reflect.Type) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	fields := map[string]textField{}
+	depth := 0
+	var field string
+	var current textField
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 2:
+				field, current = tok.Name.Local, textField{}
+			case 3:
+				current.list = true
+				current.items = append(current.items, "")
+			case 4:
+				return nil, errors.New("xml: nested elements are not supported")
+			}
+		case xml.CharData:
+			switch depth {
+			case 2:
+				current.text += string(tok)
+			case 3:
+				current.items[len(current.items)-1] += string(tok)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				current.text = strings.TrimSpace(current.text)
+				fields[field] = current
+			}
+			depth--
+		}
+	}
+	if depth != 0 || len(fields) == 0 && len(bytes.TrimSpace(body)) == 0 {
+		return nil, errors.New("xml: empty document")
+	}
+	return typedJSON(fields, t)
+}
+
+// csvToJSON legge un'intestazione e una sola riga, nel formato prodotto da render
+func csvToJSON(body []byte, t reflect.Type) ([]byte, error) {
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 2 {
+		return nil, errors.New("csv: the body must contain a header and exactly one row")
+	}
+
+	fields := map[string]textField{}
+	for i, column := range records[0] {
+		fields[strings.TrimSpace(column)] = textField{text: records[1][i]}
+	}
+	return typedJSON(fields, t)
+}
+
+// typedJSON converte i campi testuali nei tipi dei campi di t; un testo che non
+// corrisponde al tipo produce un JSON che la decodifica rifiuta come malformed_body
+func typedJSON(fields map[string]textField, t reflect.Type) ([]byte, error) {
+	object := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		name := jsonFieldName(structField)
+		field, found := fields[name]
+		if !found {
+			continue
+		}
+
+		if structField.Type.Kind() == reflect.Slice {
+			items := field.items
+			if !field.list {
+				items = nil
+				if field.text != "" {
+					items = strings.Split(field.text, csvListSeparator)
+				}
+			}
+			values := make([]any, len(items))
+			for j, item := range items {
+				values[j] = typedText(structField.Type.Elem(), item)
+			}
+			object[name] = values
+		} else if field.text != "" {
+			object[name] = typedText(structField.Type, field.text)
+		}
+	}
+	return json.Marshal(object)
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func typedText(t reflect.Type, text string) any {
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		// Tipi come Price interpretano da sé la stringa
+		return text
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	}
+	return text
+}
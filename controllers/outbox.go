@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/repository"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// itemStream è lo stream Redis su cui vengono pubblicati gli eventi dell'outbox
+	itemStream = "items:stream"
+	// itemStreamMaxLen limita, in modo approssimato, la lunghezza dello stream
+	itemStreamMaxLen = 100000
+	outboxBatch      = 100
+
+	// cacheInvalidationGroup è il consumer group che invalida la cache degli items
+	cacheInvalidationGroup = "cache-invalidation"
+	streamReadBlock        = time.Second
+)
+
+// outboxClaimIdle è dopo quanto un evento non confermato da un consumer viene
+// riassegnato: il consumer potrebbe essersi fermato prima di fare XACK
+var outboxClaimIdle = 30 * time.Second
+
+// SetOutboxClaimIdle imposta dopo quanto gli eventi non confermati vengono riconsegnati
+func SetOutboxClaimIdle(idle time.Duration) {
+	if idle > 0 {
+		outboxClaimIdle = idle
+	}
+}
+
+// RelayOutbox pubblica sullo stream gli eventi dell'outbox non ancora pubblicati
+// e restituisce quanti ne ha pubblicati. Un evento viene segnato come pubblicato
+// solo dopo XADD, quindi dopo un crash può essere pubblicato due volte ma mai perso:
+// i consumer riconoscono i duplicati dal campo seq.
+func RelayOutbox() (int, error) {
+	published := 0
+	for {
+		events, err := itemRepo.PendingEvents(outboxBatch)
+		if err != nil {
+			return published, err
+		}
+		if len(events) == 0 {
+			return published, nil
+		}
+
+		var lastSeq int64
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			err := rdb.XAdd(&redis.XAddArgs{
+				Stream:       itemStream,
+				MaxLenApprox: itemStreamMaxLen,
+				Values: map[string]interface{}{
+					"seq":     event.Seq,
+					"type":    event.Type,
+					"item_id": event.ItemID,
+					"event":   data,
+				},
+			}).Err()
+			if err != nil {
+				// Gli eventi già aggiunti allo stream non vengono ripubblicati
+				if lastSeq > 0 {
+					itemRepo.MarkPublished(lastSeq)
+				}
+				return published, err
+			}
+			lastSeq = event.Seq
+			published++
+		}
+		if err := itemRepo.MarkPublished(lastSeq); err != nil {
+			return published, err
+		}
+	}
+}
+
+// StartOutboxRelay avvia la pubblicazione periodica dell'outbox, finché ctx non viene cancellato
+func StartOutboxRelay(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := RelayOutbox(); err != nil {
+					log.Printf("Errore nella pubblicazione dell'outbox: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// StartCacheInvalidator consuma lo stream nel consumer group della cache e
+// invalida le chiavi degli items modificati, anche da altre repliche, insieme
+// alla categoria che l'item aveva prima e a quella che ha dopo. Gli eventi
+// vengono confermati solo dopo l'invalidazione.
+func StartCacheInvalidator(ctx context.Context, consumer string) error {
+	return consumeItemStream(ctx, cacheInvalidationGroup, consumer, func(event repository.Event) error {
+		keys := itemCacheKeys(strconv.Itoa(event.ItemID), "all")
+		categoryIDs := []int{event.PreviousCategoryID}
+		if event.Item != nil && event.Item.CategoryID != event.PreviousCategoryID {
+			categoryIDs = append(categoryIDs, event.Item.CategoryID)
+		}
+		for _, categoryID := range categoryIDs {
+			if categoryID != 0 {
+				keys = append(keys, categoryCachePrefix+strconv.Itoa(categoryID)+":items")
+			}
+		}
+		return rdb.Del(keys...).Err()
+	})
+}
+
+// consumeItemStream legge lo stream come membro del consumer group indicato.
+// All'avvio rilegge gli eventi ricevuti e non confermati; periodicamente si
+// prende gli eventi rimasti non confermati da più di outboxClaimIdle.
+func consumeItemStream(ctx context.Context, group, consumer string, handle func(repository.Event) error) error {
+	err := rdb.XGroupCreateMkStream(itemStream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	process := func(messages []redis.XMessage) {
+		for _, msg := range messages {
+			var event repository.Event
+			data, _ := msg.Values["event"].(string)
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				// Un messaggio illeggibile non diventerà mai leggibile: viene scartato
+				rdb.XAck(itemStream, group, msg.ID)
+				continue
+			}
+			if err := handle(event); err != nil {
+				// Resta pendente e verrà riconsegnato
+				continue
+			}
+			rdb.XAck(itemStream, group, msg.ID)
+		}
+	}
+
+	go func() {
+		// Prima rilegge gli eventi già ricevuti da questo consumer e non confermati
+		readPending, pendingFrom := true, "0"
+		lastClaim := time.Now()
+		for ctx.Err() == nil {
+			if time.Since(lastClaim) >= outboxClaimIdle {
+				process(claimStaleMessages(group, consumer))
+				lastClaim = time.Now()
+			}
+
+			args := &redis.XReadGroupArgs{Group: group, Consumer: consumer, Streams: []string{itemStream, ">"}, Count: outboxBatch, Block: streamReadBlock}
+			if readPending {
+				args.Streams[1] = pendingFrom
+				args.Block = -1
+			}
+			streams, err := rdb.XReadGroup(args).Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				log.Printf("Errore nella lettura dello stream %s: %v", itemStream, err)
+				time.Sleep(streamReadBlock)
+				continue
+			}
+
+			received := 0
+			for _, stream := range streams {
+				received += len(stream.Messages)
+				process(stream.Messages)
+				if len(stream.Messages) > 0 {
+					pendingFrom = stream.Messages[len(stream.Messages)-1].ID
+				}
+			}
+			if received < outboxBatch {
+				readPending = false
+			}
+		}
+	}()
+	return nil
+}
+
+// claimStaleMessages si assegna gli eventi che nessun consumer ha confermato in tempo
+func claimStaleMessages(group, consumer string) []redis.XMessage {
+	pending, err := rdb.XPendingExt(&redis.XPendingExtArgs{Stream: itemStream, Group: group, Start: "-", End: "+", Count: outboxBatch}).Result()
+	if err != nil {
+		return nil
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if p.Idle >= outboxClaimIdle {
+			ids = append(ids, p.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	messages, err := rdb.XClaim(&redis.XClaimArgs{Stream: itemStream, Group: group, Consumer: consumer, MinIdle: outboxClaimIdle, Messages: ids}).Result()
+	if err != nil {
+		return nil
+	}
+	return messages
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func GetPing(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	render(c, http.StatusOK, gin.H{
 		"message": "pong",
 	})
 }
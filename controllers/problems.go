@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codici di errore stabili, esposti nel campo "code" dei problem
+const (
+	codeItemNotFound          = "item_not_found"
+	codeItemNameConflict      = "item_name_conflict"
+	codeRevisionNotFound      = "revision_not_found"
+	codeRevisionNotRevertible = "revision_not_revertible"
+	codeAttachmentNotFound    = "attachment_not_found"
+	codeAttachmentTooLarge    = "attachment_too_large"
+	codeUnsupportedMediaType  = "unsupported_media_type"
+	codeNotAcceptable         = "not_acceptable"
+	codeCategoryNotFound      = "category_not_found"
+	codeCategoryNotEmpty      = "category_not_empty"
+	codeWebhookNotFound       = "webhook_not_found"
+	codeImportNotFound        = "import_not_found"
+	codeImportTooLarge        = "import_too_large"
+	codeJobNotFound           = "job_not_found"
+	codeJobFinished           = "job_finished"
+	codeRouteNotFound         = "route_not_found"
+	codeMissingParameter      = "missing_parameter"
+	codeInvalidParameter      = "invalid_parameter"
+	codeMalformedBody         = "malformed_body"
+	codeValidationFailed      = "validation_failed"
+	codeIdempotencyKeyReused  = "idempotency_key_reused"
+	codeIdempotencyInProgress = "idempotency_in_progress"
+	codeIdempotencyKeyExpired = "idempotency_key_expired"
+	codeCacheError            = "cache_error"
+	codeStorageError          = "storage_error"
+	codeInternalError         = "internal_error"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "/problems/"
+)
+
+// problemCatalog associa ogni codice di errore al suo status HTTP
+var problemCatalog = []struct {
+	code   string
+	status int
+}{
+	{codeItemNotFound, http.StatusNotFound},
+	{codeItemNameConflict, http.StatusConflict},
+	{codeRevisionNotFound, http.StatusNotFound},
+	{codeRevisionNotRevertible, http.StatusUnprocessableEntity},
+	{codeAttachmentNotFound, http.StatusNotFound},
+	{codeAttachmentTooLarge, http.StatusRequestEntityTooLarge},
+	{codeUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{codeNotAcceptable, http.StatusNotAcceptable},
+	{codeCategoryNotFound, http.StatusNotFound},
+	{codeCategoryNotEmpty, http.StatusConflict},
+	{codeWebhookNotFound, http.StatusNotFound},
+	{codeImportNotFound, http.StatusNotFound},
+	{codeImportTooLarge, http.StatusRequestEntityTooLarge},
+	{codeJobNotFound, http.StatusNotFound},
+	{codeJobFinished, http.StatusConflict},
+	{codeRouteNotFound, http.StatusNotFound},
+	{codeMissingParameter, http.StatusBadRequest},
+	{codeInvalidParameter, http.StatusBadRequest},
+	{codeMalformedBody, http.StatusBadRequest},
+	{codeValidationFailed, http.StatusUnprocessableEntity},
+	{codeIdempotencyKeyReused, http.StatusUnprocessableEntity},
+	{codeIdempotencyInProgress, http.StatusConflict},
+	{codeIdempotencyKeyExpired, http.StatusConflict},
+	{codeCacheError, http.StatusInternalServerError},
+	{codeStorageError, http.StatusInternalServerError},
+	{codeInternalError, http.StatusInternalServerError},
+}
+
+// APIError è l'unico tipo di errore restituito dagli handler
+type APIError struct {
+	Code   string
+	Detail string
+	Errors []schemas.FieldError
+	// Err è la causa interna: viene loggata ma mai mostrata al client
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func problemStatus(code string) int {
+	for _, p := range problemCatalog {
+		if p.code == code {
+			return p.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// abortWithError registra l'errore sul context e interrompe la catena; la risposta viene scritta da ErrorHandler
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// ErrorHandler trasforma l'ultimo errore registrato dagli handler in una risposta
+// application/problem+json, o negli error object JSON:API se il client li ha chiesti
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Code: codeInternalError, Err: err}
+		}
+		if apiErr.Err != nil {
+			log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, apiErr)
+		}
+
+		status := problemStatus(apiErr.Code)
+		// chi ha chiesto JSON:API riceve gli error object della specifica
+		if c.GetString(mediaTypeKey) == mediaJSONAPI {
+			body, _ := json.Marshal(jsonapiErrors(c, apiErr, status))
+			c.Data(status, mediaJSONAPI, body)
+			return
+		}
+		problem := schemas.Problem{
+			Type:     problemTypePrefix + apiErr.Code,
+			Title:    localize(c, "title_"+apiErr.Code),
+			Status:   status,
+			Detail:   apiErr.Detail,
+			Instance: c.Request.URL.RequestURI(),
+			Code:     apiErr.Code,
+			Errors:   apiErr.Errors,
+		}
+		body, _ := json.Marshal(problem)
+		c.Data(status, problemContentType, body)
+	}
+}
+
+// NoRoute risponde con un problem alle rotte inesistenti
+func NoRoute(c *gin.Context) {
+	abortWithError(c, &APIError{Code: codeRouteNotFound, Detail: c.Request.Method + " " + c.Request.URL.Path})
+}
+
+// @Summary List error codes
+// @Description Retrieve the catalog of machine-readable error codes used in problem+json responses
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Success 200 {array} schemas.ProblemType
+// @Router /problems [get]
+func GetProblemTypes(c *gin.Context) {
+	types := make([]schemas.ProblemType, 0, len(problemCatalog))
+	for _, p := range problemCatalog {
+		types = append(types, problemType(c, p.code, p.status))
+	}
+	render(c, http.StatusOK, types)
+}
+
+// @Summary Get error code
+// @Description Retrieve the description of a single error code; this is the target of the problem "type" URI
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param code path string true "Error code"
+// @Success 200 {object} schemas.ProblemType
+// @Failure 404 {object} schemas.Problem
+// @Router /problems/{code} [get]
+func GetProblemType(c *gin.Context) {
+	code := c.Param("code")
+	for _, p := range problemCatalog {
+		if p.code == code {
+			render(c, http.StatusOK, problemType(c, p.code, p.status))
+			return
+		}
+	}
+	abortWithError(c, &APIError{Code: codeRouteNotFound, Detail: c.Request.URL.Path})
+}
+
+func problemType(c *gin.Context, code string, status int) schemas.ProblemType {
+	return schemas.ProblemType{
+		Code:   code,
+		Type:   problemTypePrefix + code,
+		Title:  localize(c, "title_"+code),
+		Status: status,
+	}
+}
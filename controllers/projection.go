@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"gin-try/schemas"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// projectionKey è la chiave del context con i campi scelti da fields
+const projectionKey = "projection"
+
+// parseProjection legge fields (es. fields=id,name) e lo controlla con i campi della
+// versione richiesta; la proiezione viene applicata da render. In Redis ogni
+// proiezione ha una voce propria con i soli campi che servono (vedi cacheFields),
+// mentre per le cache HTTP fields fa parte dell'URL.
+func parseProjection(c *gin.Context) error {
+	raw, found := c.GetQuery("fields")
+	if !found {
+		return nil
+	}
+
+	var itemType reflect.Type = reflect.TypeOf(schemas.Item{})
+	if apiVersion(c) >= 2 {
+		itemType = reflect.TypeOf(schemas.ItemV2{})
+	}
+	var allowed []string
+	for i := 0; i < itemType.NumField(); i++ {
+		allowed = append(allowed, jsonFieldName(itemType.Field(i)))
+	}
+
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(allowed, field) {
+			return &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidFormat, "fields", strings.Join(allowed, ", "))}
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	c.Set(projectionKey, fields)
+	return nil
+}
+
+// project tiene solo i campi scelti con fields di un item o di ogni item di una
+// lista, nell'ordine della rappresentazione; senza fields value resta invariato
+func project(c *gin.Context, value any) any {
+	fields, ok := c.Value(projectionKey).([]string)
+	if !ok {
+		return value
+	}
+
+	switch v := value.(type) {
+	case orderedObject:
+		projected := orderedObject{}
+		for _, field := range v {
+			if slices.Contains(fields, field.key) {
+				projected = append(projected, field)
+			}
+		}
+		return projected
+	case []any:
+		projected := make([]any, len(v))
+		for i, item := range v {
+			projected[i] = project(c, item)
+		}
+		return projected
+	}
+	return value
+}
+
+// projectionSources sono i campi di schemas.Item da cui la versione 2 ricava i
+// campi che non esistono nella versione 1
+var projectionSources = map[string]string{"in_stock": "quantity", "category": "category_id"}
+
+// cacheFields restituisce, in ordine, i campi di schemas.Item che servono alla
+// proiezione richiesta, id e category_id compresi per i link HAL (vedi itemLinks);
+// nil se la risposta usa l'item intero, anche per JSON:API che ha le sue sparse fieldsets
+func cacheFields(c *gin.Context) []string {
+	fields, ok := c.Value(projectionKey).([]string)
+	if !ok || c.GetString(mediaTypeKey) == mediaJSONAPI {
+		return nil
+	}
+
+	sources := []string{"category_id", "id"}
+	for _, field := range fields {
+		if source, found := projectionSources[field]; found {
+			field = source
+		}
+		if !slices.Contains(sources, field) {
+			sources = append(sources, field)
+		}
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// projectionsKey è l'hash con le varianti proiettate della voce key, una per
+// insieme di campi: il prefisso non si sovrappone a nessuna voce degli items
+func projectionsKey(key string) string {
+	return cachePrefix + "fields:" + strings.TrimPrefix(key, cachePrefix)
+}
+
+// itemCacheKeys restituisce le chiavi da eliminare per invalidare le voci degli
+// items indicate (es. "all" o un ID), varianti proiettate comprese
+func itemCacheKeys(names ...string) []string {
+	var keys []string
+	for _, name := range names {
+		keys = append(keys, cachePrefix+name, projectionsKey(cachePrefix+name))
+	}
+	return keys
+}
+
+// getCachedItems legge la voce key della cache degli items, o la sua variante con i soli fields
+func getCachedItems(key string, fields []string) (string, error) {
+	if fields == nil {
+		return rdb.Get(key).Result()
+	}
+	return rdb.HGet(projectionsKey(key), strings.Join(fields, ",")).Result()
+}
+
+// setCachedItems salva un item o una lista di items nella voce key, o nella sua
+// variante con i soli fields
+func setCachedItems(key string, fields []string, value any, expiration time.Duration) {
+	data, _ := json.Marshal(value)
+	if fields == nil {
+		rdb.Set(key, data, expiration)
+		return
+	}
+
+	keep := func(item map[string]json.RawMessage) {
+		for field := range item {
+			if !slices.Contains(fields, field) {
+				delete(item, field)
+			}
+		}
+	}
+	var items []map[string]json.RawMessage
+	if json.Unmarshal(data, &items) == nil {
+		for _, item := range items {
+			keep(item)
+		}
+		data, _ = json.Marshal(items)
+	} else {
+		var item map[string]json.RawMessage
+		json.Unmarshal(data, &item)
+		keep(item)
+		data, _ = json.Marshal(item)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(projectionsKey(key), strings.Join(fields, ","), data)
+	pipe.Expire(projectionsKey(key), expiration)
+	pipe.Exec()
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import "github.com/gin-gonic/gin"
+
+// RegisterAPIRoutes registra le rotte REST, che rispondono nel formato scelto da
+// Negotiate e nella versione scelta da APIVersion. Stream, WebSocket, GraphQL,
+// export e download degli allegati hanno un formato proprio: vedi RegisterStreamRoutes.
+func RegisterAPIRoutes(api *gin.RouterGroup) {
+	api.GET("/ping", GetPing)
+	api.GET("/problems", GetProblemTypes)
+	api.GET("/problems/:code", GetProblemType)
+
+	api.GET("/items", GetItems)
+	api.POST("/items", Idempotency(), CreateItem)
+	api.GET("/items/search", SearchItemsByName)
+	api.GET("/items/trash", GetTrash)
+	api.POST("/items/import", ImportItems)
+	api.GET("/items/import/:id", GetImportJob)
+	api.POST("/items/:id/restore", RestoreItem)
+	api.GET("/items/:id/history", GetItemHistory)
+	api.POST("/items/:id/history/:revision/revert", RevertItem)
+	api.POST("/items/:id/attachments", UploadAttachment)
+	api.GET("/items/:id/attachments", GetAttachments)
+	api.DELETE("/items/:id/attachments/:attachmentId", DeleteAttachment)
+	api.GET("/items/:id", GetItemsByID)
+	api.DELETE("/items/:id", DeleteItem)
+	api.PUT("/items/:id", UpdatedItem)
+
+	api.GET("/categories", GetCategories)
+	api.POST("/categories", CreateCategory)
+	api.GET("/categories/:id", GetCategoryByID)
+	api.PUT("/categories/:id", UpdateCategory)
+	api.DELETE("/categories/:id", DeleteCategory)
+	api.GET("/categories/:id/items", GetCategoryItems)
+
+	api.POST("/jobs", CreateJob)
+	api.GET("/jobs/:id", GetJob)
+	api.POST("/jobs/:id/cancel", CancelJob)
+
+	api.GET("/webhooks", GetWebhooks)
+	api.POST("/webhooks", CreateWebhook)
+	api.GET("/webhooks/:id", GetWebhookByID)
+	api.PUT("/webhooks/:id", UpdateWebhook)
+	api.DELETE("/webhooks/:id", DeleteWebhook)
+	api.GET("/webhooks/:id/deliveries", GetWebhookDeliveries)
+	api.GET("/webhooks/:id/dead-letters", GetWebhookDeadLetters)
+}
+
+// RegisterStreamRoutes registra stream, WebSocket, GraphQL, export e download degli
+// allegati, che hanno un formato proprio e uguale in ogni versione. Vanno registrate
+// anche sotto i prefissi di versione: altrimenti /v1/items/export finirebbe su /v1/items/:id.
+func RegisterStreamRoutes(api *gin.RouterGroup) {
+	api.GET("/items/export", ExportItems)
+	api.GET("/items/events", GetItemEvents)
+	api.GET("/items/ws", SubscribeItems)
+	api.GET("/items/:id/attachments/:attachmentId", DownloadAttachment)
+
+	api.POST("/graphql", PostGraphQL)
+	api.GET("/graphql", GraphQLSubscriptions)
+}
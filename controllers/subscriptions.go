@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/schemas"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// itemEventsChannel è il canale Redis su cui ogni replica pubblica le modifiche agli items
+	itemEventsChannel = "items:events"
+
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+var subscribers = &subscriptionHub{clients: map[changeListener]struct{}{}}
+
+// itemChange è ciò che viaggia su Redis: Before serve alle sottoscrizioni per
+// nome, per avvisare anche quando un item smette di corrispondere
+type itemChange struct {
+	Event  schemas.ItemEvent `json:"event"`
+	Before *schemas.Item     `json:"before,omitempty"`
+}
+
+// itemFilter seleziona gli items di una sottoscrizione; senza filtri li seleziona tutti
+type itemFilter struct {
+	itemID int
+	search string
+}
+
+func (f itemFilter) matches(change itemChange) bool {
+	for _, item := range []*schemas.Item{change.Event.Item, change.Before} {
+		if item == nil {
+			continue
+		}
+		switch {
+		case f.itemID != 0:
+			if item.ID == f.itemID {
+				return true
+			}
+		case f.search != "":
+			if itemNameMatches(item.Name, f.search) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// changeListener riceve le modifiche agli items: un WebSocket delle sottoscrizioni
+// o una subscription GraphQL
+type changeListener interface {
+	deliver(change itemChange)
+}
+
+// subscriptionHub tiene i listener attivi su questa replica
+type subscriptionHub struct {
+	mu      sync.RWMutex
+	clients map[changeListener]struct{}
+}
+
+func (h *subscriptionHub) add(client changeListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[client] = struct{}{}
+}
+
+func (h *subscriptionHub) remove(client changeListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, client)
+}
+
+func (h *subscriptionHub) dispatch(change itemChange) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients {
+		client.deliver(change)
+	}
+}
+
+// wsClient è una connessione WebSocket con le sue sottoscrizioni, indicizzate per ID
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan schemas.SubscriptionMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	filters   map[string]itemFilter
+}
+
+func newWSClient(conn *websocket.Conn) *wsClient {
+	return &wsClient{
+		conn:    conn,
+		send:    make(chan schemas.SubscriptionMessage, subscriberBuffer),
+		done:    make(chan struct{}),
+		filters: map[string]itemFilter{},
+	}
+}
+
+func (w *wsClient) deliver(change itemChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, filter := range w.filters {
+		if filter.matches(change) {
+			event := change.Event
+			w.enqueue(schemas.SubscriptionMessage{Type: schemas.MessageEvent, ID: id, Event: &event})
+		}
+	}
+}
+
+func (w *wsClient) enqueue(msg schemas.SubscriptionMessage) {
+	select {
+	case w.send <- msg:
+	case <-w.done:
+	default:
+		// Il client non sta al passo: la connessione viene chiusa e dovrà riconnettersi
+		w.close()
+	}
+}
+
+func (w *wsClient) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.conn.Close()
+	})
+}
+
+// @Summary Subscribe to item changes over WebSocket
+// @Description Open a WebSocket and send {"type": "subscribe", "id": "..."} messages to receive the changes to all items, to a single item (item_id) or to the items whose name contains a term (search). Every change is pushed as an event message carrying the subscription id; {"type": "unsubscribe", "id": "..."} stops a subscription. Changes made on any replica are delivered
+// @Param Upgrade header string true "websocket"
+// @Success 101 {object} schemas.SubscriptionMessage "Switching Protocols"
+// @Router /items/ws [get]
+func SubscribeItems(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// L'upgrader ha già risposto al client
+		return
+	}
+
+	client := newWSClient(conn)
+	subscribers.add(client)
+	defer subscribers.remove(client)
+	defer client.close()
+
+	go client.writeLoop()
+	client.readLoop(c)
+}
+
+// readLoop gestisce i messaggi del client finché la connessione resta aperta
+func (w *wsClient) readLoop(c *gin.Context) {
+	w.conn.SetReadLimit(wsMaxMessageSize)
+	w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	w.conn.SetPongHandler(func(string) error {
+		return w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req schemas.SubscriptionRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			w.replyError("", codeMalformedBody, localize(c, msgMalformedMessage))
+			continue
+		}
+		w.handle(c, req)
+	}
+}
+
+func (w *wsClient) handle(c *gin.Context, req schemas.SubscriptionRequest) {
+	switch req.Type {
+	case schemas.MessageSubscribe:
+		if req.ID == "" {
+			w.replyError("", codeMissingParameter, localize(c, msgMissingSubscriptionID))
+			return
+		}
+		if req.ItemID != 0 && req.Search != "" {
+			w.replyError(req.ID, codeInvalidParameter, localize(c, msgInvalidSubscription))
+			return
+		}
+		w.mu.Lock()
+		w.filters[req.ID] = itemFilter{itemID: req.ItemID, search: req.Search}
+		w.enqueue(schemas.SubscriptionMessage{Type: schemas.MessageSubscribed, ID: req.ID})
+		w.mu.Unlock()
+	case schemas.MessageUnsubscribe:
+		w.mu.Lock()
+		delete(w.filters, req.ID)
+		w.enqueue(schemas.SubscriptionMessage{Type: schemas.MessageUnsubscribed, ID: req.ID})
+		w.mu.Unlock()
+	default:
+		w.replyError(req.ID, codeInvalidParameter, localize(c, msgUnknownMessageType, req.Type))
+	}
+}
+
+func (w *wsClient) replyError(id, code, detail string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.enqueue(schemas.SubscriptionMessage{Type: schemas.MessageError, ID: id, Code: code, Detail: detail})
+}
+
+// writeLoop è l'unica goroutine che scrive sulla connessione
+func (w *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	defer w.close()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case msg := <-w.send:
+			w.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := w.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// StartItemEventRelay inoltra ai listener di questa replica le modifiche
+// pubblicate su Redis da tutte le repliche, finché ctx non viene cancellato
+func StartItemEventRelay(ctx context.Context) error {
+	pubsub := rdb.Subscribe(itemEventsChannel)
+	// Attende la conferma, così nessuna modifica successiva va persa
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	messages := pubsub.Channel()
+	go func() {
+		defer pubsub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var change itemChange
+				if err := json.Unmarshal([]byte(msg.Payload), &change); err == nil {
+					subscribers.dispatch(change)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// relayItemChange pubblica la modifica su Redis; se Redis non risponde almeno i
+// listener di questa replica ricevono l'evento
+func relayItemChange(change itemChange) {
+	data, _ := json.Marshal(change)
+	if err := rdb.Publish(itemEventsChannel, data).Err(); err != nil {
+		subscribers.dispatch(change)
+	}
+}
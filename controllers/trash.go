@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var trashRetention = 30 * 24 * time.Hour
+
+// SetTrashRetention imposta per quanto tempo un item eliminato resta nel cestino
+func SetTrashRetention(retention time.Duration) {
+	if retention > 0 {
+		trashRetention = retention
+	}
+}
+
+// @Summary List deleted items
+// @Description Retrieve the items in the trash, most recently deleted first
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Success 200 {array} schemas.Item
+// @Router /items/trash [get]
+func GetTrash(c *gin.Context) {
+	render(c, http.StatusOK, getTrashFromSource())
+}
+
+// @Summary Restore a deleted item
+// @Description Move an item out of the trash. If its category has been deleted in the meantime the item is restored without category
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Item ID"
+// @Param X-Actor header string false "Who is performing the change"
+// @Success 200 {object} schemas.Item
+// @Failure 404 {object} schemas.Problem "item_not_found"
+// @Failure 409 {object} schemas.Problem "item_name_conflict"
+// @Router /items/{id}/restore [post]
+func RestoreItem(c *gin.Context) {
+	id := c.Param("id")
+
+	item := getTrashedItemFromSource(id)
+	if item == nil {
+		abortWithError(c, &APIError{Code: codeItemNotFound, Detail: localize(c, msgItemNotInTrash)})
+		return
+	}
+	if itemNameTaken(item.Name, item.ID) {
+		abortWithError(c, &APIError{Code: codeItemNameConflict, Detail: localize(c, msgRestoreNameTaken, item.Name)})
+		return
+	}
+
+	trashed := *item
+	if item.CategoryID != 0 && getCategoryFromSourceByID(strconv.Itoa(item.CategoryID)) == nil {
+		item.CategoryID = 0
+	}
+	item.DeletedAt = nil
+	item.UpdatedAt = time.Now().UTC()
+	if err := restoreItemInSource(*item); errors.Is(err, repository.ErrNameTaken) {
+		abortWithError(c, &APIError{Code: codeItemNameConflict, Detail: localize(c, msgRestoreNameTaken, item.Name)})
+		return
+	} else if err != nil {
+		abortWithError(c, &APIError{Code: codeStorageError, Err: err})
+		return
+	}
+
+	// Invalida la cache di tutti gli items e della sua categoria
+	rdb.Del(itemCacheKeys("all")...)
+	invalidateCategoryItems(item.CategoryID)
+
+	recordRevision(c, schemas.ActionRestore, &trashed, item)
+
+	render(c, http.StatusOK, item)
+}
+
+// PurgeTrash elimina definitivamente gli items rimasti nel cestino oltre la retention
+// e restituisce quanti ne ha rimossi
+func PurgeTrash(now time.Time) (int, error) {
+	purged, err := purgeTrashFromSource(now.Add(-trashRetention))
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range purged {
+		rdb.Del(itemCacheKeys(strconv.Itoa(id))...)
+		// Gli allegati vengono eliminati solo insieme all'item, non quando finisce nel cestino
+		if err := deleteItemAttachments(id); err != nil {
+			return 0, err
+		}
+	}
+	return len(purged), nil
+}
+
+// StartTrashPurger avvia in background la pulizia periodica del cestino, fino alla cancellazione di ctx
+func StartTrashPurger(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				n, err := PurgeTrash(now)
+				if err != nil {
+					log.Printf("Cestino: errore durante la pulizia: %v", err)
+				} else if n > 0 {
+					log.Printf("Cestino: eliminati definitivamente %d items", n)
+				}
+			}
+		}
+	}()
+}
+
+// Funzioni per interagire con il cestino della sorgente dati
+func getTrashFromSource() []schemas.Item {
+	items := []schemas.Item{}
+	for _, item := range itemRepo.List() {
+		if item.DeletedAt != nil {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(*items[j].DeletedAt)
+	})
+	return items
+}
+
+func getTrashedItemFromSource(id string) *schemas.Item {
+	for _, item := range itemRepo.List() {
+		if strconv.Itoa(item.ID) == id && item.DeletedAt != nil {
+			return &item
+		}
+	}
+	return nil
+}
+
+// restoreItemInSource sostituisce lo stato dell'item, anche se è nel cestino
+func restoreItemInSource(restored schemas.Item) error {
+	return itemRepo.Update(restored)
+}
+
+func purgeTrashFromSource(deletedBefore time.Time) ([]int, error) {
+	var purged []int
+	for _, item := range itemRepo.List() {
+		if item.DeletedAt != nil && item.DeletedAt.Before(deletedBefore) {
+			purged = append(purged, item.ID)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	return purged, itemRepo.Purge(purged)
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"gin-try/schemas"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// itemNamePattern ammette lettere, cifre, spazi e poca punteggiatura; il nome deve iniziare con una lettera o una cifra
+var itemNamePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} _.,'()&-]*$`)
+
+func init() {
+	// Registra le regole personalizzate sul validator usato dal binding di gin
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+		v.RegisterValidation("itemname", func(fl validator.FieldLevel) bool {
+			return itemNamePattern.MatchString(fl.Field().String())
+		})
+		registerTranslations(v)
+	}
+}
+
+// jsonFieldName fa sì che gli errori riportino il nome del campo JSON e non quello Go
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" || name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// bindJSON legge il body JSON in obj e converte gli errori del validator in FieldError
+func bindJSON(c *gin.Context, obj any) ([]schemas.FieldError, error) {
+	var fieldErrors []schemas.FieldError
+
+	if err := c.ShouldBindJSON(obj); err != nil {
+		return fieldErrorsFrom(c, err)
+	}
+	return fieldErrors, nil
+}
+
+// validateStruct valida obj con le stesse regole del binding, per input che non arrivano come body JSON
+func validateStruct(c *gin.Context, obj any) ([]schemas.FieldError, error) {
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return fieldErrorsFrom(c, err)
+	}
+	return nil, nil
+}
+
+// fieldErrorsFrom converte gli errori del validator in FieldError
+func fieldErrorsFrom(c *gin.Context, err error) ([]schemas.FieldError, error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil, &APIError{Code: codeMalformedBody, Detail: err.Error()}
+	}
+
+	var fieldErrors []schemas.FieldError
+	trans := translatorFor(c)
+	for _, fe := range validationErrors {
+		fieldErrors = append(fieldErrors, schemas.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return fieldErrors, nil
+}
+
+// checkIDMatches segnala un id nel body diverso da quello dell'URL
+func checkIDMatches(c *gin.Context, fieldErrors []schemas.FieldError, bodyID, pathID int) []schemas.FieldError {
+	if pathID != 0 && bodyID != 0 && bodyID != pathID {
+		fieldErrors = append(fieldErrors, schemas.FieldError{
+			Field:   "id",
+			Rule:    "readonly",
+			Message: localize(c, msgIDMismatch, "id"),
+		})
+	}
+	return fieldErrors
+}
+
+// validationFailed costruisce l'errore 422, nil se non ci sono errori
+func validationFailed(c *gin.Context, fieldErrors []schemas.FieldError) error {
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return &APIError{
+		Code:   codeValidationFailed,
+		Detail: localize(c, msgValidationFailed),
+		Errors: fieldErrors,
+	}
+}
+
+// bindItem legge e valida il body nel formato indicato da Content-Type. excludeID è
+// l'item da ignorare nel controllo di unicità del nome (0 in creazione).
+func bindItem(c *gin.Context, item *schemas.Item, excludeID int) error {
+	fieldErrors, err := bindBody(c, item)
+	if err != nil {
+		return err
+	}
+	return checkItem(c, item, excludeID, checkIDMatches(c, fieldErrors, item.ID, excludeID))
+}
+
+// validateItem valida un item che non arriva come body JSON (GraphQL, gRPC); inputErrors
+// sono gli errori già trovati convertendo l'input, ad esempio un prezzo non valido
+func validateItem(c *gin.Context, item *schemas.Item, excludeID int, inputErrors []schemas.FieldError) error {
+	fieldErrors, err := validateStruct(c, item)
+	if err != nil {
+		return err
+	}
+	return checkItem(c, item, excludeID, append(fieldErrors, inputErrors...))
+}
+
+// invalidPrice è l'errore di un prezzo che ParsePrice non accetta
+func invalidPrice(c *gin.Context) schemas.FieldError {
+	return schemas.FieldError{
+		Field:   "price",
+		Rule:    "decimal",
+		Message: localize(c, msgInvalidPrice, "price"),
+	}
+}
+
+// checkItem aggiunge i controlli che dipendono dai dati: nome unico e categoria esistente
+func checkItem(c *gin.Context, item *schemas.Item, excludeID int, fieldErrors []schemas.FieldError) error {
+	if item.Name != "" && itemNameTaken(item.Name, excludeID) {
+		fieldErrors = append(fieldErrors, nameTakenError(c))
+	}
+
+	if item.CategoryID != 0 && getCategoryFromSourceByID(strconv.Itoa(item.CategoryID)) == nil {
+		fieldErrors = append(fieldErrors, schemas.FieldError{
+			Field:   "category_id",
+			Rule:    "exists",
+			Message: localize(c, msgUnknownCategory, "category_id"),
+		})
+	}
+
+	return validationFailed(c, fieldErrors)
+}
+
+// bindCategory legge e valida il body JSON di una categoria
+func bindCategory(c *gin.Context, category *schemas.Category, excludeID int) error {
+	fieldErrors, err := bindJSON(c, category)
+	if err != nil {
+		return err
+	}
+	fieldErrors = checkIDMatches(c, fieldErrors, category.ID, excludeID)
+
+	if category.Name != "" && categoryNameTaken(category.Name, excludeID) {
+		fieldErrors = append(fieldErrors, schemas.FieldError{
+			Field:   "name",
+			Rule:    "unique",
+			Message: localize(c, msgCategoryNameTaken, "name"),
+		})
+	}
+
+	return validationFailed(c, fieldErrors)
+}
+
+// bindWebhook legge e valida il body JSON di un webhook
+func bindWebhook(c *gin.Context, webhook *schemas.Webhook, excludeID int) error {
+	fieldErrors, err := bindJSON(c, webhook)
+	if err != nil {
+		return err
+	}
+	fieldErrors = checkIDMatches(c, fieldErrors, webhook.ID, excludeID)
+
+	if webhook.URL != "" && !slices.ContainsFunc(fieldErrors, func(fe schemas.FieldError) bool { return fe.Field == "url" }) &&
+		!publicWebhookURL(webhook.URL) {
+		fieldErrors = append(fieldErrors, schemas.FieldError{
+			Field:   "url",
+			Rule:    "public_url",
+			Message: localize(c, msgPrivateWebhookURL, "url"),
+		})
+	}
+
+	return validationFailed(c, fieldErrors)
+}
+
+// normalizeItem ripulisce i campi liberi: spazi superflui e tag duplicati
+func normalizeItem(item *schemas.Item) {
+	item.Name = strings.TrimSpace(item.Name)
+	item.Description = strings.TrimSpace(item.Description)
+
+	tags := make([]string, 0, len(item.Tags))
+	seen := map[string]bool{}
+	for _, tag := range item.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	item.Tags = tags
+}
+
+// itemNameTaken controlla, senza distinguere maiuscole e minuscole, se il nome è già in uso
+func itemNameTaken(name string, excludeID int) bool {
+	return itemRepo.NameTaken(name, excludeID)
+}
+
+// nameTakenError è l'errore di un nome già usato da un altro item
+func nameTakenError(c *gin.Context) schemas.FieldError {
+	return schemas.FieldError{
+		Field:   "name",
+		Rule:    "unique",
+		Message: localize(c, msgNameTaken, "name"),
+	}
+}
+
+// parseItemID converte l'id del path, 0 se non è un intero
+func parseItemID(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return n
+}
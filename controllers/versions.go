@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"gin-try/schemas"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// apiVersionHeader sceglie la versione sulle rotte senza prefisso e riporta quella usata
+	apiVersionHeader = "API-Version"
+	apiVersionKey    = "apiVersion"
+	apiPrefixKey     = "apiPrefix"
+	latestAPIVersion = 2
+)
+
+// apiDeprecation indica da quando una versione è deprecata e quando smetterà di
+// essere servita; una data zero non viene annunciata
+type apiDeprecation struct {
+	at     time.Time
+	sunset time.Time
+}
+
+// apiDeprecations contiene le date configurate per versione: di default nessuna versione è deprecata
+var apiDeprecations = map[int]apiDeprecation{}
+
+// SetAPIDeprecation cambia la data dalla quale una versione è deprecata; con la data zero non lo è
+func SetAPIDeprecation(version int, at time.Time) {
+	deprecation := apiDeprecations[version]
+	deprecation.at = at
+	apiDeprecations[version] = deprecation
+}
+
+// SetAPISunset cambia la data dopo la quale una versione non sarà più servita; con la data zero non viene annunciata
+func SetAPISunset(version int, sunset time.Time) {
+	deprecation := apiDeprecations[version]
+	deprecation.sunset = sunset
+	apiDeprecations[version] = deprecation
+}
+
+// APIVersion sceglie la versione dell'API per le rotte del gruppo. Con version 0
+// (le rotte senza prefisso) la versione arriva dall'header API-Version ed è 1 se
+// manca, così i client esistenti continuano a ricevere gli stessi dati.
+func APIVersion(version int) gin.HandlerFunc {
+	prefix := ""
+	if version != 0 {
+		prefix = "/v" + strconv.Itoa(version)
+	}
+
+	return func(c *gin.Context) {
+		selected := version
+		if selected == 0 {
+			c.Writer.Header().Add("Vary", apiVersionHeader)
+			selected = 1
+			if value := c.GetHeader(apiVersionHeader); value != "" {
+				parsed, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(value), "v"))
+				if err != nil || parsed < 1 || parsed > latestAPIVersion {
+					abortWithError(c, &APIError{Code: codeInvalidParameter, Detail: localize(c, msgInvalidFormat, apiVersionHeader, "1, 2")})
+					return
+				}
+				selected = parsed
+			}
+		}
+		c.Set(apiVersionKey, selected)
+		c.Set(apiPrefixKey, prefix)
+
+		c.Header(apiVersionHeader, strconv.Itoa(selected))
+		// Deprecation e Sunset come da RFC 9745 e RFC 8594
+		deprecation := apiDeprecations[selected]
+		if !deprecation.at.IsZero() {
+			c.Header("Deprecation", "@"+strconv.FormatInt(deprecation.at.Unix(), 10))
+			successor := "/v" + strconv.Itoa(latestAPIVersion) + strings.TrimPrefix(c.Request.URL.Path, prefix)
+			c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		if !deprecation.sunset.IsZero() {
+			c.Header("Sunset", deprecation.sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Next()
+	}
+}
+
+// apiVersion restituisce la versione scelta da APIVersion, 1 fuori dalle rotte versionate
+func apiVersion(c *gin.Context) int {
+	if version := c.GetInt(apiVersionKey); version != 0 {
+		return version
+	}
+	return 1
+}
+
+// apiPath aggiunge a path il prefisso di versione della richiesta, per gli URL
+// restituiti al client (es. Location)
+func apiPath(c *gin.Context, path string) string {
+	return c.GetString(apiPrefixKey) + path
+}
+
+// versioned converte gli items nella rappresentazione della versione richiesta;
+// gli altri valori sono uguali in tutte le versioni
+func versioned(c *gin.Context, obj any) any {
+	if apiVersion(c) < 2 {
+		return obj
+	}
+
+	switch v := obj.(type) {
+	case schemas.Item:
+		return toItemV2(v, categoryRefs())
+	case *schemas.Item:
+		if v != nil {
+			return toItemV2(*v, categoryRefs())
+		}
+	case []schemas.Item:
+		refs := categoryRefs()
+		items := make([]schemas.ItemV2, 0, len(v))
+		for _, item := range v {
+			items = append(items, toItemV2(item, refs))
+		}
+		return items
+	}
+	return obj
+}
+
+// categoryRefs indicizza le categorie per ID, per convertire una lista di items senza cercarle ogni volta
+func categoryRefs() map[int]*schemas.CategoryRef {
+	refs := map[int]*schemas.CategoryRef{}
+	for _, category := range getCategoriesFromSource() {
+		refs[category.ID] = &schemas.CategoryRef{ID: category.ID, Name: category.Name}
+	}
+	return refs
+}
+
+func toItemV2(item schemas.Item, refs map[int]*schemas.CategoryRef) schemas.ItemV2 {
+	return schemas.ItemV2{
+		ID:          item.ID,
+		Name:        item.Name,
+		Description: item.Description,
+		Tags:        item.Tags,
+		Price:       item.Price,
+		Quantity:    item.Quantity,
+		InStock:     item.Quantity > 0,
+		Category:    refs[item.CategoryID],
+		CreatedAt:   item.CreatedAt,
+		UpdatedAt:   item.UpdatedAt,
+		DeletedAt:   item.DeletedAt,
+	}
+}
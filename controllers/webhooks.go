@@ -0,0 +1,596 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-try/schemas"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+// Header inviati con ogni consegna
+const (
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookEventHeader     = "X-Webhook-Event"
+)
+
+const (
+	webhookPrefix = "webhooks:"
+	// webhooksKey è l'hash Redis delle sottoscrizioni, con l'ID come campo: tutte le
+	// repliche vedono gli stessi webhooks e un riavvio non li perde
+	webhooksKey  = "webhooks"
+	webhookIDKey = webhookPrefix + "last-id"
+	// webhookSchedule è il sorted set delle consegne da tentare, con l'orario del
+	// tentativo in millisecondi come score
+	webhookSchedule = webhookPrefix + "schedule"
+	// webhookLease è per quanto un tentativo preso da una replica resta suo: se la
+	// replica si ferma prima di registrarne l'esito, un'altra lo ripete
+	webhookLease = time.Minute
+	// webhookBatch è quanti tentativi una replica prende alla volta
+	webhookBatch = 100
+	// maxDeliveryLog è quanti tentativi per webhook restano nel log delle consegne
+	maxDeliveryLog = 100
+	// maxDeadLetters è quanti eventi non consegnati per webhook vengono conservati
+	maxDeadLetters = 1000
+)
+
+var webhookClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: checkWebhookDial}).DialContext},
+}
+var webhookMaxAttempts = 5
+var webhookRetryDelay = time.Second
+var webhookPrivateTargets atomic.Bool
+
+// claimWebhookAttempts prende i tentativi scaduti spostandone l'orario alla fine
+// del lease, in un solo passo perché due repliche non prendano lo stesso
+var claimWebhookAttempts = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], member)
+end
+return due
+`)
+
+// webhookAttempt è un tentativo di consegna in attesa nel sorted set
+type webhookAttempt struct {
+	DeliveryID string            `json:"delivery_id"`
+	WebhookID  int               `json:"webhook_id"`
+	Event      schemas.ItemEvent `json:"event"`
+	Attempt    int               `json:"attempt"`
+}
+
+// SetWebhooks sostituisce il contenuto della sorgente dati dei webhooks
+func SetWebhooks(webhooks []schemas.Webhook) {
+	rdb.Del(webhooksKey, webhookIDKey, webhookSchedule)
+
+	maxID := 0
+	for _, webhook := range webhooks {
+		data, _ := json.Marshal(webhook)
+		rdb.HSet(webhooksKey, strconv.Itoa(webhook.ID), data)
+		maxID = max(maxID, webhook.ID)
+	}
+	rdb.Set(webhookIDKey, maxID, 0)
+}
+
+// SetWebhookRetries imposta il numero massimo di tentativi e l'attesa prima del
+// secondo; l'attesa raddoppia a ogni tentativo successivo
+func SetWebhookRetries(maxAttempts int, baseDelay time.Duration) {
+	if maxAttempts > 0 {
+		webhookMaxAttempts = maxAttempts
+	}
+	if baseDelay > 0 {
+		webhookRetryDelay = baseDelay
+	}
+}
+
+// SetWebhookPrivateTargets permette i webhooks verso indirizzi di loopback, privati
+// e link-local, normalmente rifiutati per non esporre la rete interna; serve solo
+// in sviluppo e nei test
+func SetWebhookPrivateTargets(allowed bool) {
+	webhookPrivateTargets.Store(allowed)
+}
+
+// @Summary Get all webhooks
+// @Description Retrieve every webhook subscription; secrets are not returned
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Success 200 {array} schemas.Webhook
+// @Router /webhooks [get]
+func GetWebhooks(c *gin.Context) {
+	webhooks := getWebhooksFromSource()
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	render(c, http.StatusOK, webhooks)
+}
+
+// @Summary Get webhook by ID
+// @Description Retrieve a webhook subscription by its ID; the secret is not returned
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} schemas.Webhook
+// @Failure 404 {object} schemas.Problem "webhook_not_found"
+// @Router /webhooks/{id} [get]
+func GetWebhookByID(c *gin.Context) {
+	webhook := getWebhookFromSourceByID(c.Param("id"))
+	if webhook == nil {
+		abortWithError(c, &APIError{Code: codeWebhookNotFound, Detail: localize(c, msgWebhookNotFound)})
+		return
+	}
+
+	webhook.Secret = ""
+	render(c, http.StatusOK, webhook)
+}
+
+// @Summary Create a webhook
+// @Description Subscribe a URL to item changes. Every delivery is a POST of the event signed with HMAC-SHA256: the X-Webhook-Signature header is "sha256=" followed by the hex HMAC of the X-Webhook-Timestamp header, a dot and the body. If no secret is sent one is generated; it is only returned in this response
+// @Accept json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param webhook body schemas.Webhook true "Webhook object"
+// @Success 201 {object} schemas.Webhook
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	var newWebhook schemas.Webhook
+	if err := bindWebhook(c, &newWebhook, 0); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if newWebhook.Secret == "" {
+		newWebhook.Secret = newRandomID() + newRandomID()
+	}
+	if newWebhook.Events == nil {
+		newWebhook.Events = []string{}
+	}
+	newWebhook.CreatedAt = time.Now().UTC()
+	newWebhook.UpdatedAt = newWebhook.CreatedAt
+	if err := saveWebhookToSource(&newWebhook); err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+
+	render(c, http.StatusCreated, newWebhook)
+}
+
+// @Summary Update a webhook by ID
+// @Description Replace the URL and the event filter of a webhook. The secret is rotated only if a new one is sent
+// @Accept json
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Webhook ID"
+// @Param webhook body schemas.Webhook true "Updated webhook object"
+// @Success 200 {object} schemas.Webhook
+// @Failure 400 {object} schemas.Problem "malformed_body"
+// @Failure 404 {object} schemas.Problem "webhook_not_found"
+// @Failure 422 {object} schemas.Problem "validation_failed"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /webhooks/{id} [put]
+func UpdateWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	var updatedWebhook schemas.Webhook
+	if err := bindWebhook(c, &updatedWebhook, parseItemID(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	existing := getWebhookFromSourceByID(id)
+	if existing == nil {
+		abortWithError(c, &APIError{Code: codeWebhookNotFound, Detail: localize(c, msgWebhookNotFound)})
+		return
+	}
+	updatedWebhook.ID = existing.ID
+	if updatedWebhook.Secret == "" {
+		updatedWebhook.Secret = existing.Secret
+	}
+	if updatedWebhook.Events == nil {
+		updatedWebhook.Events = []string{}
+	}
+	updatedWebhook.CreatedAt = existing.CreatedAt
+	updatedWebhook.UpdatedAt = time.Now().UTC()
+	if err := updateWebhookInSource(updatedWebhook); err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+
+	updatedWebhook.Secret = ""
+	render(c, http.StatusOK, updatedWebhook)
+}
+
+// @Summary Delete webhook by ID
+// @Description Delete a webhook subscription together with its delivery log and dead letters; pending retries are dropped
+// @Param id path int true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} schemas.Problem "webhook_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	deleted, err := deleteWebhookFromSource(id)
+	if err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	if !deleted {
+		abortWithError(c, &APIError{Code: codeWebhookNotFound, Detail: localize(c, msgWebhookNotFound)})
+		return
+	}
+	rdb.Del(webhookPrefix+id+":deliveries", webhookPrefix+id+":dead-letters")
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get the delivery log of a webhook
+// @Description Retrieve the most recent delivery attempts of a webhook, newest first
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Webhook ID"
+// @Success 200 {array} schemas.WebhookDelivery
+// @Failure 404 {object} schemas.Problem "webhook_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /webhooks/{id}/deliveries [get]
+func GetWebhookDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	if getWebhookFromSourceByID(id) == nil {
+		abortWithError(c, &APIError{Code: codeWebhookNotFound, Detail: localize(c, msgWebhookNotFound)})
+		return
+	}
+
+	deliveries := []schemas.WebhookDelivery{}
+	if err := readWebhookList(webhookPrefix+id+":deliveries", &deliveries); err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	render(c, http.StatusOK, deliveries)
+}
+
+// @Summary Get the dead letters of a webhook
+// @Description Retrieve the events that could not be delivered after the last retry, newest first
+// @Produce json,xml,application/yaml,application/msgpack,text/csv,application/hal+json,application/vnd.api+json
+// @Param id path int true "Webhook ID"
+// @Success 200 {array} schemas.DeadLetter
+// @Failure 404 {object} schemas.Problem "webhook_not_found"
+// @Failure 500 {object} schemas.Problem "cache_error"
+// @Router /webhooks/{id}/dead-letters [get]
+func GetWebhookDeadLetters(c *gin.Context) {
+	id := c.Param("id")
+	if getWebhookFromSourceByID(id) == nil {
+		abortWithError(c, &APIError{Code: codeWebhookNotFound, Detail: localize(c, msgWebhookNotFound)})
+		return
+	}
+
+	deadLetters := []schemas.DeadLetter{}
+	if err := readWebhookList(webhookPrefix+id+":dead-letters", &deadLetters); err != nil {
+		abortWithError(c, &APIError{Code: codeCacheError, Err: err})
+		return
+	}
+	render(c, http.StatusOK, deadLetters)
+}
+
+// readWebhookList decodifica una lista Redis di documenti JSON in target, che deve puntare a una slice
+func readWebhookList(key string, target interface{}) error {
+	values, err := rdb.LRange(key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	data := []byte("[")
+	for i, value := range values {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, value...)
+	}
+	data = append(data, ']')
+	return json.Unmarshal(data, target)
+}
+
+// dispatchWebhooks mette in programma la consegna dell'evento a ogni webhook
+// interessato; i tentativi li esegue StartWebhookDispatcher, su qualunque replica
+func dispatchWebhooks(event schemas.ItemEvent) {
+	for _, webhook := range getWebhooksFromSource() {
+		if webhookWants(webhook, event.Type) {
+			attempt := webhookAttempt{DeliveryID: newRandomID(), WebhookID: webhook.ID, Event: event, Attempt: 1}
+			if err := scheduleWebhookAttempt(rdb, attempt, time.Now()); err != nil {
+				log.Printf("webhook %d: %v", webhook.ID, err)
+			}
+		}
+	}
+}
+
+func webhookWants(webhook schemas.Webhook, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, wanted := range webhook.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func scheduleWebhookAttempt(client *redis.Client, attempt webhookAttempt, at time.Time) error {
+	data, _ := json.Marshal(attempt)
+	return client.ZAdd(webhookSchedule, redis.Z{Score: float64(at.UnixMilli()), Member: data}).Err()
+}
+
+// StartWebhookDispatcher esegue ogni interval i tentativi di consegna arrivati
+// all'orario previsto, finché ctx non viene cancellato. Il programma è in Redis:
+// i tentativi sopravvivono ai riavvii e ognuno viene eseguito da una sola replica.
+func StartWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	// Il programma usa sempre il client con cui il dispatcher è stato avviato
+	client := rdb
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := deliverDueWebhooks(client); err != nil && ctx.Err() == nil {
+					log.Printf("webhook schedule: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// deliverDueWebhooks prende i tentativi scaduti e li esegue in background
+func deliverDueWebhooks(client *redis.Client) error {
+	for {
+		now := time.Now()
+		result, err := claimWebhookAttempts.Run(client, []string{webhookSchedule},
+			now.UnixMilli(), now.Add(webhookLease).UnixMilli(), webhookBatch).Result()
+		if err != nil {
+			return err
+		}
+		due, _ := result.([]interface{})
+		for _, value := range due {
+			member, _ := value.(string)
+			var attempt webhookAttempt
+			if err := json.Unmarshal([]byte(member), &attempt); err != nil {
+				client.ZRem(webhookSchedule, member)
+				continue
+			}
+			go deliverWebhook(client, member, attempt)
+		}
+		if len(due) < webhookBatch {
+			return nil
+		}
+	}
+}
+
+// deliverWebhook esegue un tentativo e ne registra l'esito: se fallisce il
+// successivo viene programmato con attesa esponenziale, dopo l'ultimo l'evento
+// finisce nella lista dead-letter del webhook
+func deliverWebhook(client *redis.Client, member string, attempt webhookAttempt) {
+	// Il webhook può essere stato modificato o eliminato durante le attese
+	webhook, err := loadWebhook(client, strconv.Itoa(attempt.WebhookID))
+	if err != nil {
+		// Il lease scade e il tentativo viene ripetuto
+		log.Printf("webhook %d: %v", attempt.WebhookID, err)
+		return
+	}
+	if webhook == nil {
+		client.ZRem(webhookSchedule, member)
+		return
+	}
+
+	body, _ := json.Marshal(attempt.Event)
+	statusCode, err := postWebhook(webhook, attempt.DeliveryID, attempt.Event.Type, body)
+	delivery := schemas.WebhookDelivery{
+		ID:         attempt.DeliveryID,
+		WebhookID:  attempt.WebhookID,
+		EventID:    attempt.Event.ID,
+		EventType:  attempt.Event.Type,
+		Attempt:    attempt.Attempt,
+		Status:     schemas.DeliverySucceeded,
+		StatusCode: statusCode,
+		At:         time.Now().UTC(),
+	}
+	if err != nil {
+		delivery.Status = schemas.DeliveryFailed
+		if attempt.Attempt >= webhookMaxAttempts {
+			delivery.Status = schemas.DeliveryDead
+		}
+		delivery.Error = err.Error()
+	}
+
+	prefix := webhookPrefix + strconv.Itoa(attempt.WebhookID)
+	data, _ := json.Marshal(delivery)
+	pipe := client.TxPipeline()
+	pipe.LPush(prefix+":deliveries", data)
+	pipe.LTrim(prefix+":deliveries", 0, maxDeliveryLog-1)
+	pipe.ZRem(webhookSchedule, member)
+	if err != nil && attempt.Attempt < webhookMaxAttempts {
+		next := attempt
+		next.Attempt++
+		data, _ := json.Marshal(next)
+		delay := webhookRetryDelay << (attempt.Attempt - 1)
+		pipe.ZAdd(webhookSchedule, redis.Z{Score: float64(time.Now().Add(delay).UnixMilli()), Member: data})
+	} else if err != nil {
+		deadLetter, _ := json.Marshal(schemas.DeadLetter{
+			DeliveryID: attempt.DeliveryID,
+			WebhookID:  attempt.WebhookID,
+			Event:      attempt.Event,
+			Attempts:   attempt.Attempt,
+			LastError:  err.Error(),
+			FailedAt:   time.Now().UTC(),
+		})
+		pipe.LPush(prefix+":dead-letters", deadLetter)
+		pipe.LTrim(prefix+":dead-letters", 0, maxDeadLetters-1)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("webhook %d: %v", attempt.WebhookID, err)
+	}
+}
+
+// postWebhook invia una consegna firmata; le risposte diverse da 2xx sono errori
+func postWebhook(webhook *schemas.Webhook, deliveryID, eventType string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, eventType)
+	req.Header.Set(webhookDeliveryHeader, deliveryID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook calcola la firma di una consegna: i destinatari la ricalcolano
+// con lo stesso secret e la confrontano con l'header X-Webhook-Signature
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errPrivateWebhookTarget è il rifiuto di una connessione verso la rete interna
+var errPrivateWebhookTarget = errors.New("webhook target is a loopback, private or link-local address")
+
+// privateAddress indica gli indirizzi che un webhook non può raggiungere
+func privateAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
+
+// publicWebhookURL controlla, risolvendo il nome, che l'URL di un webhook non porti
+// alla rete interna. Il controllo viene ripetuto alla connessione da
+// checkWebhookDial, perché il DNS può cambiare dopo la creazione.
+func publicWebhookURL(rawURL string) bool {
+	if webhookPrivateTargets.Load() {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return !privateAddress(addr)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip", u.Hostname())
+	if err != nil {
+		// Un nome che non si risolve ora non è un indirizzo interno; le consegne
+		// falliranno finché non si risolve
+		return true
+	}
+	for _, addr := range addrs {
+		if privateAddress(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookDial rifiuta le connessioni delle consegne verso la rete interna
+func checkWebhookDial(_, address string, _ syscall.RawConn) error {
+	if webhookPrivateTargets.Load() {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if privateAddress(addrPort.Addr()) {
+		return errPrivateWebhookTarget
+	}
+	return nil
+}
+
+// Funzioni per interagire con la sorgente dati dei webhooks
+func getWebhooksFromSource() []schemas.Webhook {
+	values, err := rdb.HVals(webhooksKey).Result()
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+
+	webhooks := []schemas.Webhook{}
+	for _, value := range values {
+		var webhook schemas.Webhook
+		if err := json.Unmarshal([]byte(value), &webhook); err == nil {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks
+}
+
+func getWebhookFromSourceByID(id string) *schemas.Webhook {
+	webhook, err := loadWebhook(rdb, id)
+	if err != nil {
+		log.Printf("webhook %s: %v", id, err)
+	}
+	return webhook
+}
+
+func loadWebhook(client *redis.Client, id string) (*schemas.Webhook, error) {
+	val, err := client.HGet(webhooksKey, id).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var webhook schemas.Webhook
+	if err := json.Unmarshal([]byte(val), &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// saveWebhookToSource assegna l'ID, con un contatore condiviso dalle repliche, e salva il webhook
+func saveWebhookToSource(webhook *schemas.Webhook) error {
+	id, err := rdb.Incr(webhookIDKey).Result()
+	if err != nil {
+		return err
+	}
+	webhook.ID = int(id)
+	return updateWebhookInSource(*webhook)
+}
+
+func updateWebhookInSource(webhook schemas.Webhook) error {
+	data, _ := json.Marshal(webhook)
+	return rdb.HSet(webhooksKey, strconv.Itoa(webhook.ID), data).Err()
+}
+
+func deleteWebhookFromSource(id string) (bool, error) {
+	n, err := rdb.HDel(webhooksKey, id).Result()
+	return n > 0, err
+}
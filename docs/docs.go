@@ -15,42 +15,60 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/items": {
+        "/categories": {
             "get": {
-                "description": "Retrieve a list of all items",
+                "description": "Retrieve a list of all categories",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
                 ],
-                "summary": "Get all items",
+                "summary": "Get all categories",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/schemas.Item"
+                                "$ref": "#/definitions/schemas.Category"
                             }
                         }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
                     }
                 }
             },
             "post": {
-                "description": "Create a new item with the provided JSON data",
+                "description": "Create a new category with the provided JSON data",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
                 ],
-                "summary": "Create a new item",
+                "summary": "Create a new category",
                 "parameters": [
                     {
-                        "description": "Item object",
-                        "name": "item",
+                        "description": "Category object",
+                        "name": "category",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/schemas.Item"
+                            "$ref": "#/definitions/schemas.Category"
                         }
                     }
                 ],
@@ -58,52 +76,184 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/schemas.Item"
+                            "$ref": "#/definitions/schemas.Category"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
                         }
                     }
                 }
             }
         },
-        "/items/search": {
+        "/categories/{id}": {
             "get": {
-                "description": "Retrieve items whose name contains the specified string",
+                "description": "Retrieve a category by its ID",
                 "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get category by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Category ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Category"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update a category by its ID with the provided JSON data",
+                "consumes": [
                     "application/json"
                 ],
-                "summary": "Search items by name",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Update a category by ID",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Item name to search",
-                        "name": "name",
-                        "in": "query",
+                        "type": "integer",
+                        "description": "Category ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Updated category object",
+                        "name": "category",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Category"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/schemas.Item"
-                            }
+                            "$ref": "#/definitions/schemas.Category"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a category by its ID. Depending on the server configuration a category that still has items is either refused (restrict) or deleted together with its items (cascade)",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Delete category by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Category ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "category_not_empty",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
                         }
                     }
                 }
             }
         },
-        "/items/{id}": {
+        "/categories/{id}/items": {
             "get": {
-                "description": "Retrieve an item by its ID",
+                "description": "Retrieve all items that belong to a category",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
                 ],
-                "summary": "Get item by ID",
+                "summary": "Get the items of a category",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Item ID",
+                        "description": "Category ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -113,30 +263,202 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/schemas.Item"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Item"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql": {
+            "get": {
+                "description": "Open a WebSocket with the graphql-transport-ws subprotocol: after connection_init/connection_ack, every subscribe message runs an operation and its results are pushed as next messages, followed by complete. The itemChanged subscription receives the changes made on any replica, optionally filtered by itemId or by a search term",
+                "summary": "Run GraphQL subscriptions over WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "websocket",
+                        "name": "Upgrade",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "graphql-transport-ws",
+                        "name": "Sec-WebSocket-Protocol",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.GraphQLWSMessage"
                         }
                     }
                 }
             },
-            "put": {
-                "description": "Update an item by its ID with the provided JSON data",
+            "post": {
+                "description": "Run a query (item, items with cursor pagination and search) or a mutation (createItem, updateItem, deleteItem) against the same store and cache as the REST endpoints. Resolver errors carry the problem code in extensions.code. Subscriptions are served over WebSocket by GET /graphql",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Update an item by ID",
+                "summary": "Execute a GraphQL operation",
+                "parameters": [
+                    {
+                        "description": "GraphQL operation",
+                        "name": "operation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.GraphQLRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.GraphQLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items": {
+            "get": {
+                "description": "Retrieve a list of all items, or the list as it was at the instant given by as_of; page and per_page split it into pages linked from the Link header",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get all items",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "RFC3339 instant in the past, e.g. 2024-06-07T18:00:00Z",
+                        "name": "as_of",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields to return, e.g. id,name",
+                        "name": "fields",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "Item ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Page number, starting from 1",
+                        "name": "page",
+                        "in": "query"
                     },
                     {
-                        "description": "Updated item object",
+                        "type": "integer",
+                        "description": "Items per page, at most 100 (default 20 when page is set)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Item"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error, storage_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new item; the body can be JSON, XML, YAML, MessagePack or a CSV header plus one row",
+                "consumes": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/vnd.api+json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Create a new item",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key that makes retries of the same request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Item object",
                         "name": "item",
                         "in": "body",
                         "required": true,
@@ -146,48 +468,2104 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
                             "$ref": "#/definitions/schemas.Item"
                         }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "not_acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_in_progress, idempotency_key_expired",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed, idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete an item by its ID",
+            }
+        },
+        "/items/events": {
+            "get": {
+                "description": "Server-Sent Events stream with one created, updated or deleted event for every change to an item. Reconnecting with Last-Event-ID replays the events missed in the meantime; if some of them are no longer available a reset event is sent first and the client should reload the items",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
-                "summary": "Delete item by ID",
+                "summary": "Stream item changes",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Item ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Same as the Last-Event-ID header, for clients that cannot set headers",
+                        "name": "last_event_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "One event per change",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.ItemEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "schemas.Item": {
+        },
+        "/items/export": {
+            "get": {
+                "description": "Stream every item, or the items whose name contains name, as NDJSON (default), CSV or a JSON array.\nThe format is chosen with the Accept header or the format parameter. The response is sent in chunks while the items are read, so it can be as large as the catalog.",
+                "produces": [
+                    "application/x-ndjson",
+                    "text/csv",
+                    "application/json"
+                ],
+                "summary": "Export all items",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only items whose name contains this string, as in /items/search",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "ndjson",
+                            "csv",
+                            "json"
+                        ],
+                        "type": "string",
+                        "description": "Format of the file, instead of the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Item"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "not_acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/import": {
+            "post": {
+                "description": "Create items from a CSV file (a header row, tags separated by \";\") or from NDJSON (one item per line).\nThe file is validated row by row by a queued job that any replica can run: rows with errors are skipped and reported in the import, whose progress is available at the Location URL.\nThe job has the same ID as the import and can be canceled with POST /jobs/{id}/cancel.",
+                "consumes": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Import items",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Validate the rows without saving them",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.ImportJob"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the import status"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_parameter, malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "import_too_large",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "storage_error, cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/import/{id}": {
+            "get": {
+                "description": "Retrieve the progress and the row errors of an import started with POST /items/import",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get the status of an import",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.ImportJob"
+                        }
+                    },
+                    "404": {
+                        "description": "import_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/search": {
+            "get": {
+                "description": "Retrieve items whose name contains the specified string",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Search items by name",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Item name to search",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields to return, e.g. id,name",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items per page, at most 100 (default 20 when page is set)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Item"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "missing_parameter, invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/trash": {
+            "get": {
+                "description": "Retrieve the items in the trash, most recently deleted first",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "List deleted items",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Item"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/items/ws": {
+            "get": {
+                "description": "Open a WebSocket and send {\"type\": \"subscribe\", \"id\": \"...\"} messages to receive the changes to all items, to a single item (item_id) or to the items whose name contains a term (search). Every change is pushed as an event message carrying the subscription id; {\"type\": \"unsubscribe\", \"id\": \"...\"} stops a subscription. Changes made on any replica are delivered",
+                "summary": "Subscribe to item changes over WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "websocket",
+                        "name": "Upgrade",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.SubscriptionMessage"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}": {
+            "get": {
+                "description": "Retrieve an item by its ID, or its state at the instant given by as_of",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get item by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 instant in the past, e.g. 2024-06-07T18:00:00Z",
+                        "name": "as_of",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields to return, e.g. id,name",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Item"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error, storage_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update an item by its ID; the body can be JSON, XML, YAML, MessagePack or a CSV header plus one row",
+                "consumes": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/vnd.api+json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Update an item by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Updated item object",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Item"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Item"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "not_acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Move an item to the trash; it can be restored until the trash retention expires",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Delete item by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}/attachments": {
+            "get": {
+                "description": "Retrieve the metadata of every file attached to an item",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "List the attachments of an item",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Attachment"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Attach a photo or a PDF to an item. The type is detected from the content, not from the file name",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Upload an attachment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "File to attach",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Attachment"
+                        }
+                    },
+                    "400": {
+                        "description": "missing_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "attachment_too_large",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "storage_error, cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}/attachments/{attachmentId}": {
+            "get": {
+                "description": "Download the content of an attachment. Range requests are supported, so large files can be resumed",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Download an attachment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Attachment ID",
+                        "name": "attachmentId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found, attachment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "416": {
+                        "description": "Range Not Satisfiable"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a single attachment of an item",
+                "summary": "Delete an attachment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Attachment ID",
+                        "name": "attachmentId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "attachment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "storage_error, cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}/history": {
+            "get": {
+                "description": "Retrieve every revision of an item, oldest first, including the revisions recorded before it was deleted",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get the history of an item",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Revision"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}/history/{revision}/revert": {
+            "post": {
+                "description": "Bring an item back to the state recorded after the given revision. A deleted item is restored as part of the revert",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Revert an item to a revision",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Revision number",
+                        "name": "revision",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Item"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found, revision_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "item_name_conflict",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "revision_not_revertible",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/items/{id}/restore": {
+            "post": {
+                "description": "Move an item out of the trash. If its category has been deleted in the meantime the item is restored without category",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Restore a deleted item",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Item"
+                        }
+                    },
+                    "404": {
+                        "description": "item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "item_name_conflict",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "post": {
+                "description": "Queue a long-running operation: cache_warmup loads every item into the cache, reindex recomputes the cached searches from the items.\nAny replica can run the job; its state and progress are available at the Location URL",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Start a job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Who is performing the change",
+                        "name": "X-Actor",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Job to start, only the type is read",
+                        "name": "job",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Job"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the job"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}": {
+            "get": {
+                "description": "Retrieve the state and the progress of a job",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get a job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}/cancel": {
+            "post": {
+                "description": "A queued job is canceled at once; a running job stops at its next progress update, so the response is 202 and the job keeps running until then",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Cancel a job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Job"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "job_finished",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/problems": {
+            "get": {
+                "description": "Retrieve the catalog of machine-readable error codes used in problem+json responses",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "List error codes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.ProblemType"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/problems/{code}": {
+            "get": {
+                "description": "Retrieve the description of a single error code; this is the target of the problem \"type\" URI",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get error code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Error code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.ProblemType"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "Retrieve every webhook subscription; secrets are not returned",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get all webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.Webhook"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribe a URL to item changes. Every delivery is a POST of the event signed with HMAC-SHA256: the X-Webhook-Signature header is \"sha256=\" followed by the hex HMAC of the X-Webhook-Timestamp header, a dot and the body. If no secret is sent one is generated; it is only returned in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook object",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Webhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "description": "Retrieve a webhook subscription by its ID; the secret is not returned",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get webhook by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Webhook"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace the URL and the event filter of a webhook. The secret is rotated only if a new one is sent",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Update a webhook by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated webhook object",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Webhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a webhook subscription together with its delivery log and dead letters; pending retries are dropped",
+                "summary": "Delete webhook by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/dead-letters": {
+            "get": {
+                "description": "Retrieve the events that could not be delivered after the last retry, newest first",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get the dead letters of a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.DeadLetter"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Retrieve the most recent delivery attempts of a webhook, newest first",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "application/msgpack",
+                    "text/csv",
+                    "application/hal+json",
+                    "application/vnd.api+json"
+                ],
+                "summary": "Get the delivery log of a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/schemas.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "cache_error",
+                        "schema": {
+                            "$ref": "#/definitions/schemas.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "schemas.Attachment": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "type": "string",
+                    "example": "image/png"
+                },
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "file_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "item_id": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.Category": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt e UpdatedAt sono gestiti dal server",
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "description": {
+                    "type": "string",
+                    "maxLength": 1000
+                },
+                "id": {
+                    "description": "ID viene assegnato dal server, quello inviato dal client viene ignorato",
+                    "type": "integer",
+                    "readOnly": true
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "updated_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                }
+            }
+        },
+        "schemas.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "delivery_id": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/schemas.ItemEvent"
+                },
+                "failed_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.FieldChange": {
+            "type": "object",
+            "properties": {
+                "after": {},
+                "before": {},
+                "field": {
+                    "type": "string"
+                }
+            }
+        },
+        "schemas.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "schemas.GraphQLError": {
+            "type": "object",
+            "properties": {
+                "extensions": {
+                    "type": "object"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "schemas.GraphQLRequest": {
+            "type": "object",
+            "required": [
+                "query"
+            ],
+            "properties": {
+                "operationName": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "schemas.GraphQLResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "object"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.GraphQLError"
+                    }
+                }
+            }
+        },
+        "schemas.GraphQLWSMessage": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "connection_init",
+                        "connection_ack",
+                        "ping",
+                        "pong",
+                        "subscribe",
+                        "next",
+                        "error",
+                        "complete"
+                    ]
+                }
+            }
+        },
+        "schemas.ImportError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "enum": [
+                        "malformed_body",
+                        "validation_failed"
+                    ]
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.FieldError"
+                    }
+                },
+                "line": {
+                    "description": "Line è il numero di riga nel file, a partire da 1 (l'intestazione CSV è la riga 1)",
+                    "type": "integer"
+                }
+            }
+        },
+        "schemas.ImportJob": {
             "type": "object",
             "properties": {
+                "bytes_read": {
+                    "description": "BytesRead su BytesTotal è l'avanzamento dell'import",
+                    "type": "integer"
+                },
+                "bytes_total": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "dry_run": {
+                    "description": "DryRun indica un import che valida le righe senza salvarle",
+                    "type": "boolean"
+                },
+                "error": {
+                    "description": "Error è il motivo per cui l'import si è interrotto",
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors contiene le prime righe non valide; ErrorsTruncated indica che ce ne sono altre",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.ImportError"
+                    }
+                },
+                "errors_truncated": {
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "finished_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "format": {
+                    "type": "string",
+                    "enum": [
+                        "csv",
+                        "ndjson"
+                    ]
+                },
                 "id": {
+                    "type": "string"
+                },
+                "imported": {
+                    "type": "integer"
+                },
+                "processed": {
+                    "description": "Processed sono le righe lette; Imported quelle salvate, o che lo sarebbero in un dry run",
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "queued",
+                        "running",
+                        "completed",
+                        "failed",
+                        "canceled"
+                    ]
+                }
+            }
+        },
+        "schemas.Item": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "category_id": {
+                    "description": "CategoryID è opzionale, 0 indica un item senza categoria",
                     "type": "integer"
                 },
+                "created_at": {
+                    "description": "CreatedAt e UpdatedAt sono gestiti dal server",
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "deleted_at": {
+                    "description": "DeletedAt è valorizzato solo per gli items nel cestino",
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "description": {
+                    "type": "string",
+                    "maxLength": 1000
+                },
+                "id": {
+                    "description": "ID viene assegnato dal server, quello inviato dal client viene ignorato",
+                    "type": "integer",
+                    "readOnly": true
+                },
                 "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "price": {
+                    "type": "string",
+                    "minLength": 0,
+                    "example": "12.50"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "tags": {
+                    "type": "array",
+                    "maxItems": 20,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updated_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                }
+            }
+        },
+        "schemas.ItemEvent": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "id": {
+                    "description": "ID cresce a ogni evento e va rimandato come Last-Event-ID per riprendere lo stream",
+                    "type": "integer"
+                },
+                "item": {
+                    "$ref": "#/definitions/schemas.Item"
+                },
+                "item_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "created",
+                        "updated",
+                        "deleted"
+                    ]
+                }
+            }
+        },
+        "schemas.Job": {
+            "type": "object",
+            "required": [
+                "type"
+            ],
+            "properties": {
+                "cancel_requested": {
+                    "description": "CancelRequested indica un job in esecuzione che si fermerà al prossimo avanzamento",
+                    "type": "boolean",
+                    "readOnly": true
+                },
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "done": {
+                    "description": "Done su Total è l'avanzamento, nell'unità del job (items, ricerche o byte)",
+                    "type": "integer",
+                    "readOnly": true
+                },
+                "error": {
+                    "description": "Error è il motivo per cui il job non è stato completato",
+                    "type": "string",
+                    "readOnly": true
+                },
+                "finished_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "id": {
+                    "type": "string",
+                    "readOnly": true
+                },
+                "started_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "queued",
+                        "running",
+                        "completed",
+                        "failed",
+                        "canceled"
+                    ],
+                    "readOnly": true
+                },
+                "total": {
+                    "type": "integer",
+                    "readOnly": true
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "import",
+                        "cache_warmup",
+                        "reindex"
+                    ]
+                }
+            }
+        },
+        "schemas.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "enum": [
+                        "item_not_found",
+                        "item_name_conflict",
+                        "revision_not_found",
+                        "revision_not_revertible",
+                        "attachment_not_found",
+                        "attachment_too_large",
+                        "unsupported_media_type",
+                        "not_acceptable",
+                        "category_not_found",
+                        "category_not_empty",
+                        "webhook_not_found",
+                        "import_not_found",
+                        "import_too_large",
+                        "job_not_found",
+                        "job_finished",
+                        "route_not_found",
+                        "missing_parameter",
+                        "invalid_parameter",
+                        "malformed_body",
+                        "validation_failed",
+                        "idempotency_key_reused",
+                        "idempotency_in_progress",
+                        "idempotency_key_expired",
+                        "cache_error",
+                        "storage_error",
+                        "internal_error"
+                    ]
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/items/42"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Item not found"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "/problems/item_not_found"
+                }
+            }
+        },
+        "schemas.ProblemType": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
                     "type": "string"
                 }
             }
+        },
+        "schemas.Revision": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "enum": [
+                        "create",
+                        "update",
+                        "delete",
+                        "restore",
+                        "revert"
+                    ]
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "$ref": "#/definitions/schemas.Item"
+                },
+                "before": {
+                    "$ref": "#/definitions/schemas.Item"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/schemas.FieldChange"
+                    }
+                },
+                "item_id": {
+                    "type": "integer"
+                },
+                "reverted_to": {
+                    "description": "RevertedTo è la revisione ripristinata dalle azioni di tipo revert",
+                    "type": "integer"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "string",
+                    "format": "date-time"
+                }
+            }
+        },
+        "schemas.SubscriptionMessage": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/schemas.ItemEvent"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "subscribed",
+                        "unsubscribed",
+                        "event",
+                        "error"
+                    ]
+                }
+            }
+        },
+        "schemas.Webhook": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt e UpdatedAt sono gestiti dal server",
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "events": {
+                    "description": "Events limita le notifiche ai tipi indicati; vuoto significa tutti",
+                    "type": "array",
+                    "maxItems": 3,
+                    "items": {
+                        "type": "string",
+                        "enum": [
+                            "created",
+                            "updated",
+                            "deleted"
+                        ]
+                    }
+                },
+                "id": {
+                    "description": "ID viene assegnato dal server, quello inviato dal client viene ignorato",
+                    "type": "integer",
+                    "readOnly": true
+                },
+                "secret": {
+                    "description": "Secret firma le consegne; se manca in creazione viene generato dal server.\nViene restituito solo alla creazione.",
+                    "type": "string",
+                    "maxLength": 256,
+                    "minLength": 16
+                },
+                "updated_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "readOnly": true
+                },
+                "url": {
+                    "type": "string",
+                    "maxLength": 2048,
+                    "example": "https://example.com/hooks/items"
+                }
+            }
+        },
+        "schemas.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "attempt": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "integer"
+                },
+                "event_type": {
+                    "type": "string",
+                    "enum": [
+                        "created",
+                        "updated",
+                        "deleted"
+                    ]
+                },
+                "id": {
+                    "description": "ID è lo stesso per tutti i tentativi di consegna dello stesso evento",
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "succeeded",
+                        "failed",
+                        "dead"
+                    ]
+                },
+                "status_code": {
+                    "type": "integer"
+                },
+                "webhook_id": {
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
@@ -11,6 +15,7 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	"gin-try/controllers"
+	"gin-try/repository"
 
 	_ "gin-try/docs" // Importa il pacchetto docs generato da Swaggo per le docs sul brawser
 )
@@ -41,18 +46,181 @@ func main() {
 	log.Printf("Success!: %s", pong)
 	controllers.SetRedis(rdb)
 
+	// Finestra di validità delle Idempotency-Key (es. "24h")
+	if window := os.Getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("IDEMPOTENCY_WINDOW non valida: %v", err)
+		}
+		controllers.SetIdempotencyWindow(d)
+	}
+	// Per quanto tempo una richiesta in corso tiene prenotata la sua Idempotency-Key (es. "1m")
+	if lease := os.Getenv("IDEMPOTENCY_LEASE"); lease != "" {
+		d, err := time.ParseDuration(lease)
+		if err != nil {
+			log.Fatalf("IDEMPOTENCY_LEASE non valida: %v", err)
+		}
+		controllers.SetIdempotencyLease(d)
+	}
+
+	// Eliminazione delle categorie non vuote: "restrict" (default) o "cascade"
+	if mode := os.Getenv("CATEGORY_DELETE_MODE"); mode != "" {
+		if err := controllers.SetCategoryDeleteMode(mode); err != nil {
+			log.Fatalf("CATEGORY_DELETE_MODE non valida: %v", err)
+		}
+	}
+
+	// Data dalla quale la versione 1 dell'API è deprecata (es. "2026-10-19T00:00:00Z"); di default non lo è
+	if deprecation := os.Getenv("API_V1_DEPRECATION"); deprecation != "" {
+		t, err := time.Parse(time.RFC3339, deprecation)
+		if err != nil {
+			log.Fatalf("API_V1_DEPRECATION non valida: %v", err)
+		}
+		controllers.SetAPIDeprecation(1, t)
+	}
+
+	// Data dopo la quale la versione 1 dell'API non sarà più servita (es. "2027-04-19T00:00:00Z")
+	if sunset := os.Getenv("API_V1_SUNSET"); sunset != "" {
+		t, err := time.Parse(time.RFC3339, sunset)
+		if err != nil {
+			log.Fatalf("API_V1_SUNSET non valida: %v", err)
+		}
+		controllers.SetAPISunset(1, t)
+	}
+
+	// Sorgente dati degli items: in memoria (default) o log di eventi su disco
+	if os.Getenv("ITEM_STORE") == "eventlog" {
+		dir := os.Getenv("ITEM_STORE_DIR")
+		if dir == "" {
+			dir = "data"
+		}
+		snapshotEvery := 100
+		if every := os.Getenv("ITEM_SNAPSHOT_EVERY"); every != "" {
+			snapshotEvery, err = strconv.Atoi(every)
+			if err != nil {
+				log.Fatalf("ITEM_SNAPSHOT_EVERY non valida: %v", err)
+			}
+		}
+		repo, err := repository.OpenEventSourcedItemRepository(dir, snapshotEvery)
+		if err != nil {
+			log.Fatalf("Errore nell'apertura del log degli eventi: %v", err)
+		}
+		defer repo.Close()
+		controllers.SetItemRepository(repo)
+	}
+
+	// Allegati degli items salvati sul filesystem locale
+	attachmentsDir := os.Getenv("ATTACHMENTS_DIR")
+	if attachmentsDir == "" {
+		attachmentsDir = "data/attachments"
+	}
+	blobStore, err := repository.NewFileBlobStore(attachmentsDir)
+	if err != nil {
+		log.Fatalf("Errore nell'apertura della cartella degli allegati: %v", err)
+	}
+	controllers.SetBlobStore(blobStore)
+	if maxSize := os.Getenv("ATTACHMENT_MAX_SIZE"); maxSize != "" {
+		size, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil {
+			log.Fatalf("ATTACHMENT_MAX_SIZE non valida: %v", err)
+		}
+		controllers.SetAttachmentLimits(size, nil)
+	}
+
+	// Eventi recenti conservati per i client SSE che si riconnettono
+	if size := os.Getenv("EVENT_BUFFER_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			log.Fatalf("EVENT_BUFFER_SIZE non valida: %v", err)
+		}
+		controllers.SetEventBufferSize(n)
+	}
+
+	// Pulizia periodica del cestino (es. TRASH_RETENTION="720h")
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			log.Fatalf("TRASH_RETENTION non valida: %v", err)
+		}
+		controllers.SetTrashRetention(d)
+	}
+	controllers.StartTrashPurger(context.Background(), time.Hour)
+
+	// Inoltro ai WebSocket delle modifiche fatte da tutte le repliche
+	if err := controllers.StartItemEventRelay(context.Background()); err != nil {
+		log.Fatalf("Errore nella sottoscrizione al canale degli eventi: %v", err)
+	}
+
+	// Pubblicazione dell'outbox sullo stream Redis e invalidazione della cache a partire dallo stream
+	controllers.StartOutboxRelay(context.Background(), 500*time.Millisecond)
+	consumer, _ := os.Hostname()
+	if err := controllers.StartCacheInvalidator(context.Background(), consumer+"-"+strconv.Itoa(os.Getpid())); err != nil {
+		log.Fatalf("Errore nella creazione del consumer group: %v", err)
+	}
+
+	// Consegne dei webhooks programmate in Redis, eseguite da qualunque replica.
+	// WEBHOOK_ALLOW_PRIVATE_TARGETS=true permette gli indirizzi interni, solo in sviluppo.
+	if allow := os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"); allow != "" {
+		allowed, err := strconv.ParseBool(allow)
+		if err != nil {
+			log.Fatalf("WEBHOOK_ALLOW_PRIVATE_TARGETS non valida: %v", err)
+		}
+		controllers.SetWebhookPrivateTargets(allowed)
+	}
+	controllers.StartWebhookDispatcher(context.Background(), 500*time.Millisecond)
+
+	// Worker che eseguono i job in coda (import, cache_warmup, reindex), su qualunque replica
+	jobWorkers := 2
+	if workers := os.Getenv("JOB_WORKERS"); workers != "" {
+		jobWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			log.Fatalf("JOB_WORKERS non valida: %v", err)
+		}
+	}
+	// Dimensione massima in byte del file di un import, tenuto nel BlobStore finché il job non finisce
+	if maxSize := os.Getenv("IMPORT_MAX_SIZE"); maxSize != "" {
+		size, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil {
+			log.Fatalf("IMPORT_MAX_SIZE non valida: %v", err)
+		}
+		controllers.SetMaxImportSize(size)
+	}
+	controllers.StartJobWorkers(context.Background(), jobWorkers)
+
+	// ItemService gRPC su una porta separata, con la stessa sorgente dati e la stessa cache
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatalf("Errore nell'apertura della porta gRPC: %v", err)
+	}
+	go func() {
+		if err := controllers.NewGRPCServer().Serve(lis); err != nil {
+			log.Fatalf("Errore nel server gRPC: %v", err)
+		}
+	}()
+
 	router := gin.Default()
+	router.Use(controllers.ErrorHandler())
+	router.NoRoute(controllers.NoRoute)
 
 	// Imposta le rotte
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	router.GET("/ping", controllers.GetPing)
-	router.GET("/items", controllers.GetItems)
-	router.POST("/items", controllers.CreateItem)
-	router.GET("/items/search", controllers.SearchItemsByName)
-	router.GET("/items/:id", controllers.GetItemsByID)
-	router.DELETE("/items/:id", controllers.DeleteItem)
-	router.PUT("/items/:id", controllers.UpdatedItem)
+	// Le rotte REST esistono senza prefisso (versione dall'header API-Version, 1 di
+	// default) e con i prefissi /v1 e /v2; rispondono nel formato scelto da Accept
+	controllers.RegisterAPIRoutes(router.Group("", controllers.APIVersion(0), controllers.Negotiate()))
+	controllers.RegisterAPIRoutes(router.Group("/v1", controllers.APIVersion(1), controllers.Negotiate()))
+	controllers.RegisterAPIRoutes(router.Group("/v2", controllers.APIVersion(2), controllers.Negotiate()))
+
+	// Stream, WebSocket, GraphQL, export e download degli allegati hanno un formato
+	// proprio, senza Negotiate, ma esistono con gli stessi prefissi
+	controllers.RegisterStreamRoutes(router.Group("", controllers.APIVersion(0)))
+	controllers.RegisterStreamRoutes(router.Group("/v1", controllers.APIVersion(1)))
+	controllers.RegisterStreamRoutes(router.Group("/v2", controllers.APIVersion(2)))
+
 	router.Run(":8080")
 	// Avvia il server
 	if err := router.Run(); err != nil {
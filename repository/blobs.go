@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrBlobNotFound viene restituito quando il blob indicato non esiste
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore conserva il contenuto binario degli allegati e i file degli import
+type BlobStore interface {
+	// Put salva il contenuto letto da r con la chiave indicata e ne restituisce la dimensione
+	Put(key string, r io.Reader) (int64, error)
+	// Open apre il blob in lettura; il ReadSeeker permette le richieste con Range
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete elimina il blob, senza errori se non esiste
+	Delete(key string) error
+	// DeletePrefix elimina tutti i blob sotto il prefisso indicato (es. "items/3")
+	DeletePrefix(prefix string) error
+}
+
+// FileBlobStore salva i blob come file sotto una cartella del filesystem locale
+type FileBlobStore struct {
+	root string
+}
+
+// NewFileBlobStore crea (se serve) la cartella root e restituisce lo store
+func NewFileBlobStore(root string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileBlobStore{root: root}, nil
+}
+
+// path converte la chiave in un percorso, impedendo di uscire dalla cartella root
+func (s *FileBlobStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("invalid blob key")
+	}
+	return filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(cleaned, "/"))), nil
+}
+
+func (s *FileBlobStore) Put(key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	// Scrive su un file temporaneo, così un upload interrotto non lascia blob a metà
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *FileBlobStore) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+func (s *FileBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileBlobStore) DeletePrefix(prefix string) error {
+	path, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
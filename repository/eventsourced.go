@@ -0,0 +1,622 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-try/schemas"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tipi di evento scritti nel log
+const (
+	EventItemCreated  = "ItemCreated"
+	EventItemUpdated  = "ItemUpdated"
+	EventItemRenamed  = "ItemRenamed"
+	EventItemDeleted  = "ItemDeleted"
+	EventItemRestored = "ItemRestored"
+	EventItemPurged   = "ItemPurged"
+)
+
+const (
+	eventLogFile = "events.log"
+	snapshotFile = "snapshot.json"
+	// outboxFile contiene il Seq dell'ultimo evento pubblicato
+	outboxFile = "outbox.offset"
+	// snapshotsDir contiene gli snapshot precedenti, <seq>.json, usati da ListAt
+	snapshotsDir = "snapshots"
+	// maxCheckpoints è quanti snapshot precedenti vengono conservati: oltre, se ne
+	// elimina uno ogni due, così restano distribuiti su tutto il log
+	maxCheckpoints = 64
+)
+
+// Event è una riga del log append-only. Item contiene lo stato completo per
+// ItemCreated, ItemUpdated e ItemRestored; Name il nuovo nome per ItemRenamed.
+// PreviousCategoryID è la categoria dell'item prima dell'evento, così chi lo
+// consuma sa quale categoria ha perso l'item anche quando Item manca.
+type Event struct {
+	Seq                int64         `json:"seq"`
+	Type               string        `json:"type"`
+	ItemID             int           `json:"item_id"`
+	At                 time.Time     `json:"at"`
+	Item               *schemas.Item `json:"item,omitempty"`
+	Name               string        `json:"name,omitempty"`
+	PreviousCategoryID int           `json:"previous_category_id,omitempty"`
+}
+
+// snapshot è lo stato completo dopo l'evento Seq
+type snapshot struct {
+	Seq     int64          `json:"seq"`
+	TakenAt time.Time      `json:"taken_at"`
+	Items   []schemas.Item `json:"items"`
+}
+
+// checkpoint indica uno snapshot in snapshotsDir: lo stato dopo l'evento Seq, che
+// nel log finisce al byte Offset. MaxAt è l'istante più recente tra gli eventi
+// fino a Seq, quindi ListAt può partire dallo snapshot per ogni istante da MaxAt in poi.
+type checkpoint struct {
+	Seq    int64
+	MaxAt  time.Time
+	Offset int64
+}
+
+// EventSourcedItemRepository ricava lo stato degli items da un log di eventi
+// persistito su disco. Ogni snapshotEvery eventi viene salvato uno snapshot, così
+// all'avvio basta rileggere gli eventi successivi. Il log non viene mai
+// accorciato: resta disponibile per audit e letture nel passato (ListAt), che
+// partono dallo snapshot precedente più vicino.
+// Il log fa anche da outbox: gli eventi successivi a outbox.offset sono ancora da pubblicare.
+type EventSourcedItemRepository struct {
+	mu            sync.RWMutex
+	dir           string
+	log           *os.File
+	items         []schemas.Item
+	seq           int64
+	snapshotEvery int
+	sinceSnapshot int
+	published     int64
+	pending       []Event
+	// maxAt è l'istante più recente tra gli eventi salvati
+	maxAt       time.Time
+	checkpoints []checkpoint
+	index       *itemIndex
+}
+
+// OpenEventSourcedItemRepository apre (o crea) il log nella cartella dir e ricostruisce lo stato
+func OpenEventSourcedItemRepository(dir string, snapshotEvery int) (*EventSourcedItemRepository, error) {
+	if err := os.MkdirAll(filepath.Join(dir, snapshotsDir), 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &EventSourcedItemRepository{dir: dir, snapshotEvery: snapshotEvery, items: []schemas.Item{}}
+
+	snap, err := r.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if snap != nil {
+		r.items = snap.Items
+		r.seq = snap.Seq
+	}
+
+	r.published, err = r.loadOutboxOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	events, ends, err := readEvents(filepath.Join(dir, eventLogFile), 0)
+	if err != nil {
+		return nil, err
+	}
+	var validSize int64
+	if len(ends) > 0 {
+		validSize = ends[len(ends)-1]
+	}
+	checkpointSeqs, err := r.checkpointSeqs()
+	if err != nil {
+		return nil, err
+	}
+	// Gli ID degli items eliminati definitivamente non vengono riusati
+	maxID := 0
+	for i, event := range events {
+		maxID = max(maxID, event.ItemID)
+		if event.At.After(r.maxAt) {
+			r.maxAt = event.At
+		}
+		if checkpointSeqs[event.Seq] {
+			r.checkpoints = append(r.checkpoints, checkpoint{Seq: event.Seq, MaxAt: r.maxAt, Offset: ends[i]})
+			delete(checkpointSeqs, event.Seq)
+		}
+
+		// Anche gli eventi già inclusi nello snapshot possono essere ancora da pubblicare
+		if event.Seq > r.published {
+			r.pending = append(r.pending, event)
+		}
+		if event.Seq <= r.seq {
+			continue
+		}
+		r.items = applyEvent(r.items, event)
+		r.seq = event.Seq
+		r.sinceSnapshot++
+	}
+	// Uno snapshot di eventi non più nel log non è utilizzabile
+	for seq := range checkpointSeqs {
+		os.Remove(r.checkpointPath(seq))
+	}
+	r.index = newItemIndex(r.items)
+	r.index.maxID = max(r.index.maxID, maxID)
+
+	r.log, err = os.OpenFile(filepath.Join(dir, eventLogFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Una riga incompleta in fondo al log (crash durante una scrittura) viene scartata
+	if err := r.log.Truncate(validSize); err != nil {
+		r.log.Close()
+		return nil, err
+	}
+	if _, err := r.log.Seek(0, io.SeekEnd); err != nil {
+		r.log.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close chiude il file del log
+func (r *EventSourcedItemRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.Close()
+}
+
+func (r *EventSourcedItemRepository) List() []schemas.Item {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyItems(r.items)
+}
+
+func (r *EventSourcedItemRepository) ListAfter(afterID, limit int) []schemas.Item {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return itemsAfter(r.items, afterID, limit)
+}
+
+func (r *EventSourcedItemRepository) Create(item schemas.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if findItem(r.items, item.ID) != nil {
+		return ErrIDTaken
+	}
+	if r.index.nameTaken(item.Name, 0) {
+		return ErrNameTaken
+	}
+	created := copyItem(item)
+	return r.append(Event{Type: EventItemCreated, ItemID: item.ID, At: item.CreatedAt, Item: &created})
+}
+
+func (r *EventSourcedItemRepository) CreateNext(item schemas.Item) (schemas.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index.nameTaken(item.Name, 0) {
+		return item, ErrNameTaken
+	}
+	item.ID = r.index.maxID + 1
+	created := copyItem(item)
+	if err := r.append(Event{Type: EventItemCreated, ItemID: item.ID, At: item.CreatedAt, Item: &created}); err != nil {
+		return item, err
+	}
+	return copyItem(created), nil
+}
+
+func (r *EventSourcedItemRepository) NameTaken(name string, excludeID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.index.nameTaken(name, excludeID)
+}
+
+func (r *EventSourcedItemRepository) Update(item schemas.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := findItem(r.items, item.ID)
+	if current == nil {
+		return ErrNotFound
+	}
+	if err := r.index.checkUpdate(current, item); err != nil {
+		return err
+	}
+
+	updated := copyItem(item)
+	previous := current.CategoryID
+	switch {
+	case current.DeletedAt != nil && item.DeletedAt == nil:
+		return r.append(Event{Type: EventItemRestored, ItemID: item.ID, At: item.UpdatedAt, Item: &updated, PreviousCategoryID: previous})
+	case onlyNameChanged(*current, item):
+		return r.append(Event{Type: EventItemRenamed, ItemID: item.ID, At: item.UpdatedAt, Name: item.Name, PreviousCategoryID: previous})
+	}
+	return r.append(Event{Type: EventItemUpdated, ItemID: item.ID, At: item.UpdatedAt, Item: &updated, PreviousCategoryID: previous})
+}
+
+func (r *EventSourcedItemRepository) Delete(id int, deletedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := findItem(r.items, id)
+	if current == nil {
+		return ErrNotFound
+	}
+	return r.append(Event{Type: EventItemDeleted, ItemID: id, At: deletedAt, PreviousCategoryID: current.CategoryID})
+}
+
+func (r *EventSourcedItemRepository) Purge(ids []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		current := findItem(r.items, id)
+		if current == nil {
+			continue
+		}
+		if err := r.append(Event{Type: EventItemPurged, ItemID: id, At: time.Now().UTC(), PreviousCategoryID: current.CategoryID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events restituisce l'intero log degli eventi, dal più vecchio
+func (r *EventSourcedItemRepository) Events() ([]Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events, _, err := readEvents(filepath.Join(r.dir, eventLogFile), 0)
+	return events, err
+}
+
+// ListAt ricostruisce gli items com'erano all'istante indicato partendo dallo
+// snapshot più recente che contiene solo eventi avvenuti entro at, e rileggendo
+// il log da lì
+func (r *EventSourcedItemRepository) ListAt(at time.Time) ([]schemas.Item, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	items := []schemas.Item{}
+	var offset int64
+	i := sort.Search(len(r.checkpoints), func(i int) bool { return r.checkpoints[i].MaxAt.After(at) })
+	if i > 0 {
+		snap, err := readSnapshot(r.checkpointPath(r.checkpoints[i-1].Seq))
+		if err != nil {
+			return nil, err
+		}
+		items, offset = snap.Items, r.checkpoints[i-1].Offset
+	}
+
+	events, _, err := readEvents(filepath.Join(r.dir, eventLogFile), offset)
+	if err != nil {
+		return nil, err
+	}
+	return replayUntil(items, events, at), nil
+}
+
+func (r *EventSourcedItemRepository) LastEventAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.maxAt
+}
+
+func (r *EventSourcedItemRepository) PendingEvents(limit int) ([]Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if limit > len(r.pending) {
+		limit = len(r.pending)
+	}
+	pending := make([]Event, limit)
+	for i, event := range r.pending[:limit] {
+		pending[i] = copyEvent(event)
+	}
+	return pending, nil
+}
+
+func (r *EventSourcedItemRepository) MarkPublished(seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if seq <= r.published {
+		return nil
+	}
+	if err := writeFileAtomic(filepath.Join(r.dir, outboxFile), []byte(strconv.FormatInt(seq, 10))); err != nil {
+		return err
+	}
+	r.published = seq
+
+	i := 0
+	for i < len(r.pending) && r.pending[i].Seq <= seq {
+		i++
+	}
+	r.pending = append([]Event(nil), r.pending[i:]...)
+	return nil
+}
+
+// Snapshot salva lo stato corrente, così il prossimo avvio rilegge solo gli eventi successivi
+func (r *EventSourcedItemRepository) Snapshot() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.writeSnapshot()
+}
+
+// append scrive l'evento su disco e solo dopo lo applica allo stato in memoria
+func (r *EventSourcedItemRepository) append(event Event) error {
+	event.Seq = r.seq + 1
+	commitAt(&event, r.maxAt)
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	offset, err := r.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := r.log.Write(append(line, '\n')); err != nil {
+		// Elimina l'eventuale riga scritta a metà, così il log resta leggibile
+		r.log.Truncate(offset)
+		r.log.Seek(offset, io.SeekStart)
+		return err
+	}
+	if err := r.log.Sync(); err != nil {
+		return err
+	}
+
+	r.items = r.index.apply(r.items, event)
+	r.seq = event.Seq
+	r.sinceSnapshot++
+	r.pending = append(r.pending, event)
+	if event.At.After(r.maxAt) {
+		r.maxAt = event.At
+	}
+
+	if r.snapshotEvery > 0 && r.sinceSnapshot >= r.snapshotEvery {
+		// Uno snapshot fallito non perde dati: all'avvio si rileggono più eventi
+		r.writeSnapshot()
+	}
+	return nil
+}
+
+func (r *EventSourcedItemRepository) writeSnapshot() error {
+	data, err := json.Marshal(snapshot{Seq: r.seq, TakenAt: time.Now().UTC(), Items: r.items})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(r.dir, snapshotFile), data); err != nil {
+		return err
+	}
+
+	r.sinceSnapshot = 0
+	return r.addCheckpoint(data)
+}
+
+// addCheckpoint conserva lo snapshot appena scritto anche tra quelli precedenti
+func (r *EventSourcedItemRepository) addCheckpoint(data []byte) error {
+	if n := len(r.checkpoints); n > 0 && r.checkpoints[n-1].Seq == r.seq {
+		return nil
+	}
+	offset, err := r.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.checkpointPath(r.seq), data); err != nil {
+		return err
+	}
+	r.checkpoints = append(r.checkpoints, checkpoint{Seq: r.seq, MaxAt: r.maxAt, Offset: offset})
+
+	if len(r.checkpoints) > maxCheckpoints {
+		kept := []checkpoint{}
+		for i, cp := range r.checkpoints {
+			if i%2 == 1 || i == len(r.checkpoints)-1 {
+				kept = append(kept, cp)
+			} else {
+				os.Remove(r.checkpointPath(cp.Seq))
+			}
+		}
+		r.checkpoints = kept
+	}
+	return nil
+}
+
+// checkpointSeqs restituisce i Seq degli snapshot precedenti salvati in snapshotsDir
+func (r *EventSourcedItemRepository) checkpointSeqs() (map[int64]bool, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, snapshotsDir))
+	if err != nil {
+		return nil, err
+	}
+	seqs := map[int64]bool{}
+	for _, entry := range entries {
+		if seq, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".json"), 10, 64); err == nil {
+			seqs[seq] = true
+		}
+	}
+	return seqs, nil
+}
+
+func (r *EventSourcedItemRepository) checkpointPath(seq int64) string {
+	return filepath.Join(r.dir, snapshotsDir, strconv.FormatInt(seq, 10)+".json")
+}
+
+// writeFileAtomic scrive su un file temporaneo e lo rinomina, così il file non è mai scritto a metà
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (r *EventSourcedItemRepository) loadOutboxOffset() (int64, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, outboxFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupted outbox offset: %w", err)
+	}
+	return offset, nil
+}
+
+func (r *EventSourcedItemRepository) loadSnapshot() (*snapshot, error) {
+	snap, err := readSnapshot(filepath.Join(r.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return snap, err
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("corrupted snapshot: %w", err)
+	}
+	if snap.Items == nil {
+		snap.Items = []schemas.Item{}
+	}
+	return &snap, nil
+}
+
+// readEvents legge il log dal byte offset e restituisce anche dove finisce ogni
+// evento: solo l'ultima riga può essere incompleta, un errore in mezzo al log è una corruzione
+func readEvents(path string, offset int64) ([]Event, []int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	var events []Event
+	var ends []int64
+	validSize := offset
+	reader := bufio.NewReader(f)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Riga senza terminatore: scrittura interrotta
+			return events, ends, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		var event Event
+		if jsonErr := json.Unmarshal(bytes.TrimSpace(line), &event); jsonErr != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return events, ends, nil
+			}
+			return nil, nil, fmt.Errorf("corrupted event log at line %d: %w", lineNumber, jsonErr)
+		}
+		events = append(events, event)
+		validSize += int64(len(line))
+		ends = append(ends, validSize)
+	}
+}
+
+// replayUntil ricostruisce lo stato applicando a items solo gli eventi avvenuti entro at
+func replayUntil(items []schemas.Item, events []Event, at time.Time) []schemas.Item {
+	for _, event := range events {
+		if event.At.After(at) {
+			continue
+		}
+		items = applyEvent(items, event)
+	}
+	return items
+}
+
+// applyEvent applica un evento allo stato e restituisce il nuovo stato
+func applyEvent(items []schemas.Item, event Event) []schemas.Item {
+	switch event.Type {
+	case EventItemCreated:
+		return append(items, copyItem(*event.Item))
+	case EventItemUpdated, EventItemRestored:
+		if item := findItem(items, event.ItemID); item != nil {
+			*item = copyItem(*event.Item)
+		}
+	case EventItemRenamed:
+		if item := findItem(items, event.ItemID); item != nil {
+			item.Name = event.Name
+			item.UpdatedAt = event.At
+		}
+	case EventItemDeleted:
+		if item := findItem(items, event.ItemID); item != nil {
+			deletedAt := event.At
+			item.DeletedAt = &deletedAt
+		}
+	case EventItemPurged:
+		for i, item := range items {
+			if item.ID == event.ItemID {
+				return append(items[:i], items[i+1:]...)
+			}
+		}
+	}
+	return items
+}
+
+func findItem(items []schemas.Item, id int) *schemas.Item {
+	for i := range items {
+		if items[i].ID == id {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// onlyNameChanged è vero se tra i due stati cambiano solo il nome e la data di modifica
+func onlyNameChanged(before, after schemas.Item) bool {
+	if before.Name == after.Name {
+		return false
+	}
+	before.Name, after.Name = "", ""
+	before.UpdatedAt, after.UpdatedAt = time.Time{}, time.Time{}
+	return reflect.DeepEqual(before, after)
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"gin-try/schemas"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryEvents è quante modifiche recenti conserva MemoryItemRepository per ListAt
+const DefaultMemoryEvents = 10000
+
+// MemoryItemRepository tiene gli items in memoria: è la sorgente dati di default.
+// Ogni modifica viene registrata anche come evento, così da poter ricostruire gli
+// items com'erano in passato. Per non crescere senza limite conserva solo gli
+// ultimi eventi: i più vecchi vengono applicati a base, e ListAt risponde solo
+// dagli istanti successivi a horizon. Gli eventi ancora da pubblicare sono anche
+// in pending, che si svuota man mano che vengono pubblicati.
+type MemoryItemRepository struct {
+	mu        sync.RWMutex
+	items     []schemas.Item
+	base      []schemas.Item
+	horizon   time.Time
+	events    []Event
+	maxEvents int
+	seq       int64
+	pending   []Event
+	maxAt     time.Time
+	index     *itemIndex
+}
+
+// NewMemoryItemRepository crea un repository in memoria con gli items indicati
+func NewMemoryItemRepository(items []schemas.Item) *MemoryItemRepository {
+	r := &MemoryItemRepository{items: copyItems(items), maxEvents: DefaultMemoryEvents}
+	r.index = newItemIndex(r.items)
+	// Gli items iniziali hanno Seq 0: non sono modifiche da pubblicare
+	for _, item := range r.items {
+		created := copyItem(item)
+		r.events = append(r.events, Event{Type: EventItemCreated, ItemID: item.ID, At: item.CreatedAt, Item: &created})
+		if item.CreatedAt.After(r.maxAt) {
+			r.maxAt = item.CreatedAt
+		}
+	}
+	r.seq = int64(len(r.events))
+	return r
+}
+
+// SetMaxEvents cambia quante modifiche recenti vengono conservate per ListAt
+func (r *MemoryItemRepository) SetMaxEvents(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n > 1 {
+		r.maxEvents = n
+		r.compact()
+	}
+}
+
+func (r *MemoryItemRepository) List() []schemas.Item {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyItems(r.items)
+}
+
+func (r *MemoryItemRepository) ListAfter(afterID, limit int) []schemas.Item {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return itemsAfter(r.items, afterID, limit)
+}
+
+func (r *MemoryItemRepository) Create(item schemas.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if findItem(r.items, item.ID) != nil {
+		return ErrIDTaken
+	}
+	if r.index.nameTaken(item.Name, 0) {
+		return ErrNameTaken
+	}
+	created := copyItem(item)
+	r.record(Event{Type: EventItemCreated, ItemID: item.ID, At: item.CreatedAt, Item: &created})
+	return nil
+}
+
+func (r *MemoryItemRepository) CreateNext(item schemas.Item) (schemas.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index.nameTaken(item.Name, 0) {
+		return item, ErrNameTaken
+	}
+	item.ID = r.index.maxID + 1
+	created := copyItem(item)
+	r.record(Event{Type: EventItemCreated, ItemID: item.ID, At: item.CreatedAt, Item: &created})
+	return copyItem(created), nil
+}
+
+func (r *MemoryItemRepository) NameTaken(name string, excludeID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.index.nameTaken(name, excludeID)
+}
+
+func (r *MemoryItemRepository) Update(item schemas.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := findItem(r.items, item.ID)
+	if current == nil {
+		return ErrNotFound
+	}
+	if err := r.index.checkUpdate(current, item); err != nil {
+		return err
+	}
+	updated := copyItem(item)
+	r.record(Event{Type: EventItemUpdated, ItemID: item.ID, At: item.UpdatedAt, Item: &updated, PreviousCategoryID: current.CategoryID})
+	return nil
+}
+
+func (r *MemoryItemRepository) Delete(id int, deletedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := findItem(r.items, id)
+	if current == nil {
+		return ErrNotFound
+	}
+	r.record(Event{Type: EventItemDeleted, ItemID: id, At: deletedAt, PreviousCategoryID: current.CategoryID})
+	return nil
+}
+
+func (r *MemoryItemRepository) Purge(ids []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		if current := findItem(r.items, id); current != nil {
+			r.record(Event{Type: EventItemPurged, ItemID: id, At: time.Now().UTC(), PreviousCategoryID: current.CategoryID})
+		}
+	}
+	return nil
+}
+
+func (r *MemoryItemRepository) ListAt(at time.Time) ([]schemas.Item, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if at.Before(r.horizon) {
+		return nil, ErrHistoryTrimmed
+	}
+	return copyItems(replayUntil(copyItems(r.base), r.events, at)), nil
+}
+
+func (r *MemoryItemRepository) LastEventAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.maxAt
+}
+
+func (r *MemoryItemRepository) PendingEvents(limit int) ([]Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if limit > len(r.pending) {
+		limit = len(r.pending)
+	}
+	pending := make([]Event, limit)
+	for i, event := range r.pending[:limit] {
+		pending[i] = copyEvent(event)
+	}
+	return pending, nil
+}
+
+func (r *MemoryItemRepository) MarkPublished(seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := 0
+	for i < len(r.pending) && r.pending[i].Seq <= seq {
+		i++
+	}
+	r.pending = append([]Event(nil), r.pending[i:]...)
+	return nil
+}
+
+// record applica l'evento allo stato corrente, lo conserva per ListAt e lo mette nell'outbox
+func (r *MemoryItemRepository) record(event Event) {
+	r.seq++
+	event.Seq = r.seq
+	commitAt(&event, r.maxAt)
+	r.items = r.index.apply(r.items, event)
+	r.events = append(r.events, event)
+	r.pending = append(r.pending, event)
+	if event.At.After(r.maxAt) {
+		r.maxAt = event.At
+	}
+	r.compact()
+}
+
+// compact applica a base gli eventi più vecchi quando sono più di maxEvents, e ne
+// tiene metà così da non ricompattare a ogni modifica. Gli eventi sono in ordine di
+// istante (vedi commitAt), quindi base è lo stato all'istante dell'ultimo applicato.
+func (r *MemoryItemRepository) compact() {
+	if len(r.events) <= r.maxEvents {
+		return
+	}
+	n := len(r.events) - r.maxEvents/2
+	for _, event := range r.events[:n] {
+		r.base = applyEvent(r.base, event)
+	}
+	r.horizon = r.events[n-1].At
+	r.events = append([]Event(nil), r.events[n:]...)
+}
@@ -0,0 +1,212 @@
+// Package repository contiene le sorgenti dati degli items usate dai controllers
+package repository
+
+import (
+	"errors"
+	"gin-try/schemas"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound viene restituito quando l'item indicato non esiste
+var ErrNotFound = errors.New("item not found")
+
+// ErrHistoryTrimmed viene restituito da ListAt per un istante precedente alla storia conservata
+var ErrHistoryTrimmed = errors.New("as_of is older than the kept history")
+
+// ErrIDTaken viene restituito da Create quando l'ID è già usato da un altro item
+var ErrIDTaken = errors.New("item id already taken")
+
+// ErrNameTaken viene restituito quando il nome è già usato da un altro item fuori dal cestino
+var ErrNameTaken = errors.New("item name already taken")
+
+// ItemRepository è la sorgente dati degli items. List restituisce anche gli items
+// nel cestino; i filtri per stato sono applicati dai controllers.
+type ItemRepository interface {
+	// List restituisce una copia di tutti gli items, nell'ordine di creazione
+	List() []schemas.Item
+	// ListAfter restituisce fino a limit items con ID maggiore di afterID, in ordine
+	// di ID, per leggere tutti gli items a blocchi senza copiarli tutti insieme
+	ListAfter(afterID, limit int) []schemas.Item
+	// Create aggiunge un nuovo item con l'ID indicato; sotto lo stesso lock
+	// controlla che ID e nome siano liberi (ErrIDTaken, ErrNameTaken)
+	Create(item schemas.Item) error
+	// CreateNext assegna all'item l'ID successivo al più alto mai usato e lo
+	// aggiunge; sotto lo stesso lock controlla che il nome sia libero (ErrNameTaken)
+	CreateNext(item schemas.Item) (schemas.Item, error)
+	// NameTaken indica se un item fuori dal cestino diverso da excludeID usa già
+	// il nome, senza distinguere maiuscole e minuscole
+	NameTaken(name string, excludeID int) bool
+	// Update sostituisce lo stato di un item esistente, anche se è nel cestino.
+	// Restituisce ErrNameTaken se l'item cambia nome o esce dal cestino e il nome è già usato.
+	Update(item schemas.Item) error
+	// Delete sposta l'item nel cestino
+	Delete(id int, deletedAt time.Time) error
+	// Purge elimina definitivamente gli items indicati
+	Purge(ids []int) error
+	// ListAt restituisce gli items com'erano all'istante indicato, cestino compreso;
+	// ErrHistoryTrimmed se l'istante precede la storia conservata
+	ListAt(at time.Time) ([]schemas.Item, error)
+	// LastEventAt restituisce l'istante più recente tra le modifiche salvate:
+	// ListAt non cambia più per gli istanti precedenti
+	LastEventAt() time.Time
+	Outbox
+}
+
+// Outbox espone gli eventi scritti insieme a ogni modifica e non ancora
+// pubblicati. Un evento esiste se e solo se la modifica è stata salvata, quindi
+// chi pubblica gli eventi pendenti non perde modifiche neanche dopo un crash.
+type Outbox interface {
+	// PendingEvents restituisce fino a limit eventi non ancora pubblicati, dal più vecchio
+	PendingEvents(limit int) ([]Event, error)
+	// MarkPublished segna come pubblicati tutti gli eventi fino a seq compreso
+	MarkPublished(seq int64) error
+}
+
+// itemsAfter copia fino a limit items con ID maggiore di afterID. Gli items sono
+// in ordine di creazione e gli ID crescono con la creazione, quindi anche in ordine di ID.
+func itemsAfter(items []schemas.Item, afterID, limit int) []schemas.Item {
+	start := sort.Search(len(items), func(i int) bool { return items[i].ID > afterID })
+	end := min(start+limit, len(items))
+	return copyItems(items[start:end])
+}
+
+func copyEvent(event Event) Event {
+	if event.Item != nil {
+		item := copyItem(*event.Item)
+		event.Item = &item
+	}
+	return event
+}
+
+func copyItems(items []schemas.Item) []schemas.Item {
+	copied := make([]schemas.Item, len(items))
+	for i, item := range items {
+		copied[i] = copyItem(item)
+	}
+	return copied
+}
+
+// copyItem evita che chi legge condivida slice e puntatori con il repository
+func copyItem(item schemas.Item) schemas.Item {
+	if item.Tags != nil {
+		item.Tags = append([]string{}, item.Tags...)
+	}
+	if item.DeletedAt != nil {
+		deletedAt := *item.DeletedAt
+		item.DeletedAt = &deletedAt
+	}
+	return item
+}
+
+// commitAt fissa sotto il lock del repository l'istante dell'evento: non precede
+// mai l'ultimo evento salvato, così l'ordine dei commit è anche quello degli istanti
+// e ListAt non cambia per gli istanti già passati. Se l'istante viene spostato,
+// l'item dell'evento prende lo stesso istante.
+func commitAt(event *Event, last time.Time) {
+	event.At = event.At.UTC()
+	if !event.At.Before(last) {
+		return
+	}
+	event.At = last
+	if event.Item != nil {
+		if event.Type == EventItemCreated {
+			event.Item.CreatedAt = last
+		}
+		event.Item.UpdatedAt = last
+	}
+}
+
+// itemIndex tiene gli ID degli items fuori dal cestino per nome e l'ID più alto
+// mai usato, così creazioni e controlli sul nome non scorrono tutti gli items
+type itemIndex struct {
+	names map[string][]int
+	maxID int
+}
+
+func newItemIndex(items []schemas.Item) *itemIndex {
+	x := &itemIndex{names: map[string][]int{}}
+	for i := range items {
+		x.add(&items[i])
+		x.maxID = max(x.maxID, items[i].ID)
+	}
+	return x
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// apply applica l'evento come applyEvent e aggiorna l'indice
+func (x *itemIndex) apply(items []schemas.Item, event Event) []schemas.Item {
+	var before *schemas.Item
+	if event.Type != EventItemCreated {
+		if item := findItem(items, event.ItemID); item != nil {
+			copied := *item
+			before = &copied
+		}
+	}
+	items = applyEvent(items, event)
+
+	x.remove(before)
+	switch event.Type {
+	case EventItemCreated:
+		x.add(event.Item)
+	case EventItemPurged:
+	default:
+		x.add(findItem(items, event.ItemID))
+	}
+	x.maxID = max(x.maxID, event.ItemID)
+	return items
+}
+
+func (x *itemIndex) add(item *schemas.Item) {
+	if item != nil && item.DeletedAt == nil {
+		key := nameKey(item.Name)
+		x.names[key] = append(x.names[key], item.ID)
+	}
+}
+
+func (x *itemIndex) remove(item *schemas.Item) {
+	if item == nil || item.DeletedAt != nil {
+		return
+	}
+	key := nameKey(item.Name)
+	ids := x.names[key]
+	for i, id := range ids {
+		if id == item.ID {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(x.names, key)
+	} else {
+		x.names[key] = ids
+	}
+}
+
+func (x *itemIndex) nameTaken(name string, excludeID int) bool {
+	for _, id := range x.names[nameKey(name)] {
+		if id != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUpdate controlla il nome di un item che cambia nome o esce dal cestino;
+// gli altri aggiornamenti restano possibili anche con nomi già duplicati
+func (x *itemIndex) checkUpdate(current *schemas.Item, updated schemas.Item) error {
+	if updated.DeletedAt != nil {
+		return nil
+	}
+	if current.DeletedAt == nil && nameKey(current.Name) == nameKey(updated.Name) {
+		return nil
+	}
+	if x.nameTaken(updated.Name, updated.ID) {
+		return ErrNameTaken
+	}
+	return nil
+}
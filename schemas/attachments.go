@@ -0,0 +1,13 @@
+package schemas
+
+import "time"
+
+// Attachment descrive un file allegato a un item; il contenuto è nel BlobStore
+type Attachment struct {
+	ID          string    `json:"id"`
+	ItemID      int       `json:"item_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type" example:"image/png"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at" format:"date-time"`
+}
@@ -0,0 +1,14 @@
+package schemas
+
+import "time"
+
+// Category raggruppa più items
+type Category struct {
+	// ID viene assegnato dal server, quello inviato dal client viene ignorato
+	ID          int    `json:"id" readonly:"true"`
+	Name        string `json:"name" binding:"required,max=100,itemname" maxLength:"100"`
+	Description string `json:"description" binding:"max=1000" maxLength:"1000"`
+	// CreatedAt e UpdatedAt sono gestiti dal server
+	CreatedAt time.Time `json:"created_at" format:"date-time" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" format:"date-time" readonly:"true"`
+}
@@ -0,0 +1,27 @@
+package schemas
+
+// FieldError descrive una regola di validazione violata da un campo
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Problem è il corpo application/problem+json (RFC 7807) di ogni risposta di errore
+type Problem struct {
+	Type     string       `json:"type" example:"/problems/item_not_found"`
+	Title    string       `json:"title" example:"Item not found"`
+	Status   int          `json:"status" example:"404"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty" example:"/items/42"`
+	Code     string       `json:"code" enums:"item_not_found,item_name_conflict,revision_not_found,revision_not_revertible,attachment_not_found,attachment_too_large,unsupported_media_type,not_acceptable,category_not_found,category_not_empty,webhook_not_found,import_not_found,import_too_large,job_not_found,job_finished,route_not_found,missing_parameter,invalid_parameter,malformed_body,validation_failed,idempotency_key_reused,idempotency_in_progress,idempotency_key_expired,cache_error,storage_error,internal_error"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// ProblemType descrive un codice di errore del catalogo
+type ProblemType struct {
+	Code   string `json:"code"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+}
@@ -0,0 +1,21 @@
+package schemas
+
+import "time"
+
+// Tipi di evento inviati sullo stream delle modifiche agli items
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// ItemEvent è una modifica a un item notificata ai client in ascolto. Item è lo
+// stato dopo la modifica, oppure l'ultimo stato prima dell'eliminazione.
+type ItemEvent struct {
+	// ID cresce a ogni evento e va rimandato come Last-Event-ID per riprendere lo stream
+	ID     int64     `json:"id"`
+	Type   string    `json:"type" enums:"created,updated,deleted"`
+	ItemID int       `json:"item_id"`
+	Item   *Item     `json:"item,omitempty"`
+	At     time.Time `json:"at" format:"date-time"`
+}
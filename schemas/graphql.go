@@ -0,0 +1,45 @@
+package schemas
+
+import "encoding/json"
+
+// Tipi dei messaggi del protocollo graphql-transport-ws usato dalle subscription GraphQL
+const (
+	GraphQLWSConnectionInit = "connection_init"
+	GraphQLWSConnectionAck  = "connection_ack"
+	GraphQLWSPing           = "ping"
+	GraphQLWSPong           = "pong"
+	GraphQLWSSubscribe      = "subscribe"
+	GraphQLWSNext           = "next"
+	GraphQLWSError          = "error"
+	GraphQLWSComplete       = "complete"
+)
+
+// GraphQLRequest è un'operazione GraphQL: query, mutation o subscription
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse è il risultato di un'operazione; gli errori dei resolver riportano
+// in extensions.code lo stesso codice dei problem REST
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data,omitempty" swaggertype:"object"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError è un errore di un'operazione GraphQL
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty" swaggertype:"array,string"`
+	Extensions map[string]interface{} `json:"extensions,omitempty" swaggertype:"object"`
+}
+
+// GraphQLWSMessage è un messaggio del protocollo graphql-transport-ws. Payload è
+// una GraphQLRequest per subscribe, una GraphQLResponse per next e un elenco di
+// GraphQLError per error.
+type GraphQLWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type" enums:"connection_init,connection_ack,ping,pong,subscribe,next,error,complete"`
+	Payload json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+}
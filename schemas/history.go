@@ -0,0 +1,34 @@
+package schemas
+
+import "time"
+
+// Azioni registrate nello storico di un item
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+)
+
+// FieldChange descrive la modifica di un singolo campo
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Revision è una voce immutabile dello storico di un item. Before è nil per le
+// creazioni, After è nil per le eliminazioni.
+type Revision struct {
+	Revision  int           `json:"revision"`
+	ItemID    int           `json:"item_id"`
+	Action    string        `json:"action" enums:"create,update,delete,restore,revert"`
+	Actor     string        `json:"actor"`
+	Timestamp time.Time     `json:"timestamp" format:"date-time"`
+	Before    *Item         `json:"before,omitempty"`
+	After     *Item         `json:"after,omitempty"`
+	Changes   []FieldChange `json:"changes"`
+	// RevertedTo è la revisione ripristinata dalle azioni di tipo revert
+	RevertedTo int `json:"reverted_to,omitempty"`
+}
@@ -0,0 +1,50 @@
+package schemas
+
+import "time"
+
+// Stati di un import
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportCanceled  = "canceled"
+)
+
+// Formati accettati da un import
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// ImportJob è lo stato di un import di items eseguito in background
+type ImportJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status" enums:"queued,running,completed,failed,canceled"`
+	Format string `json:"format" enums:"csv,ndjson"`
+	// DryRun indica un import che valida le righe senza salvarle
+	DryRun bool `json:"dry_run"`
+	// BytesRead su BytesTotal è l'avanzamento dell'import
+	BytesRead  int64 `json:"bytes_read"`
+	BytesTotal int64 `json:"bytes_total"`
+	// Processed sono le righe lette; Imported quelle salvate, o che lo sarebbero in un dry run
+	Processed int `json:"processed"`
+	Imported  int `json:"imported"`
+	Failed    int `json:"failed"`
+	// Errors contiene le prime righe non valide; ErrorsTruncated indica che ce ne sono altre
+	Errors          []ImportError `json:"errors"`
+	ErrorsTruncated bool          `json:"errors_truncated,omitempty"`
+	// Error è il motivo per cui l'import si è interrotto
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" format:"date-time"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" format:"date-time"`
+}
+
+// ImportError è una riga dell'import che non è stata importata
+type ImportError struct {
+	// Line è il numero di riga nel file, a partire da 1 (l'intestazione CSV è la riga 1)
+	Line   int          `json:"line"`
+	Code   string       `json:"code" enums:"malformed_body,validation_failed"`
+	Detail string       `json:"detail"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
@@ -1,7 +1,44 @@
 package schemas
 
+import "time"
+
 // Item rappresenta una risorsa di esempio
 type Item struct {
+	// ID viene assegnato dal server, quello inviato dal client viene ignorato
+	ID          int      `json:"id" readonly:"true"`
+	Name        string   `json:"name" binding:"required,max=100,itemname" maxLength:"100"`
+	Description string   `json:"description" binding:"max=1000" maxLength:"1000"`
+	Tags        []string `json:"tags" binding:"max=20,dive,max=30" maxItems:"20"`
+	Price       Price    `json:"price" binding:"min=0" swaggertype:"string" example:"12.50"`
+	Quantity    int      `json:"quantity" binding:"min=0" minimum:"0"`
+	// CategoryID è opzionale, 0 indica un item senza categoria
+	CategoryID int `json:"category_id,omitempty"`
+	// CreatedAt e UpdatedAt sono gestiti dal server
+	CreatedAt time.Time `json:"created_at" format:"date-time" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" format:"date-time" readonly:"true"`
+	// DeletedAt è valorizzato solo per gli items nel cestino
+	DeletedAt *time.Time `json:"deleted_at,omitempty" format:"date-time" readonly:"true"`
+}
+
+// ItemV2 è un item nella versione 2 dell'API: la categoria è inclusa con il suo nome
+// e in_stock dice se l'item è disponibile. Nel body delle richieste la categoria si
+// indica sempre con category_id.
+type ItemV2 struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Tags        []string     `json:"tags"`
+	Price       Price        `json:"price" swaggertype:"string" example:"12.50"`
+	Quantity    int          `json:"quantity"`
+	InStock     bool         `json:"in_stock"`
+	Category    *CategoryRef `json:"category"`
+	CreatedAt   time.Time    `json:"created_at" format:"date-time"`
+	UpdatedAt   time.Time    `json:"updated_at" format:"date-time"`
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty" format:"date-time"`
+}
+
+// CategoryRef è la categoria di un item nella versione 2 dell'API
+type CategoryRef struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
 }
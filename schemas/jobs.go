@@ -0,0 +1,39 @@
+package schemas
+
+import "time"
+
+// Stati di un job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Tipi di job
+const (
+	// JobImport è un import di items, creato da POST /items/import
+	JobImport = "import"
+	// JobCacheWarmup carica nella cache tutti gli items
+	JobCacheWarmup = "cache_warmup"
+	// JobReindex ricalcola dalla sorgente dati le ricerche in cache
+	JobReindex = "reindex"
+)
+
+// Job è un'operazione lunga eseguita in background da una qualunque replica
+type Job struct {
+	ID     string `json:"id" readonly:"true"`
+	Type   string `json:"type" binding:"required,oneof=cache_warmup reindex" enums:"import,cache_warmup,reindex"`
+	Status string `json:"status" enums:"queued,running,completed,failed,canceled" readonly:"true"`
+	// Done su Total è l'avanzamento, nell'unità del job (items, ricerche o byte)
+	Done  int64 `json:"done" readonly:"true"`
+	Total int64 `json:"total" readonly:"true"`
+	// CancelRequested indica un job in esecuzione che si fermerà al prossimo avanzamento
+	CancelRequested bool `json:"cancel_requested,omitempty" readonly:"true"`
+	// Error è il motivo per cui il job non è stato completato
+	Error      string     `json:"error,omitempty" readonly:"true"`
+	CreatedAt  time.Time  `json:"created_at" format:"date-time" readonly:"true"`
+	StartedAt  *time.Time `json:"started_at,omitempty" format:"date-time" readonly:"true"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" format:"date-time" readonly:"true"`
+}
@@ -0,0 +1,21 @@
+package schemas
+
+// JSONAPIErrors è il corpo delle risposte di errore con Accept application/vnd.api+json
+type JSONAPIErrors struct {
+	Errors []JSONAPIError `json:"errors"`
+}
+
+// JSONAPIError è un error object JSON:API; code è lo stesso dei problem
+type JSONAPIError struct {
+	Status string              `json:"status" example:"404"`
+	Code   string              `json:"code" example:"item_not_found"`
+	Title  string              `json:"title" example:"Item not found"`
+	Detail string              `json:"detail,omitempty"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+}
+
+// JSONAPIErrorSource indica il campo del body (pointer) o il parametro di query che ha causato l'errore
+type JSONAPIErrorSource struct {
+	Pointer   string `json:"pointer,omitempty" example:"/data/attributes/name"`
+	Parameter string `json:"parameter,omitempty"`
+}
@@ -0,0 +1,88 @@
+package schemas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Price è un importo con due decimali salvato in centesimi, così da evitare gli
+// errori di arrotondamento dei float. In JSON viene scritto come stringa ("12.50")
+// e accettato sia come stringa che come numero.
+type Price int64
+
+// ErrInvalidPrice viene restituito quando un importo non è nel formato 123.45
+var ErrInvalidPrice = errors.New("price must be a decimal number with at most 2 decimal places")
+
+// ParsePrice converte una stringa come "12.5" o "-3.10" in centesimi senza passare per i float
+func ParsePrice(s string) (Price, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	units, cents, hasCents := strings.Cut(s, ".")
+	if units == "" || len(cents) > 2 || (hasCents && cents == "") || !isDigits(units) || !isDigits(cents) {
+		return 0, ErrInvalidPrice
+	}
+	cents += strings.Repeat("0", 2-len(cents))
+
+	value, err := strconv.ParseInt(units+cents, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidPrice
+	}
+	if negative {
+		value = -value
+	}
+	return Price(value), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String restituisce l'importo con esattamente due decimali
+func (p Price) String() string {
+	sign := ""
+	value := int64(p)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return sign + strconv.FormatInt(value/100, 10) + "." + leftPad(strconv.FormatInt(value%100, 10))
+}
+
+func leftPad(cents string) string {
+	if len(cents) < 2 {
+		return "0" + cents
+	}
+	return cents
+}
+
+func (p Price) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *Price) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	raw := string(data)
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParsePrice(raw)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
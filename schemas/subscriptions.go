@@ -0,0 +1,30 @@
+package schemas
+
+// Tipi dei messaggi scambiati sul WebSocket delle sottoscrizioni
+const (
+	MessageSubscribe    = "subscribe"
+	MessageUnsubscribe  = "unsubscribe"
+	MessageSubscribed   = "subscribed"
+	MessageUnsubscribed = "unsubscribed"
+	MessageEvent        = "event"
+	MessageError        = "error"
+)
+
+// SubscriptionRequest è un messaggio inviato dal client. Senza ItemID e Search la
+// sottoscrizione riguarda tutti gli items; i due filtri non possono essere usati insieme.
+type SubscriptionRequest struct {
+	Type string `json:"type" enums:"subscribe,unsubscribe"`
+	// ID è scelto dal client e viene ripetuto nei messaggi della sottoscrizione
+	ID     string `json:"id"`
+	ItemID int    `json:"item_id,omitempty"`
+	Search string `json:"search,omitempty"`
+}
+
+// SubscriptionMessage è un messaggio inviato dal server
+type SubscriptionMessage struct {
+	Type   string     `json:"type" enums:"subscribed,unsubscribed,event,error"`
+	ID     string     `json:"id,omitempty"`
+	Event  *ItemEvent `json:"event,omitempty"`
+	Code   string     `json:"code,omitempty"`
+	Detail string     `json:"detail,omitempty"`
+}
@@ -0,0 +1,49 @@
+package schemas
+
+import "time"
+
+// Esiti registrati nel log delle consegne
+const (
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+	DeliveryDead      = "dead"
+)
+
+// Webhook è una sottoscrizione di un sistema esterno alle modifiche degli items
+type Webhook struct {
+	// ID viene assegnato dal server, quello inviato dal client viene ignorato
+	ID  int    `json:"id" readonly:"true"`
+	URL string `json:"url" binding:"required,http_url,max=2048" maxLength:"2048" example:"https://example.com/hooks/items"`
+	// Events limita le notifiche ai tipi indicati; vuoto significa tutti
+	Events []string `json:"events" binding:"max=3,dive,oneof=created updated deleted" enums:"created,updated,deleted"`
+	// Secret firma le consegne; se manca in creazione viene generato dal server.
+	// Viene restituito solo alla creazione.
+	Secret string `json:"secret,omitempty" binding:"omitempty,min=16,max=256" minLength:"16" maxLength:"256"`
+	// CreatedAt e UpdatedAt sono gestiti dal server
+	CreatedAt time.Time `json:"created_at" format:"date-time" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" format:"date-time" readonly:"true"`
+}
+
+// WebhookDelivery è un tentativo di consegna di un evento a un webhook
+type WebhookDelivery struct {
+	// ID è lo stesso per tutti i tentativi di consegna dello stesso evento
+	ID         string    `json:"id"`
+	WebhookID  int       `json:"webhook_id"`
+	EventID    int64     `json:"event_id"`
+	EventType  string    `json:"event_type" enums:"created,updated,deleted"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status" enums:"succeeded,failed,dead"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	At         time.Time `json:"at" format:"date-time"`
+}
+
+// DeadLetter è un evento che non è stato consegnato nemmeno dopo l'ultimo tentativo
+type DeadLetter struct {
+	DeliveryID string    `json:"delivery_id"`
+	WebhookID  int       `json:"webhook_id"`
+	Event      ItemEvent `json:"event"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	FailedAt   time.Time `json:"failed_at" format:"date-time"`
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"gin-try/controllers"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemsAsOf(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	sendItem(router, "POST", "/items", `{"name": "Lamp"}`)
+	time.Sleep(5 * time.Millisecond)
+	beforeRename := time.Now().UTC().Format(time.RFC3339Nano)
+	time.Sleep(5 * time.Millisecond)
+	sendItem(router, "PUT", "/items/3", `{"name": "Desk lamp"}`)
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+	afterDelete := time.Now().UTC().Format(time.RFC3339Nano)
+
+	var item schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/3?as_of="+url.QueryEscape(beforeRename), &item))
+	assert.Equal(t, "Lamp", item.Name)
+
+	var items []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items?as_of="+url.QueryEscape(beforeRename), &items))
+	assert.Len(t, items, 3)
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items?as_of="+url.QueryEscape(afterDelete), &items))
+	assert.Len(t, items, 2)
+
+	// L'item eliminato non esiste più a quella data
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/1?as_of="+url.QueryEscape(afterDelete), &item))
+
+	// Le modifiche successive non invalidano le risposte storiche
+	sendItem(router, "PUT", "/items/3", `{"name": "Floor lamp"}`)
+	req, _ := http.NewRequest("GET", "/items/3?as_of="+url.QueryEscape(beforeRename), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	assert.Contains(t, w.Body.String(), `"name":"Lamp"`)
+}
+
+func TestItemsAsOfAfterLastChange(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/items", `{"name": "Lamp"}`)
+	time.Sleep(5 * time.Millisecond)
+
+	// Nessuna modifica dopo as_of: una modifica in corso può ancora cambiare la risposta
+	asOf := url.QueryEscape(time.Now().UTC().Format(time.RFC3339Nano))
+	req, _ := http.NewRequest("GET", "/items/3?as_of="+asOf, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	for _, key := range mr.Keys() {
+		assert.NotContains(t, key, "asof")
+	}
+
+	// Dopo la modifica successiva lo stato ad as_of è definitivo
+	time.Sleep(5 * time.Millisecond)
+	sendItem(router, "PUT", "/items/3", `{"name": "Desk lamp"}`)
+	req, _ = http.NewRequest("GET", "/items/3?as_of="+asOf, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	assert.Contains(t, w.Body.String(), `"name":"Lamp"`)
+}
+
+func TestItemsAsOfInvalid(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	for _, asOf := range []string{"last-friday", future} {
+		req, _ := http.NewRequest("GET", "/items?as_of="+url.QueryEscape(asOf), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, asOf)
+		assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+	}
+}
+
+func TestItemsAsOfOlderThanMemoryHistory(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	repo := repository.NewMemoryItemRepository(nil)
+	repo.SetMaxEvents(4)
+	controllers.SetItemRepository(repo)
+
+	start := time.Now().UTC().Add(-time.Hour)
+	for id := 1; id <= 6; id++ {
+		at := start.Add(time.Duration(id) * time.Minute)
+		assert.Nil(t, repo.Create(schemas.Item{ID: id, Name: "item" + strconv.Itoa(id), Tags: []string{}, CreatedAt: at, UpdatedAt: at}))
+	}
+
+	// Al quinto evento i primi tre sono stati compattati: la storia parte dal terzo
+	items, err := repo.ListAt(start.Add(3 * time.Minute))
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+	items, err = repo.ListAt(start.Add(5*time.Minute + 30*time.Second))
+	assert.Nil(t, err)
+	assert.Len(t, items, 5)
+	_, err = repo.ListAt(start.Add(2 * time.Minute))
+	assert.Equal(t, repository.ErrHistoryTrimmed, err)
+	assert.Len(t, repo.List(), 6)
+
+	req, _ := http.NewRequest("GET", "/items?as_of="+url.QueryEscape(start.Format(time.RFC3339Nano)), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+
+	var latest []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items?as_of="+url.QueryEscape(start.Add(10*time.Minute).Format(time.RFC3339Nano)), &latest))
+	assert.Len(t, latest, 6)
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pngHeader basta a far riconoscere il contenuto come image/png
+var pngHeader = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R'}
+
+func setupBlobStore(t *testing.T) string {
+	dir := t.TempDir()
+	store, err := repository.NewFileBlobStore(dir)
+	assert.NoError(t, err)
+	controllers.SetBlobStore(store)
+	controllers.SetAttachmentLimits(1024, nil)
+	return dir
+}
+
+func uploadFile(router http.Handler, url, fileName string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", fileName)
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadAndDownloadAttachment(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+
+	content := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{'x'}, 100)...)
+	w := uploadFile(router, "/items/1/attachments", "../photo.png", content)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var attachment schemas.Attachment
+	json.Unmarshal(w.Body.Bytes(), &attachment)
+	assert.Equal(t, "image/png", attachment.ContentType)
+	assert.Equal(t, "photo.png", attachment.FileName)
+	assert.Equal(t, int64(len(content)), attachment.Size)
+
+	var attachments []schemas.Attachment
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1/attachments", &attachments))
+	assert.Len(t, attachments, 1)
+
+	// Download completo
+	req, _ := http.NewRequest("GET", "/items/1/attachments/"+attachment.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, content, w.Body.Bytes())
+
+	// Download parziale
+	req, _ = http.NewRequest("GET", "/items/1/attachments/"+attachment.ID, nil)
+	req.Header.Set("Range", "bytes=0-7")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, content[:8], w.Body.Bytes())
+	assert.Equal(t, "bytes 0-7/116", w.Header().Get("Content-Range"))
+
+	req, _ = http.NewRequest("DELETE", "/items/1/attachments/"+attachment.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req, _ = http.NewRequest("GET", "/items/1/attachments/"+attachment.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "attachment_not_found", decodeProblem(t, w).Code)
+}
+
+func TestUploadAttachmentLimits(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+
+	// Il tipo è riconosciuto dal contenuto, non dall'estensione
+	w := uploadFile(router, "/items/1/attachments", "notes.png", []byte("just some text"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "unsupported_media_type", decodeProblem(t, w).Code)
+
+	content := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{'x'}, 2048)...)
+	w = uploadFile(router, "/items/1/attachments", "big.png", content)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "attachment_too_large", decodeProblem(t, w).Code)
+
+	w = uploadFile(router, "/items/99/attachments", "photo.png", pngHeader)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var attachments []schemas.Attachment
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1/attachments", &attachments))
+	assert.Empty(t, attachments)
+}
+
+func TestPurgeRemovesAttachments(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	dir := setupBlobStore(t)
+	controllers.SetTrashRetention(time.Hour)
+
+	w := uploadFile(router, "/items/1/attachments", "photo.png", pngHeader)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Nel cestino l'item conserva i suoi allegati, così può essere ripristinato
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+	_, err := os.Stat(filepath.Join(dir, "items", "1"))
+	assert.NoError(t, err)
+
+	purged, err := controllers.PurgeTrash(time.Now().Add(2 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = os.Stat(filepath.Join(dir, "items", "1"))
+	assert.True(t, os.IsNotExist(err))
+	assert.False(t, mr.Exists("attachments:1"))
+}
+
+func TestAttachmentsStoredInRedis(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+
+	var ids []string
+	for _, name := range []string{"front.png", "back.png"} {
+		w := uploadFile(router, "/items/1/attachments", name, pngHeader)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var attachment schemas.Attachment
+		json.Unmarshal(w.Body.Bytes(), &attachment)
+		ids = append(ids, attachment.ID)
+	}
+
+	// I metadati sono in Redis, condivisi dalle repliche e conservati dopo un riavvio
+	fields, err := mr.HKeys("attachments:1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, ids, fields)
+
+	var attachments []schemas.Attachment
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1/attachments", &attachments))
+	assert.Len(t, attachments, 2)
+	assert.Equal(t, "front.png", attachments[0].FileName)
+	assert.Equal(t, "back.png", attachments[1].FileName)
+
+	req, _ := http.NewRequest("DELETE", "/items/1/attachments/"+ids[0], nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	fields, _ = mr.HKeys("attachments:1")
+	assert.Equal(t, []string{ids[1]}, fields)
+}
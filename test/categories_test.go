@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func getJSON(t *testing.T, router http.Handler, url string, target interface{}) int {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), target))
+	}
+	return w.Code
+}
+
+func TestCategoryCRUD(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	w := sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created schemas.Category
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, 1, created.ID)
+
+	// Nome duplicato
+	w = sendItem(router, "POST", "/categories", `{"name": "office"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var categories []schemas.Category
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/categories", &categories))
+	assert.Len(t, categories, 1)
+
+	w = sendItem(router, "PUT", "/categories/1", `{"name": "Home office"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// La modifica invalida la cache
+	var category schemas.Category
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/categories/1", &category))
+	assert.Equal(t, "Home office", category.Name)
+	_, err := client.Get("categories:all").Result()
+	assert.Equal(t, redis.Nil, err)
+
+	req, _ := http.NewRequest("DELETE", "/categories/1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/categories/1", &category))
+}
+
+func TestCategoryItems(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+
+	// Un item non può riferirsi a una categoria inesistente
+	w := sendItem(router, "POST", "/items", `{"name": "Lamp", "category_id": 42}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "exists", decodeValidationErrors(t, w)["category_id"])
+
+	var items []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/categories/1/items", &items))
+	assert.Len(t, items, 0)
+
+	// La creazione di un item invalida la lista della categoria
+	w = sendItem(router, "POST", "/items", `{"name": "Lamp", "category_id": 1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/categories/1/items", &items))
+	assert.Len(t, items, 1)
+	assert.True(t, mr.Exists("categories:1:items"))
+
+	// Lo spostamento di un item invalida la lista della categoria di origine
+	w = sendItem(router, "PUT", "/items/3", `{"name": "Lamp"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/categories/1/items", &items))
+	assert.Len(t, items, 0)
+
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/categories/9/items", &items))
+}
+
+func TestDeleteCategoryRestrictAndCascade(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "POST", "/items", `{"name": "Lamp", "category_id": 1}`)
+
+	req, _ := http.NewRequest("DELETE", "/categories/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "category_not_empty", decodeProblem(t, w).Code)
+
+	assert.Nil(t, controllers.SetCategoryDeleteMode(controllers.CategoryDeleteCascade))
+	assert.NotNil(t, controllers.SetCategoryDeleteMode("sometimes"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	var item schemas.Item
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/3", &item))
+	var items []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items", &items))
+	assert.Len(t, items, 2)
+}
+
+func TestCategoriesConcurrentAccess(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	// Creazioni, eliminazioni e letture v2 insieme: con -race nessun accesso non sincronizzato
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			sendItem(router, "POST", "/categories", `{"name": "Category `+strconv.Itoa(i)+`"}`)
+			sendItem(router, "DELETE", "/categories/"+strconv.Itoa(i+1), ``)
+		}(i)
+		go func() {
+			defer wg.Done()
+			getVersioned(router, "/v2/items", "")
+		}()
+	}
+	wg.Wait()
+
+	// Gli ID assegnati sono tutti diversi
+	var categories []schemas.Category
+	getJSON(t, router, "/categories", &categories)
+	seen := map[int]bool{}
+	for _, category := range categories {
+		assert.False(t, seen[category.ID], category.ID)
+		seen[category.ID] = true
+	}
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sseFrame è un evento letto dallo stream
+type sseFrame struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+func openEventStream(t *testing.T, server *httptest.Server, lastEventID string) *bufio.Reader {
+	req, _ := http.NewRequest("GET", server.URL+"/items/events", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+func readFrame(t *testing.T, reader *bufio.Reader) sseFrame {
+	var frame sseFrame
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return frame
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if frame.Event != "" {
+				return frame
+			}
+		case strings.HasPrefix(line, "id:"):
+			frame.ID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			frame.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			frame.Data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func readItemEvent(t *testing.T, reader *bufio.Reader) schemas.ItemEvent {
+	frame := readFrame(t, reader)
+	var event schemas.ItemEvent
+	assert.NoError(t, json.Unmarshal([]byte(frame.Data), &event))
+	assert.Equal(t, frame.Event, event.Type)
+	return event
+}
+
+func changeItems(router http.Handler) {
+	sendItem(router, "POST", "/items", `{"name": "item three"}`)
+	sendItem(router, "PUT", "/items/3", `{"name": "item three updated"}`)
+	deleteItem(router, "1")
+}
+
+func TestItemEventsStream(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	// Registrato prima delle connessioni, così viene chiuso dopo di loro
+	t.Cleanup(server.Close)
+
+	reader := openEventStream(t, server, "")
+	changeItems(router)
+
+	event := readItemEvent(t, reader)
+	assert.Equal(t, int64(1), event.ID)
+	assert.Equal(t, schemas.EventCreated, event.Type)
+	assert.Equal(t, 3, event.ItemID)
+	assert.Equal(t, "item three", event.Item.Name)
+
+	event = readItemEvent(t, reader)
+	assert.Equal(t, schemas.EventUpdated, event.Type)
+	assert.Equal(t, "item three updated", event.Item.Name)
+
+	event = readItemEvent(t, reader)
+	assert.Equal(t, int64(3), event.ID)
+	assert.Equal(t, schemas.EventDeleted, event.Type)
+	assert.Equal(t, 1, event.ItemID)
+}
+
+func TestItemEventsResume(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	changeItems(router)
+
+	// Gli eventi successivi a Last-Event-ID vengono rimandati
+	reader := openEventStream(t, server, "1")
+	assert.Equal(t, int64(2), readItemEvent(t, reader).ID)
+	assert.Equal(t, int64(3), readItemEvent(t, reader).ID)
+
+	// Poi lo stream continua con le nuove modifiche
+	deleteItem(router, "2")
+	event := readItemEvent(t, reader)
+	assert.Equal(t, int64(4), event.ID)
+	assert.Equal(t, 2, event.ItemID)
+}
+
+func TestItemEventsResumeAfterBuffer(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetEventBufferSize(2)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	changeItems(router)
+
+	// Il primo evento non è più nel buffer: il client deve ricaricare gli items
+	reader := openEventStream(t, server, "0")
+	frame := readFrame(t, reader)
+	assert.Equal(t, "reset", frame.Event)
+	assert.Equal(t, "3", frame.ID)
+	assert.Equal(t, int64(2), readItemEvent(t, reader).ID)
+	assert.Equal(t, int64(3), readItemEvent(t, reader).ID)
+}
+
+func TestItemEventsInvalidLastEventID(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/items/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSourcedRepositoryReplay(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	repo, err := repository.OpenEventSourcedItemRepository(dir, 0)
+	assert.Nil(t, err)
+
+	item := schemas.Item{ID: 1, Name: "Lamp", Tags: []string{}, CreatedAt: created, UpdatedAt: created}
+	assert.Nil(t, repo.Create(item))
+
+	item.Name = "Desk lamp"
+	item.UpdatedAt = created.Add(time.Hour)
+	assert.Nil(t, repo.Update(item))
+
+	item.Quantity = 4
+	item.UpdatedAt = created.Add(2 * time.Hour)
+	assert.Nil(t, repo.Update(item))
+
+	assert.Nil(t, repo.Delete(1, created.Add(3*time.Hour)))
+	assert.Equal(t, repository.ErrNotFound, repo.Delete(2, created))
+
+	events, err := repo.Events()
+	assert.Nil(t, err)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		repository.EventItemCreated,
+		repository.EventItemRenamed,
+		repository.EventItemUpdated,
+		repository.EventItemDeleted,
+	}, types)
+	assert.Nil(t, repo.Close())
+
+	// Riapre il log e ricostruisce lo stato
+	reopened, err := repository.OpenEventSourcedItemRepository(dir, 0)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	items := reopened.List()
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Desk lamp", items[0].Name)
+	assert.Equal(t, 4, items[0].Quantity)
+	assert.NotNil(t, items[0].DeletedAt)
+
+	// Lettura nel passato
+	past, err := reopened.ListAt(created.Add(90 * time.Minute))
+	assert.Nil(t, err)
+	assert.Len(t, past, 1)
+	assert.Equal(t, "Desk lamp", past[0].Name)
+	assert.Equal(t, 0, past[0].Quantity)
+	assert.Nil(t, past[0].DeletedAt)
+}
+
+func TestEventSourcedRepositorySnapshots(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+
+	repo, err := repository.OpenEventSourcedItemRepository(dir, 2)
+	assert.Nil(t, err)
+	for id := 1; id <= 3; id++ {
+		assert.Nil(t, repo.Create(schemas.Item{ID: id, Name: "item" + strconv.Itoa(id), CreatedAt: now, UpdatedAt: now}))
+	}
+	assert.Nil(t, repo.Purge([]int{2}))
+	assert.Nil(t, repo.Close())
+
+	// Lo snapshot è stato preso dopo il secondo e il quarto evento
+	var snap struct {
+		Seq int64 `json:"seq"`
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "snapshot.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, &snap))
+	assert.Equal(t, int64(4), snap.Seq)
+
+	// Una riga scritta a metà in fondo al log viene scartata
+	f, _ := os.OpenFile(filepath.Join(dir, "events.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"seq":5,"type":"ItemDel`)
+	f.Close()
+
+	reopened, err := repository.OpenEventSourcedItemRepository(dir, 2)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	var ids []int
+	for _, item := range reopened.List() {
+		ids = append(ids, item.ID)
+	}
+	assert.Equal(t, []int{1, 3}, ids)
+
+	assert.Nil(t, reopened.Delete(1, now))
+	events, err := reopened.Events()
+	assert.Nil(t, err)
+	assert.Len(t, events, 5)
+}
+
+func TestEventSourcedListAtStartsFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	repo, err := repository.OpenEventSourcedItemRepository(dir, 2)
+	assert.Nil(t, err)
+	for id := 1; id <= 6; id++ {
+		at := start.Add(time.Duration(id) * time.Hour)
+		assert.Nil(t, repo.Create(schemas.Item{ID: id, Name: "item" + strconv.Itoa(id), CreatedAt: at, UpdatedAt: at}))
+	}
+	assert.Equal(t, start.Add(6*time.Hour), repo.LastEventAt())
+	assert.Nil(t, repo.Close())
+
+	// Gli snapshot precedenti restano su disco
+	entries, err := os.ReadDir(filepath.Join(dir, "snapshots"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 3)
+
+	reopened, err := repository.OpenEventSourcedItemRepository(dir, 2)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	// Con l'inizio del log illeggibile, ListAt funziona solo se parte dagli snapshot
+	f, _ := os.OpenFile(filepath.Join(dir, "events.log"), os.O_WRONLY, 0o644)
+	f.WriteAt([]byte("#"), 0)
+	f.Close()
+
+	items, err := reopened.ListAt(start.Add(5*time.Hour + 30*time.Minute))
+	assert.Nil(t, err)
+	assert.Len(t, items, 5)
+	items, err = reopened.ListAt(start.Add(3 * time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+	_, err = reopened.ListAt(start.Add(time.Hour))
+	assert.Error(t, err)
+}
+
+func TestEventSourcedRepositoryBehindControllers(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	repo, err := repository.OpenEventSourcedItemRepository(t.TempDir(), 10)
+	assert.Nil(t, err)
+	defer repo.Close()
+	controllers.SetItemRepository(repo)
+
+	w := sendItem(router, "POST", "/items", `{"name": "Lamp"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = sendItem(router, "PUT", "/items/1", `{"name": "Desk lamp"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+	w = sendItem(router, "POST", "/items/1/restore", ``)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var item schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1", &item))
+	assert.Equal(t, "Desk lamp", item.Name)
+
+	events, err := repo.Events()
+	assert.Nil(t, err)
+	assert.Len(t, events, 4)
+	assert.Equal(t, repository.EventItemRestored, events[3].Type)
+}
+
+func TestEventTimesFollowCommitOrder(t *testing.T) {
+	later := time.Now().UTC()
+	earlier := later.Add(-time.Second)
+
+	eventSourced, err := repository.OpenEventSourcedItemRepository(t.TempDir(), 0)
+	assert.Nil(t, err)
+	defer eventSourced.Close()
+
+	for _, repo := range []repository.ItemRepository{repository.NewMemoryItemRepository(nil), eventSourced} {
+		created, err := repo.CreateNext(schemas.Item{Name: "Lamp", Tags: []string{}, CreatedAt: later, UpdatedAt: later})
+		assert.Nil(t, err)
+
+		// Una modifica preparata prima ma salvata dopo non può finire prima nel tempo:
+		// ListAt degli istanti già passati non cambia
+		updated := created
+		updated.Quantity = 3
+		updated.UpdatedAt = earlier
+		assert.Nil(t, repo.Update(updated))
+
+		after, _ := repo.ListAt(earlier.Add(time.Millisecond))
+		assert.Empty(t, after)
+		assert.Equal(t, later, repo.LastEventAt())
+		items := repo.List()
+		assert.Equal(t, later, items[0].UpdatedAt)
+		assert.Equal(t, 3, items[0].Quantity)
+	}
+}
+
+func TestCreateChecksIDAndName(t *testing.T) {
+	now := time.Now().UTC()
+
+	eventSourced, err := repository.OpenEventSourcedItemRepository(t.TempDir(), 0)
+	assert.Nil(t, err)
+	defer eventSourced.Close()
+
+	for _, repo := range []repository.ItemRepository{repository.NewMemoryItemRepository(nil), eventSourced} {
+		assert.Nil(t, repo.Create(schemas.Item{ID: 5, Name: "Lamp", Tags: []string{}, CreatedAt: now, UpdatedAt: now}))
+		assert.Equal(t, repository.ErrIDTaken, repo.Create(schemas.Item{ID: 5, Name: "Desk", CreatedAt: now, UpdatedAt: now}))
+		assert.Equal(t, repository.ErrNameTaken, repo.Create(schemas.Item{ID: 6, Name: " lamp", CreatedAt: now, UpdatedAt: now}))
+
+		// L'item creato con Create è nell'indice: CreateNext vede il nome e parte dal suo ID
+		_, err := repo.CreateNext(schemas.Item{Name: "LAMP", CreatedAt: now, UpdatedAt: now})
+		assert.Equal(t, repository.ErrNameTaken, err)
+		created, err := repo.CreateNext(schemas.Item{Name: "Desk", Tags: []string{}, CreatedAt: now, UpdatedAt: now})
+		assert.Nil(t, err)
+		assert.Equal(t, 6, created.ID)
+		assert.Len(t, repo.List(), 2)
+	}
+}
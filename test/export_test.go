@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"gin-try/schemas"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exportItems(t *testing.T, server *httptest.Server, url, accept string) *http.Response {
+	req, _ := http.NewRequest("GET", server.URL+url, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestExportItems(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	sendItem(router, "POST", "/items", `{"name": "Lamp", "tags": ["home", "light"], "price": "10.00"}`)
+	deleteItem(router, "2")
+
+	// Di default l'export è NDJSON, inviato a blocchi
+	resp := exportItems(t, server, "/items/export", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+	var names []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item schemas.Item
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+		names = append(names, item.Name)
+	}
+	// Gli items nel cestino non vengono esportati
+	assert.Equal(t, []string{"item one", "Lamp"}, names)
+
+	resp = exportItems(t, server, "/items/export?name=LAMP", "application/json")
+	var items []schemas.Item
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Lamp", items[0].Name)
+
+	resp = exportItems(t, server, "/items/export?name=nothing", "application/json")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "[]", string(body))
+
+	resp = exportItems(t, server, "/items/export?format=csv", "application/json")
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="items.csv"`, resp.Header.Get("Content-Disposition"))
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	// Anche le colonne omesse quando sono vuote fanno parte dell'intestazione
+	assert.Contains(t, records[0], "category_id")
+	assert.Equal(t, "Lamp", records[2][1])
+	assert.Equal(t, "home;light", records[2][3])
+}
+
+func TestExportItemsNegotiation(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	w := sendAs(router, "GET", "/items/export", "text/*", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = sendAs(router, "GET", "/items/export", "application/xml", "", nil)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "not_acceptable", decodeProblem(t, w).Code)
+
+	w = sendAs(router, "GET", "/items/export?format=xml", "", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+
+	// Con più items di un blocco l'export li contiene comunque tutti
+	for i := 0; i < 600; i++ {
+		sendItem(router, "POST", "/items", `{"name": "bulk `+strconv.Itoa(i)+`"}`)
+	}
+	w = sendAs(router, "GET", "/items/export?name=bulk", "", "", nil)
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(t, 600, lines)
+}
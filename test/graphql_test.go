@@ -0,0 +1,324 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// graphqlResult è una GraphQLResponse con data ancora da decodificare
+type graphqlResult struct {
+	Data   json.RawMessage        `json:"data"`
+	Errors []schemas.GraphQLError `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, router http.Handler, query string, variables map[string]interface{}, data interface{}) []schemas.GraphQLError {
+	body, _ := json.Marshal(schemas.GraphQLRequest{Query: query, Variables: variables})
+	w := sendItem(router, "POST", "/graphql", string(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result graphqlResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	if data != nil && len(result.Data) > 0 {
+		assert.NoError(t, json.Unmarshal(result.Data, data))
+	}
+	return result.Errors
+}
+
+type graphqlItem struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Tags       []string `json:"tags"`
+	Price      string   `json:"price"`
+	Quantity   int      `json:"quantity"`
+	CategoryID *string  `json:"categoryId"`
+}
+
+type graphqlItemsPage struct {
+	Items struct {
+		Edges []struct {
+			Cursor string      `json:"cursor"`
+			Node   graphqlItem `json:"node"`
+		} `json:"edges"`
+		PageInfo struct {
+			HasNextPage bool    `json:"hasNextPage"`
+			EndCursor   *string `json:"endCursor"`
+		} `json:"pageInfo"`
+		TotalCount int `json:"totalCount"`
+	} `json:"items"`
+}
+
+const itemsPageQuery = `query($first: Int, $after: String, $search: String) {
+	items(first: $first, after: $after, search: $search) {
+		edges { cursor node { id name } }
+		pageInfo { hasNextPage endCursor }
+		totalCount
+	}
+}`
+
+func TestGraphQLItemsPagination(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	var page graphqlItemsPage
+	errs := postGraphQL(t, router, itemsPageQuery, map[string]interface{}{"first": 1}, &page)
+	assert.Empty(t, errs)
+	assert.Equal(t, 2, page.Items.TotalCount)
+	assert.Len(t, page.Items.Edges, 1)
+	assert.Equal(t, "item one", page.Items.Edges[0].Node.Name)
+	assert.True(t, page.Items.PageInfo.HasNextPage)
+	// La lista viene letta dalla stessa cache degli endpoint REST
+	assert.True(t, mr.Exists("items:all"))
+
+	errs = postGraphQL(t, router, itemsPageQuery, map[string]interface{}{"first": 1, "after": *page.Items.PageInfo.EndCursor}, &page)
+	assert.Empty(t, errs)
+	assert.Len(t, page.Items.Edges, 1)
+	assert.Equal(t, "2", page.Items.Edges[0].Node.ID)
+	assert.False(t, page.Items.PageInfo.HasNextPage)
+
+	errs = postGraphQL(t, router, itemsPageQuery, map[string]interface{}{"search": "TWO"}, &page)
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, page.Items.TotalCount)
+	assert.Equal(t, "item two", page.Items.Edges[0].Node.Name)
+
+	errs = postGraphQL(t, router, itemsPageQuery, map[string]interface{}{"after": "not a cursor"}, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "invalid_parameter", errs[0].Extensions["code"])
+	}
+}
+
+func TestGraphQLItem(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	const query = `query($id: ID!) { item(id: $id) { id name tags price quantity categoryId } }`
+
+	var data struct {
+		Item *graphqlItem `json:"item"`
+	}
+	errs := postGraphQL(t, router, query, map[string]interface{}{"id": "1"}, &data)
+	assert.Empty(t, errs)
+	if assert.NotNil(t, data.Item) {
+		assert.Equal(t, "item one", data.Item.Name)
+		assert.Equal(t, "0.00", data.Item.Price)
+		assert.Equal(t, []string{}, data.Item.Tags)
+		assert.Nil(t, data.Item.CategoryID)
+	}
+	assert.True(t, mr.Exists("items:1"))
+
+	// Un item inesistente è null
+	data.Item = nil
+	errs = postGraphQL(t, router, query, map[string]interface{}{"id": "99"}, &data)
+	assert.Empty(t, errs)
+	assert.Nil(t, data.Item)
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	getJSON(t, router, "/items", &[]schemas.Item{})
+
+	var created struct {
+		CreateItem graphqlItem `json:"createItem"`
+	}
+	errs := postGraphQL(t, router, `mutation($input: ItemInput!) { createItem(input: $input) { id name tags price quantity } }`,
+		map[string]interface{}{"input": map[string]interface{}{"name": "item three", "tags": []string{"a", "a"}, "price": "12.5", "quantity": 3}}, &created)
+	assert.Empty(t, errs)
+	assert.Equal(t, "3", created.CreateItem.ID)
+	assert.Equal(t, "item three", created.CreateItem.Name)
+	assert.Equal(t, []string{"a"}, created.CreateItem.Tags)
+	assert.Equal(t, "12.50", created.CreateItem.Price)
+
+	// La cache della lista viene invalidata come per POST /items
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 3)
+
+	var updated struct {
+		UpdateItem graphqlItem `json:"updateItem"`
+	}
+	errs = postGraphQL(t, router, `mutation { updateItem(id: "3", input: {name: "item three updated"}) { name price } }`, nil, &updated)
+	assert.Empty(t, errs)
+	assert.Equal(t, "item three updated", updated.UpdateItem.Name)
+	assert.Equal(t, "0.00", updated.UpdateItem.Price)
+
+	var item schemas.Item
+	getJSON(t, router, "/items/3", &item)
+	assert.Equal(t, "item three updated", item.Name)
+
+	var deleted struct {
+		DeleteItem string `json:"deleteItem"`
+	}
+	errs = postGraphQL(t, router, `mutation { deleteItem(id: "3") }`, nil, &deleted)
+	assert.Empty(t, errs)
+	assert.Equal(t, "3", deleted.DeleteItem)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/3", &item))
+
+	errs = postGraphQL(t, router, `mutation { deleteItem(id: "3") }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "item_not_found", errs[0].Extensions["code"])
+		assert.Equal(t, float64(http.StatusNotFound), errs[0].Extensions["status"])
+	}
+}
+
+func TestGraphQLValidation(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	errs := postGraphQL(t, router, `mutation { createItem(input: {name: "item one", price: "1.234", quantity: -1, categoryId: "9"}) { id } }`, nil, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "validation_failed", errs[0].Extensions["code"])
+		rules := map[string]string{}
+		for _, fe := range errs[0].Extensions["errors"].([]interface{}) {
+			fe := fe.(map[string]interface{})
+			rules[fe["field"].(string)] = fe["rule"].(string)
+		}
+		assert.Equal(t, map[string]string{"name": "unique", "price": "decimal", "quantity": "min", "category_id": "exists"}, rules)
+	}
+
+	// Gli errori di sintassi arrivano dalla libreria, senza codice
+	errs = postGraphQL(t, router, `{ items { nope } }`, nil, nil)
+	assert.NotEmpty(t, errs)
+
+	w := sendItem(router, "POST", "/graphql", `{"query": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "malformed_body", decodeProblem(t, w).Code)
+}
+
+func dialGraphQL(t *testing.T, server *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/graphql"
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, resp, err := dialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "graphql-transport-ws", resp.Header.Get("Sec-WebSocket-Protocol"))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readGraphQLMessage(t *testing.T, conn *websocket.Conn) schemas.GraphQLWSMessage {
+	var msg schemas.GraphQLWSMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func sendGraphQLOperation(t *testing.T, conn *websocket.Conn, id, query string) {
+	payload, _ := json.Marshal(schemas.GraphQLRequest{Query: query})
+	assert.NoError(t, conn.WriteJSON(schemas.GraphQLWSMessage{ID: id, Type: schemas.GraphQLWSSubscribe, Payload: payload}))
+}
+
+type graphqlItemChanged struct {
+	Data struct {
+		ItemChanged struct {
+			Type   string       `json:"type"`
+			ItemID string       `json:"itemId"`
+			Item   *graphqlItem `json:"item"`
+		} `json:"itemChanged"`
+	} `json:"data"`
+}
+
+func TestGraphQLSubscriptions(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, controllers.StartItemEventRelay(ctx))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn := dialGraphQL(t, server)
+	assert.NoError(t, conn.WriteJSON(schemas.GraphQLWSMessage{Type: schemas.GraphQLWSConnectionInit}))
+	assert.Equal(t, schemas.GraphQLWSConnectionAck, readGraphQLMessage(t, conn).Type)
+
+	assert.NoError(t, conn.WriteJSON(schemas.GraphQLWSMessage{Type: schemas.GraphQLWSPing}))
+	assert.Equal(t, schemas.GraphQLWSPong, readGraphQLMessage(t, conn).Type)
+
+	sendGraphQLOperation(t, conn, "one", `subscription { itemChanged(itemId: "1") { type itemId item { name } } }`)
+	// Attende che la subscription sia registrata prima di modificare l'item
+	sendGraphQLOperation(t, conn, "query", `{ item(id: "2") { name } }`)
+	assert.Equal(t, schemas.GraphQLWSNext, readGraphQLMessage(t, conn).Type)
+	assert.Equal(t, schemas.GraphQLWSComplete, readGraphQLMessage(t, conn).Type)
+
+	sendItem(router, "PUT", "/items/2", `{"name": "item two updated"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one updated"}`)
+
+	msg := readGraphQLMessage(t, conn)
+	assert.Equal(t, schemas.GraphQLWSNext, msg.Type)
+	assert.Equal(t, "one", msg.ID)
+	var changed graphqlItemChanged
+	json.Unmarshal(msg.Payload, &changed)
+	assert.Equal(t, "UPDATED", changed.Data.ItemChanged.Type)
+	assert.Equal(t, "1", changed.Data.ItemChanged.ItemID)
+	assert.Equal(t, "item one updated", changed.Data.ItemChanged.Item.Name)
+
+	// Dopo complete il client non riceve più eventi per quella subscription
+	assert.NoError(t, conn.WriteJSON(schemas.GraphQLWSMessage{ID: "one", Type: schemas.GraphQLWSComplete}))
+	sendGraphQLOperation(t, conn, "bad", `subscription { itemChanged(itemId: "1", search: "item") { type } }`)
+	msg = readGraphQLMessage(t, conn)
+	assert.Equal(t, "bad", msg.ID)
+	assert.Equal(t, schemas.GraphQLWSError, msg.Type)
+	var errs []schemas.GraphQLError
+	json.Unmarshal(msg.Payload, &errs)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "invalid_parameter", errs[0].Extensions["code"])
+	}
+
+	deleteItem(router, "1")
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestGraphQLSubscriptionsProtocolErrors(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	// Le operazioni richiedono connection_init
+	conn := dialGraphQL(t, server)
+	sendGraphQLOperation(t, conn, "1", `{ item(id: "1") { name } }`)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, 4401), "unexpected error %v", err)
+
+	conn = dialGraphQL(t, server)
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, 4400), "unexpected error %v", err)
+}
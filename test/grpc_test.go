@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"gin-try/controllers"
+	"gin-try/proto/itemspb"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialItemService avvia il server gRPC in memoria e restituisce un client collegato
+func dialItemService(t *testing.T) itemspb.ItemServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	server := controllers.NewGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return itemspb.NewItemServiceClient(conn)
+}
+
+func TestGRPCItemService(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	items := dialItemService(t)
+	ctx := context.Background()
+
+	list, err := items.ListItems(ctx, &itemspb.ListItemsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 2)
+	// La lista viene letta dalla stessa cache degli endpoint REST
+	assert.True(t, mr.Exists("items:all"))
+
+	created, err := items.CreateItem(ctx, &itemspb.CreateItemRequest{Item: &itemspb.ItemInput{Name: "item three", Price: "12.5", Tags: []string{"a", "a"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), created.Id)
+	assert.Equal(t, "12.50", created.Price)
+	assert.Equal(t, []string{"a"}, created.Tags)
+	assert.False(t, created.CreatedAt.AsTime().IsZero())
+
+	// Le modifiche fatte via gRPC sono visibili via REST
+	var item struct{ Name string }
+	getJSON(t, router, "/items/3", &item)
+	assert.Equal(t, "item three", item.Name)
+
+	updated, err := items.UpdateItem(ctx, &itemspb.UpdateItemRequest{Id: 3, Item: &itemspb.ItemInput{Name: "item three updated"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "item three updated", updated.Name)
+
+	found, err := items.SearchItems(ctx, &itemspb.SearchItemsRequest{Name: "UPDATED"})
+	assert.NoError(t, err)
+	assert.Len(t, found.Items, 1)
+
+	_, err = items.DeleteItem(ctx, &itemspb.DeleteItemRequest{Id: 3})
+	assert.NoError(t, err)
+	_, err = items.GetItem(ctx, &itemspb.GetItemRequest{Id: 3})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCItemServiceErrors(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	setupRouter()
+	items := dialItemService(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "it")
+
+	_, err := items.CreateItem(ctx, &itemspb.CreateItemRequest{Item: &itemspb.ItemInput{Name: "item one", Price: "1.234", Quantity: -1}})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "Uno o più campi non sono validi", st.Message())
+
+	violations := map[string]bool{}
+	var reason string
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = detail.Reason
+		case *errdetails.BadRequest:
+			for _, v := range detail.FieldViolations {
+				violations[v.Field] = true
+			}
+		}
+	}
+	assert.Equal(t, "validation_failed", reason)
+	assert.Equal(t, map[string]bool{"item.name": true, "item.price": true, "item.quantity": true}, violations)
+
+	_, err = items.SearchItems(ctx, &itemspb.SearchItemsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCWatchItems(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, controllers.StartItemEventRelay(ctx))
+	items := dialItemService(t)
+
+	stream, err := items.WatchItems(ctx, &itemspb.WatchItemsRequest{ItemId: 1})
+	assert.NoError(t, err)
+	// Gli header arrivano quando il watch è registrato
+	_, err = stream.Header()
+	assert.NoError(t, err)
+
+	sendItem(router, "PUT", "/items/2", `{"name": "item two updated"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one updated"}`)
+	deleteItem(router, "1")
+
+	event, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, itemspb.ItemEventType_ITEM_EVENT_TYPE_UPDATED, event.Type)
+	assert.Equal(t, "item one updated", event.Item.Name)
+
+	event, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, itemspb.ItemEventType_ITEM_EVENT_TYPE_DELETED, event.Type)
+	assert.Equal(t, int64(1), event.ItemId)
+
+	invalid, err := items.WatchItems(ctx, &itemspb.WatchItemsRequest{ItemId: 1, Search: "item"})
+	assert.NoError(t, err)
+	_, err = invalid.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
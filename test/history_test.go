@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"gin-try/controllers"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendAsActor(router http.Handler, method, url, actor, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", actor)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestItemHistory(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	sendAsActor(router, "POST", "/items", "alice", `{"name": "Lamp", "price": "10.00"}`)
+	sendAsActor(router, "PUT", "/items/3", "bob", `{"name": "Desk lamp", "price": "10.00"}`)
+	sendAsActor(router, "DELETE", "/items/3", "carol", ``)
+
+	var history []schemas.Revision
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/3/history", &history))
+	assert.Len(t, history, 3)
+
+	assert.Equal(t, schemas.ActionCreate, history[0].Action)
+	assert.Equal(t, "alice", history[0].Actor)
+	assert.Nil(t, history[0].Before)
+
+	assert.Equal(t, schemas.ActionUpdate, history[1].Action)
+	assert.Equal(t, "bob", history[1].Actor)
+	assert.Equal(t, []schemas.FieldChange{{Field: "name", Before: "Lamp", After: "Desk lamp"}}, history[1].Changes)
+
+	assert.Equal(t, schemas.ActionDelete, history[2].Action)
+	assert.Equal(t, "carol", history[2].Actor)
+	assert.Nil(t, history[2].After)
+
+	// Gli items senza modifiche hanno uno storico vuoto, quelli inesistenti no
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1/history", &history))
+	assert.Len(t, history, 0)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/99/history", &history))
+
+	// Lo storico è in Redis: un nuovo processo con la stessa sorgente dati lo ritrova
+	assert.True(t, mr.Exists("history:3"))
+	controllers.SetItemRepository(repository.NewMemoryItemRepository(nil))
+	router = gin.New()
+	router.Use(controllers.ErrorHandler())
+	controllers.RegisterAPIRoutes(router.Group("", controllers.APIVersion(0), controllers.Negotiate()))
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/3/history", &history))
+	assert.Len(t, history, 3)
+	assert.Equal(t, 3, history[2].Revision)
+}
+
+func TestRevertItem(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	sendAsActor(router, "POST", "/items", "alice", `{"name": "Lamp", "quantity": 1}`)
+	sendAsActor(router, "PUT", "/items/3", "bob", `{"name": "Desk lamp", "quantity": 5}`)
+	sendAsActor(router, "DELETE", "/items/3", "bob", ``)
+
+	// Non si può tornare a un'eliminazione
+	w := sendAsActor(router, "POST", "/items/3/history/3/revert", "alice", ``)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = sendAsActor(router, "POST", "/items/3/history/9/revert", "alice", ``)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "revision_not_found", decodeProblem(t, w).Code)
+
+	// Il revert ripristina anche un item nel cestino
+	w = sendAsActor(router, "POST", "/items/3/history/1/revert", "alice", ``)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var item schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/3", &item))
+	assert.Equal(t, "Lamp", item.Name)
+	assert.Equal(t, 1, item.Quantity)
+
+	var history []schemas.Revision
+	getJSON(t, router, "/items/3/history", &history)
+	assert.Len(t, history, 4)
+	assert.Equal(t, schemas.ActionRevert, history[3].Action)
+	assert.Equal(t, 1, history[3].RevertedTo)
+	assert.Equal(t, "alice", history[3].Actor)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHALItemLinks(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "quantity": 2, "category_id": 1}`)
+
+	w := sendAs(router, "GET", "/v2/items/1", "application/hal+json", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/hal+json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var item map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+	assert.Equal(t, "item one", item["name"])
+	// La rappresentazione è quella della versione richiesta
+	assert.Equal(t, true, item["in_stock"])
+	links := item["_links"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"href": "/v2/items/1"}, links["self"])
+	assert.Equal(t, map[string]interface{}{"href": "/v2/items"}, links["collection"])
+	assert.Equal(t, map[string]interface{}{"href": "/v2/items/1/history"}, links["history"])
+	assert.Equal(t, map[string]interface{}{"href": "/v2/categories/1"}, links["category"])
+
+	// Un item nel cestino può solo essere ripristinato
+	deleteItem(router, "1")
+	w = sendAs(router, "GET", "/items/trash", "application/hal+json", "", nil)
+	var trash map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &trash)
+	trashed := trash["_embedded"].(map[string]interface{})["items"].([]interface{})[0].(map[string]interface{})
+	trashedLinks := trashed["_links"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"href": "/items/1/restore"}, trashedLinks["restore"])
+	assert.NotContains(t, trashedLinks, "self")
+
+	// Anche le risposte delle scritture contengono i link
+	w = sendAs(router, "POST", "/items", "application/hal+json", "application/json", []byte(`{"name": "Lamp"}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "/items/3", created["_links"].(map[string]interface{})["self"].(map[string]interface{})["href"])
+}
+
+func TestPaginationLinks(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	for i := 0; i < 4; i++ {
+		sendItem(router, "POST", "/items", `{"name": "lamp `+strconv.Itoa(i)+`"}`)
+	}
+
+	w := sendAs(router, "GET", "/v2/items?page=2&per_page=2", "application/hal+json", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "6", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, []string{
+		`</v2/items?page=1&per_page=2>; rel="first"`,
+		`</v2/items?page=1&per_page=2>; rel="prev"`,
+		`</v2/items?page=3&per_page=2>; rel="next"`,
+		`</v2/items?page=3&per_page=2>; rel="last"`,
+	}, w.Header().Values("Link"))
+
+	var page map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, float64(2), page["count"])
+	assert.Equal(t, float64(6), page["total"])
+	links := page["_links"].(map[string]interface{})
+	assert.Equal(t, "/v2/items?page=2&per_page=2", links["self"].(map[string]interface{})["href"])
+	assert.Equal(t, "/v2/items?page=3&per_page=2", links["next"].(map[string]interface{})["href"])
+	embedded := page["_embedded"].(map[string]interface{})["items"].([]interface{})
+	assert.Equal(t, "lamp 0", embedded[0].(map[string]interface{})["name"])
+
+	// La paginazione vale in tutti i formati, e per la ricerca mantiene il filtro
+	w = sendAs(router, "GET", "/items/search?name=lamp&per_page=3", "", "", nil)
+	var items []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &items)
+	assert.Len(t, items, 3)
+	assert.Contains(t, w.Header().Values("Link"), `</items/search?name=lamp&page=2&per_page=3>; rel="next"`)
+
+	// Senza page e per_page la lista è completa e senza link
+	w = sendAs(router, "GET", "/items", "", "", nil)
+	json.Unmarshal(w.Body.Bytes(), &items)
+	assert.Len(t, items, 6)
+	assert.Empty(t, w.Header().Get("X-Total-Count"))
+
+	for _, url := range []string{"/items?page=0", "/items?per_page=101", "/items?per_page=abc"} {
+		w = sendAs(router, "GET", url, "", "", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code, url)
+	}
+}
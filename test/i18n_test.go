@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotFoundMessageLocalized(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	cases := map[string]string{
+		"":                        "Item not found",
+		"it-IT,it;q=0.9,en;q=0.8": "Item non trovato",
+		"fr-FR,en;q=0.5,it;q=0.7": "Item non trovato",
+		"de-DE":                   "Item not found",
+	}
+
+	for acceptLanguage, expected := range cases {
+		req, _ := http.NewRequest("GET", "/items/999", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var response schemas.Problem
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, response.Detail, acceptLanguage)
+	}
+}
+
+func TestValidationMessagesLocalized(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/items", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "it")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "it", w.Header().Get("Content-Language"))
+
+	var response schemas.Problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+	assert.Equal(t, "Validazione non riuscita", response.Title)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "name è un campo obbligatorio", response.Errors[0].Message)
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postItemWithKey(router http.Handler, key, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/items", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateItemIdempotentReplay(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	first := postItemWithKey(router, "retry-me", `{"name": "New Item"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	second := postItemWithKey(router, "retry-me", `{"name": "New Item"}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), second.Body.String())
+
+	// Il retry non deve aver creato un secondo item
+	req, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var items []schemas.Item
+	err := json.Unmarshal(w.Body.Bytes(), &items)
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+}
+
+func TestCreateItemIdempotencyKeyReuse(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	first := postItemWithKey(router, "same-key", `{"name": "New Item"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	second := postItemWithKey(router, "same-key", `{"name": "Another Item"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, second.Code)
+}
+
+func TestCreateItemIdempotencyFailureNotStored(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	first := postItemWithKey(router, "k1", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, first.Code)
+	assert.False(t, mr.Exists("idempotency:POST:/items:k1"))
+
+	// Il retry dello stesso body fallisce di nuovo invece di restituire un 200 vuoto
+	second := postItemWithKey(router, "k1", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, second.Code)
+	assert.Empty(t, second.Header().Get("Idempotent-Replayed"))
+
+	// Con il body corretto la stessa chiave crea l'item
+	fixed := postItemWithKey(router, "k1", `{"name": "fixed"}`)
+	assert.Equal(t, http.StatusCreated, fixed.Code)
+}
+
+func TestIdempotencyKeyReleasedAfterPanic(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	setupRouter()
+	controllers.SetIdempotencyLease(time.Minute)
+
+	// Un handler che va in panic alla prima richiesta
+	calls := 0
+	router := gin.New()
+	router.Use(gin.Recovery(), controllers.ErrorHandler())
+	router.POST("/flaky", controllers.Idempotency(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		c.JSON(http.StatusCreated, gin.H{"calls": calls})
+	})
+	post := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/flaky", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "flaky-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, post().Code)
+	// La chiave resta prenotata solo per il lease, non per l'intera finestra
+	assert.Equal(t, http.StatusConflict, post().Code)
+	mr.FastForward(time.Minute)
+
+	w := post()
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 2, calls)
+	// La risposta completata è ricordata per la finestra
+	assert.Greater(t, mr.TTL("idempotency:POST:/flaky:flaky-key"), time.Hour)
+	assert.Equal(t, "true", post().Header().Get("Idempotent-Replayed"))
+}
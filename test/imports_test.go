@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postImport(router http.Handler, url, contentType, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// waitForImport interroga lo stato dell'import finché non è terminato
+func waitForImport(t *testing.T, router http.Handler, w *httptest.ResponseRecorder) schemas.ImportJob {
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+
+	var job schemas.ImportJob
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		assert.Equal(t, http.StatusOK, getJSON(t, router, location, &job))
+		if job.Status != schemas.ImportQueued && job.Status != schemas.ImportRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("import %s still running", location)
+	return job
+}
+
+func TestImportItemsCSV(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	dir := setupBlobStore(t)
+	startJobWorkers(t)
+
+	body := "name,tags,price,quantity\n" +
+		"Lamp,home;light,10.00,3\n" +
+		"item one,,1.00,1\n" +
+		"Desk,,2.50,-1\n" +
+		"Chair,,abc,1\n" +
+		"Shelf,,5.00\n" +
+		"Table,office,99.90,1\n"
+	w := postImport(router, "/items/import", "text/csv", body)
+
+	var accepted schemas.ImportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, schemas.ImportQueued, accepted.Status)
+	assert.Equal(t, int64(len(body)), accepted.BytesTotal)
+
+	job := waitForImport(t, router, w)
+	assert.Equal(t, schemas.ImportCompleted, job.Status)
+	assert.Equal(t, 6, job.Processed)
+	assert.Equal(t, 2, job.Imported)
+	assert.Equal(t, 4, job.Failed)
+	assert.Equal(t, job.BytesTotal, job.BytesRead)
+	assert.NotNil(t, job.FinishedAt)
+	// Il file viene eliminato alla fine dell'import
+	entries, _ := os.ReadDir(filepath.Join(dir, "imports"))
+	assert.Empty(t, entries)
+
+	// Le righe sono numerate come nel file, intestazione compresa
+	failed := map[int]string{}
+	for _, e := range job.Errors {
+		failed[e.Line] = e.Code
+	}
+	assert.Equal(t, map[int]string{3: "validation_failed", 4: "validation_failed", 5: "malformed_body", 6: "malformed_body"}, failed)
+	assert.Equal(t, "unique", job.Errors[0].Errors[0].Rule)
+
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 4)
+	assert.Equal(t, "Lamp", items[2].Name)
+	assert.Equal(t, []string{"home", "light"}, items[2].Tags)
+	assert.Equal(t, "10.00", items[2].Price.String())
+}
+
+func TestImportItemsNDJSONDryRun(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+	startJobWorkers(t)
+
+	body := `{"name": "Lamp", "price": "10.00"}` + "\n" +
+		"\n" +
+		`{"name": "lamp"}` + "\n" +
+		`{"name": ` + "\n" +
+		`{"name": "Desk", "quantity": 2}` + "\n"
+	job := waitForImport(t, router, postImport(router, "/items/import?dry_run=true", "application/x-ndjson", body))
+
+	assert.Equal(t, schemas.ImportCompleted, job.Status)
+	assert.True(t, job.DryRun)
+	assert.Equal(t, 4, job.Processed)
+	assert.Equal(t, 2, job.Imported)
+	assert.Equal(t, 2, job.Failed)
+	// Anche senza salvare, un nome ripetuto nel file è un errore
+	assert.Equal(t, 3, job.Errors[0].Line)
+	assert.Equal(t, "validation_failed", job.Errors[0].Code)
+	assert.Equal(t, 4, job.Errors[1].Line)
+	assert.Equal(t, "malformed_body", job.Errors[1].Code)
+
+	// Un dry run non modifica gli items
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 2)
+}
+
+func TestImportItemsErrors(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	dir := setupBlobStore(t)
+	startJobWorkers(t)
+
+	w := postImport(router, "/items/import", "application/json", `[{"name": "Lamp"}]`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "unsupported_media_type", decodeProblem(t, w).Code)
+
+	w = postImport(router, "/items/import?dry_run=maybe", "text/csv", "name\nLamp\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+
+	var job schemas.ImportJob
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/import/unknown", &job))
+
+	// Una riga NDJSON oltre il limite interrompe l'import
+	job = waitForImport(t, router, postImport(router, "/items/import", "application/x-ndjson", `{"name": "`+strings.Repeat("a", 2<<20)+`"}`))
+	assert.Equal(t, schemas.ImportFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+
+	// Un file oltre la dimensione massima viene rifiutato, anche senza Content-Length
+	controllers.SetMaxImportSize(1024)
+	t.Cleanup(func() { controllers.SetMaxImportSize(100 << 20) })
+	body := "name\n" + strings.Repeat("Lamp\n", 300)
+	w = postImport(router, "/items/import", "text/csv", body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "import_too_large", decodeProblem(t, w).Code)
+
+	req, _ := http.NewRequest("POST", "/items/import", io.MultiReader(strings.NewReader(body)))
+	req.Header.Set("Content-Type", "text/csv")
+	assert.Equal(t, int64(0), req.ContentLength)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	// Il file rifiutato non resta nel BlobStore
+	entries, _ := os.ReadDir(filepath.Join(dir, "imports"))
+	assert.Empty(t, entries)
+}
+
+func TestImportResumedAfterWorkerLost(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	dir := setupBlobStore(t)
+	controllers.SetJobLease(50 * time.Millisecond)
+	t.Cleanup(func() { controllers.SetJobLease(30 * time.Second) })
+
+	// Una riga non valida e un nome ripetuto nel file, oltre a molte righe valide
+	var body strings.Builder
+	body.WriteString(`{"name": "Lamp"}` + "\n" + `{"name": "lamp"}` + "\n" + `{"name": ` + "\n")
+	for i := 0; i < 1200; i++ {
+		body.WriteString(`{"name": "Imported ` + strconv.Itoa(i) + `"}` + "\n")
+	}
+
+	// Il primo worker si ferma durante l'import
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	controllers.StartJobWorkers(ctx, 1)
+	w := postImport(router, "/items/import", "application/x-ndjson", body.String())
+	location := w.Header().Get("Location")
+	var job schemas.ImportJob
+	assert.Eventually(t, func() bool {
+		getJSON(t, router, location, &job)
+		return job.Processed > 0
+	}, 5*time.Second, time.Millisecond)
+	stop()
+
+	id := strings.TrimPrefix(location, "/items/import/")
+	assert.Eventually(t, func() bool { return !mr.Exists("jobs:" + id + ":lease") }, 5*time.Second, 10*time.Millisecond)
+	getJSON(t, router, location, &job)
+	assert.Equal(t, schemas.ImportRunning, job.Status)
+	assert.Less(t, job.Processed, 1203)
+
+	// Il reaper lo rimette in coda e un altro worker lo riprende: le righe già
+	// salvate non vengono contate due volte né segnalate come nomi già usati
+	startJobWorkers(t)
+	job = waitForImport(t, router, w)
+	assert.Equal(t, schemas.ImportCompleted, job.Status)
+	assert.Equal(t, 1203, job.Processed)
+	assert.Equal(t, 1201, job.Imported)
+	assert.Equal(t, 2, job.Failed)
+	assert.Len(t, job.Errors, 2)
+	assert.Equal(t, 2, job.Errors[0].Line)
+	assert.Equal(t, 3, job.Errors[1].Line)
+	assert.Equal(t, job.BytesTotal, job.BytesRead)
+
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 1203)
+	assert.False(t, mr.Exists("imports:"+id+":lines"))
+	_, err := os.Stat(filepath.Join(dir, "imports", id))
+	assert.True(t, os.IsNotExist(err))
+}
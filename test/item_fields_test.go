@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/schemas"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceJSON(t *testing.T) {
+	cases := map[string]string{
+		`"12.5"`:  "12.50",
+		`12.34`:   "12.34",
+		`"0.07"`:  "0.07",
+		`3`:       "3.00",
+		`"-1.20"`: "-1.20",
+	}
+	for input, expected := range cases {
+		var p schemas.Price
+		err := json.Unmarshal([]byte(input), &p)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, p.String(), input)
+	}
+
+	// 0.1 + 0.2 resta esatto
+	a, _ := schemas.ParsePrice("0.10")
+	b, _ := schemas.ParsePrice("0.20")
+	assert.Equal(t, "0.30", (a + b).String())
+
+	for _, invalid := range []string{`"1.234"`, `"abc"`, `"1."`, `".5"`, `1e3`} {
+		var p schemas.Price
+		assert.NotNil(t, json.Unmarshal([]byte(invalid), &p), invalid)
+	}
+
+	data, _ := json.Marshal(schemas.Item{Price: 1999})
+	assert.Contains(t, string(data), `"price":"19.99"`)
+}
+
+func TestItemServerManagedFields(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	w := sendItem(router, "POST", "/items", `{
+		"name": "Desk lamp",
+		"description": "  LED lamp  ",
+		"tags": ["office", "Office", " light "],
+		"price": "24.90",
+		"quantity": 3,
+		"created_at": "2000-01-01T00:00:00Z"
+	}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created schemas.Item
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Nil(t, err)
+	assert.Equal(t, "LED lamp", created.Description)
+	assert.Equal(t, []string{"office", "light"}, created.Tags)
+	assert.Equal(t, schemas.Price(2490), created.Price)
+	assert.Equal(t, 3, created.Quantity)
+	assert.WithinDuration(t, time.Now(), created.CreatedAt, time.Minute)
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	time.Sleep(10 * time.Millisecond)
+	w = sendItem(router, "PUT", "/items/3", `{"name": "Desk lamp", "price": 19, "quantity": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated schemas.Item
+	err = json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Nil(t, err)
+	assert.Equal(t, "19.00", updated.Price.String())
+	assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+
+	// Prezzi e quantità negativi non sono ammessi
+	w = sendItem(router, "POST", "/items", `{"name": "Broken", "price": "-1.00", "quantity": -2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	rules := decodeValidationErrors(t, w)
+	assert.Equal(t, "min", rules["price"])
+	assert.Equal(t, "min", rules["quantity"])
+}
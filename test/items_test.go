@@ -6,8 +6,11 @@ import (
 	"gin-try/schemas"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
@@ -16,14 +19,30 @@ import (
 )
 
 func setupRouter() *gin.Engine {
+	// Ogni test parte dagli stessi items
+	controllers.SetItems([]schemas.Item{
+		{ID: 1, Name: "item one"},
+		{ID: 2, Name: "item two"},
+	})
+	controllers.SetCategories(nil)
+	controllers.SetHistory(nil)
+	controllers.SetAttachments(nil)
+	controllers.SetEventBufferSize(1000)
+	controllers.SetWebhooks(nil)
+	controllers.SetWebhookPrivateTargets(false)
+	controllers.SetCategoryDeleteMode(controllers.CategoryDeleteRestrict)
+
 	r := gin.Default()
+	r.Use(controllers.ErrorHandler())
+	r.NoRoute(controllers.NoRoute)
 
-	r.GET("/items", controllers.GetItems)
-	r.GET("/items/:id", controllers.GetItemsByID)
-	r.GET("/items/search", controllers.SearchItemsByName)
-	r.DELETE("/items/:id", controllers.DeleteItem)
-	r.POST("/items", controllers.CreateItem)
-	r.PUT("/items/:id", controllers.UpdatedItem)
+	controllers.RegisterAPIRoutes(r.Group("", controllers.APIVersion(0), controllers.Negotiate()))
+	controllers.RegisterAPIRoutes(r.Group("/v1", controllers.APIVersion(1), controllers.Negotiate()))
+	controllers.RegisterAPIRoutes(r.Group("/v2", controllers.APIVersion(2), controllers.Negotiate()))
+
+	controllers.RegisterStreamRoutes(r.Group("", controllers.APIVersion(0)))
+	controllers.RegisterStreamRoutes(r.Group("/v1", controllers.APIVersion(1)))
+	controllers.RegisterStreamRoutes(r.Group("/v2", controllers.APIVersion(2)))
 
 	return r
 }
@@ -176,6 +195,55 @@ func TestCreateItem(t *testing.T) {
 	assert.Equal(t, redis.Nil, err)
 }
 
+func TestCreateItemConcurrentSameName(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	// Controllo del nome, assegnazione dell'ID e salvataggio avvengono insieme
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes <- sendItem(router, "POST", "/items", `{"name": "Lamp"}`).Code
+			sendItem(router, "POST", "/items", `{"name": "Lamp `+strconv.Itoa(i)+`"}`)
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		} else {
+			assert.Equal(t, http.StatusUnprocessableEntity, code)
+		}
+	}
+	assert.Equal(t, 1, created)
+
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 23)
+	ids := map[int]bool{}
+	for _, item := range items {
+		ids[item.ID] = true
+	}
+	assert.Len(t, ids, 23)
+
+	// Gli ID degli items eliminati definitivamente non vengono riusati
+	deleteItem(router, "23")
+	controllers.PurgeTrash(time.Now().AddDate(10, 0, 0))
+	var item schemas.Item
+	json.Unmarshal(sendItem(router, "POST", "/items", `{"name": "Desk"}`).Body.Bytes(), &item)
+	assert.Equal(t, 24, item.ID)
+}
+
 func TestUpdateItem(t *testing.T) {
 	// Setup
 	mr, client := setupRedis()
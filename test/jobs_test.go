@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startJobWorkers avvia i worker dei job sul Redis del test, fino alla sua fine
+func startJobWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	controllers.StartJobWorkers(ctx, 2)
+}
+
+// waitForJob interroga lo stato del job finché non è terminato
+func waitForJob(t *testing.T, router http.Handler, location string) schemas.Job {
+	var job schemas.Job
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		assert.Equal(t, http.StatusOK, getJSON(t, router, location, &job))
+		if job.Status != schemas.JobQueued && job.Status != schemas.JobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s still running", location)
+	return job
+}
+
+func startJob(router http.Handler, body string) *httptest.ResponseRecorder {
+	return sendAs(router, "POST", "/jobs", "", "application/json", []byte(body))
+}
+
+func TestCacheWarmupJob(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	startJobWorkers(t)
+
+	w := startJob(router, `{"type": "cache_warmup"}`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var queued schemas.Job
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	assert.Equal(t, schemas.JobQueued, queued.Status)
+	assert.Equal(t, "/jobs/"+queued.ID, w.Header().Get("Location"))
+
+	job := waitForJob(t, router, w.Header().Get("Location"))
+	assert.Equal(t, schemas.JobCompleted, job.Status)
+	assert.Equal(t, int64(2), job.Total)
+	assert.Equal(t, job.Total, job.Done)
+	assert.NotNil(t, job.StartedAt)
+	assert.NotNil(t, job.FinishedAt)
+
+	assert.True(t, mr.Exists("items:1"))
+	assert.True(t, mr.Exists("items:2"))
+	assert.True(t, mr.Exists("items:all"))
+}
+
+func TestReindexJob(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	startJobWorkers(t)
+
+	var found []schemas.Item
+	getJSON(t, router, "/items/search?name=item", &found)
+	assert.Len(t, found, 2)
+	// Le modifiche non invalidano le ricerche in cache
+	sendItem(router, "PUT", "/items/2", `{"name": "chair"}`)
+
+	w := startJob(router, `{"type": "reindex"}`)
+	job := waitForJob(t, router, w.Header().Get("Location"))
+	assert.Equal(t, schemas.JobCompleted, job.Status)
+	assert.Equal(t, int64(1), job.Total)
+
+	var cached []schemas.Item
+	val, _ := client.Get("items:search:item").Result()
+	json.Unmarshal([]byte(val), &cached)
+	assert.Len(t, cached, 1)
+	assert.Equal(t, "item one", cached[0].Name)
+}
+
+func TestJobErrorsAndCancel(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	dir := setupBlobStore(t)
+
+	w := startJob(router, `{"type": "shutdown"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, map[string]string{"type": "oneof"}, decodeValidationErrors(t, w))
+
+	w = sendAs(router, "GET", "/jobs/missing", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "job_not_found", decodeProblem(t, w).Code)
+
+	// Un job in coda viene annullato subito, anche se è un import
+	w = postImport(router, "/items/import", "application/x-ndjson", `{"name": "Lamp"}`)
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/items/import/")
+	w = sendAs(router, "POST", "/jobs/"+id+"/cancel", "", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var job schemas.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	assert.Equal(t, schemas.JobCanceled, job.Status)
+	assert.Equal(t, schemas.JobImport, job.Type)
+
+	var imported schemas.ImportJob
+	getJSON(t, router, "/items/import/"+id, &imported)
+	assert.Equal(t, schemas.ImportCanceled, imported.Status)
+	_, err := os.Stat(filepath.Join(dir, "imports", id))
+	assert.True(t, os.IsNotExist(err))
+
+	w = sendAs(router, "POST", "/jobs/"+id+"/cancel", "", "", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "job_finished", decodeProblem(t, w).Code)
+
+	// Un job in esecuzione si ferma al primo controllo dopo la richiesta di annullamento
+	w = startJob(router, `{"type": "cache_warmup"}`)
+	location := w.Header().Get("Location")
+	client.Set("jobs:"+strings.TrimPrefix(location, "/jobs/")+":cancel", 1, 0)
+
+	startJobWorkers(t)
+	job = waitForJob(t, router, location)
+	assert.Equal(t, schemas.JobCanceled, job.Status)
+	assert.False(t, mr.Exists("items:all"))
+
+	// L'import annullato in coda non viene eseguito
+	var items []schemas.Item
+	getJSON(t, router, "/items", &items)
+	assert.Len(t, items, 2)
+}
+
+func TestJobRequeuedAfterWorkerLost(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetJobLease(50 * time.Millisecond)
+	t.Cleanup(func() { controllers.SetJobLease(30 * time.Second) })
+
+	// Un worker si è fermato subito dopo aver preso il primo job dalla coda...
+	first := startJob(router, `{"type": "cache_warmup"}`).Header().Get("Location")
+	client.RPopLPush("jobs:queue", "jobs:processing")
+	// ...e un altro durante l'esecuzione del secondo, senza più rinnovarne il lease
+	second := startJob(router, `{"type": "reindex"}`).Header().Get("Location")
+	client.RPopLPush("jobs:queue", "jobs:processing")
+	key := "jobs:" + strings.TrimPrefix(second, "/jobs/")
+	val, _ := client.Get(key).Result()
+	var record map[string]interface{}
+	json.Unmarshal([]byte(val), &record)
+	record["status"] = schemas.JobRunning
+	data, _ := json.Marshal(record)
+	client.Set(key, data, 0)
+
+	startJobWorkers(t)
+	for _, location := range []string{first, second} {
+		job := waitForJob(t, router, location)
+		assert.Equal(t, schemas.JobCompleted, job.Status, location)
+	}
+	assert.Eventually(t, func() bool { return !mr.Exists("jobs:processing") }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCancelQueuedJobRace(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	var locations []string
+	for i := 0; i < 20; i++ {
+		locations = append(locations, startJob(router, `{"type": "cache_warmup"}`).Header().Get("Location"))
+	}
+
+	// Worker e annullamenti si contendono i job in coda
+	startJobWorkers(t)
+	codes := make([]int, len(locations))
+	var wg sync.WaitGroup
+	for i, location := range locations {
+		wg.Add(1)
+		go func(i int, location string) {
+			defer wg.Done()
+			codes[i] = sendAs(router, "POST", location+"/cancel", "", "", nil).Code
+		}(i, location)
+	}
+	wg.Wait()
+
+	for i, location := range locations {
+		job := waitForJob(t, router, location)
+		switch codes[i] {
+		case http.StatusOK:
+			// Annullato in coda: nessun worker lo ha eseguito
+			assert.Equal(t, schemas.JobCanceled, job.Status, location)
+			assert.Nil(t, job.StartedAt, location)
+		case http.StatusAccepted:
+			assert.NotNil(t, job.StartedAt, location)
+		default:
+			assert.Equal(t, http.StatusConflict, codes[i], location)
+			assert.Equal(t, schemas.JobCompleted, job.Status, location)
+		}
+	}
+	assert.False(t, mr.Exists("jobs:queue"))
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonapi = "application/vnd.api+json"
+
+func TestJSONAPIDocuments(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "price": "5.00", "category_id": 1}`)
+
+	w := sendAs(router, "GET", "/items/1?include=category", jsonapi, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jsonapi, w.Header().Get("Content-Type"))
+
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+	data := document["data"].(map[string]interface{})
+	assert.Equal(t, "items", data["type"])
+	assert.Equal(t, "1", data["id"])
+	attributes := data["attributes"].(map[string]interface{})
+	assert.Equal(t, "item one", attributes["name"])
+	assert.NotContains(t, attributes, "id")
+	assert.NotContains(t, attributes, "category_id")
+	category := data["relationships"].(map[string]interface{})["category"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "categories", "id": "1"}, category["data"])
+	included := document["included"].([]interface{})
+	assert.Len(t, included, 1)
+	assert.Equal(t, "Office", included[0].(map[string]interface{})["attributes"].(map[string]interface{})["name"])
+
+	// Con fields[items] restano solo i campi richiesti
+	w = sendAs(router, "GET", "/items?fields[items]=name,price", jsonapi, "", nil)
+	document = nil
+	json.Unmarshal(w.Body.Bytes(), &document)
+	resources := document["data"].([]interface{})
+	assert.Len(t, resources, 2)
+	first := resources[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "item one", "price": "5.00"}, first["attributes"])
+	assert.NotContains(t, first, "relationships")
+	assert.NotContains(t, document, "included")
+
+	w = sendAs(router, "GET", "/items?page=1&per_page=1", jsonapi, "", nil)
+	document = nil
+	json.Unmarshal(w.Body.Bytes(), &document)
+	assert.Equal(t, "/items?page=2&per_page=1", document["links"].(map[string]interface{})["next"])
+	assert.Equal(t, float64(2), document["meta"].(map[string]interface{})["total"])
+}
+
+func TestJSONAPIWritesAndErrors(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+
+	body := `{"data": {"type": "items", "attributes": {"name": "Lamp", "quantity": 2}, "relationships": {"category": {"data": {"type": "categories", "id": "1"}}}}}`
+	w := sendAs(router, "POST", "/items", jsonapi, jsonapi, []byte(body))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var document map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &document)
+	data := document["data"].(map[string]interface{})
+	assert.Equal(t, "3", data["id"])
+	assert.Equal(t, "1", data["relationships"].(map[string]interface{})["category"].(map[string]interface{})["data"].(map[string]interface{})["id"])
+
+	// Gli errori sono error object JSON:API, con il campo non valido in source.pointer
+	body = `{"data": {"type": "items", "attributes": {"name": ""}, "relationships": {"category": {"data": {"type": "categories", "id": "9"}}}}}`
+	w = sendAs(router, "POST", "/items", jsonapi, jsonapi, []byte(body))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, jsonapi, w.Header().Get("Content-Type"))
+	var errs struct {
+		Errors []struct {
+			Status string
+			Code   string
+			Source struct{ Pointer string }
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errs))
+	var pointers []string
+	for _, e := range errs.Errors {
+		assert.Equal(t, "422", e.Status)
+		assert.Equal(t, "validation_failed", e.Code)
+		pointers = append(pointers, e.Source.Pointer)
+	}
+	assert.ElementsMatch(t, []string{"/data/attributes/name", "/data/relationships/category"}, pointers)
+
+	w = sendAs(router, "POST", "/items", jsonapi, jsonapi, []byte(`{"data": {"type": "categories", "attributes": {"name": "Lamp"}}}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errs)
+	assert.Equal(t, "malformed_body", errs.Errors[0].Code)
+
+	w = sendAs(router, "GET", "/items/99", jsonapi, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errs)
+	assert.Equal(t, "item_not_found", errs.Errors[0].Code)
+
+	// Una relazione sconosciuta in include viene rifiutata prima della scrittura
+	w = sendAs(router, "POST", "/items?include=owner", jsonapi, "application/json", []byte(`{"name": "Desk"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errs)
+	assert.Equal(t, "invalid_parameter", errs.Errors[0].Code)
+	assert.Equal(t, http.StatusNotFound, sendAs(router, "GET", "/items/4", "", "", nil).Code)
+}
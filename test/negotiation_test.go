@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+func sendAs(router http.Handler, method, url, accept, contentType string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestNegotiateResponseFormats(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "tags": ["a", "b"], "price": "12.50", "quantity": 3}`)
+
+	w := sendAs(router, "GET", "/items/1", "application/xml", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Values("Vary"), "Accept")
+	var xmlItem struct {
+		XMLName xml.Name `xml:"item"`
+		Name    string   `xml:"name"`
+		Tags    []string `xml:"tags>tag"`
+		Price   string   `xml:"price"`
+	}
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &xmlItem))
+	assert.Equal(t, "item one", xmlItem.Name)
+	assert.Equal(t, []string{"a", "b"}, xmlItem.Tags)
+	assert.Equal(t, "12.50", xmlItem.Price)
+
+	w = sendAs(router, "GET", "/items", "application/xml", "", nil)
+	var xmlItems struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []struct {
+			ID int `xml:"id"`
+		} `xml:"item"`
+	}
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &xmlItems))
+	assert.Len(t, xmlItems.Items, 2)
+
+	w = sendAs(router, "GET", "/items/1", "application/x-yaml", "", nil)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	var yamlItem map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &yamlItem))
+	// Il prezzo resta una stringa come in JSON
+	assert.Equal(t, "12.50", yamlItem["price"])
+	assert.Equal(t, 3, yamlItem["quantity"])
+
+	w = sendAs(router, "GET", "/items/1", "application/msgpack", "", nil)
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	var msgpackItem struct {
+		Name     string   `codec:"name"`
+		Tags     []string `codec:"tags"`
+		Quantity int      `codec:"quantity"`
+	}
+	assert.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), &codec.MsgpackHandle{}).Decode(&msgpackItem))
+	assert.Equal(t, "item one", msgpackItem.Name)
+	assert.Equal(t, []string{"a", "b"}, msgpackItem.Tags)
+	assert.Equal(t, 3, msgpackItem.Quantity)
+
+	w = sendAs(router, "GET", "/items", "text/csv", "", nil)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "name", "description", "tags", "price", "quantity"}, records[0][:6])
+	assert.Equal(t, "a;b", records[1][3])
+
+	// Una lista vuota ha comunque l'intestazione
+	w = sendAs(router, "GET", "/items/trash", "text/csv", "", nil)
+	records, err = csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "id", records[0][0])
+}
+
+func TestNegotiateAcceptHeader(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	// Vince il formato con il q più alto; */* equivale a JSON
+	w := sendAs(router, "GET", "/items/1", "application/json;q=0.5, application/yaml", "", nil)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	w = sendAs(router, "GET", "/items/1", "text/html, */*;q=0.8", "", nil)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = sendAs(router, "GET", "/items/1", "text/html, application/pdf", "", nil)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "not_acceptable", decodeProblem(t, w).Code)
+
+	// Il formato non accettabile viene rifiutato prima di modificare l'item
+	w = sendAs(router, "DELETE", "/items/1", "text/html", "", nil)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1", &schemas.Item{}))
+
+	// Gli errori restano problem+json qualunque sia il formato richiesto
+	w = sendAs(router, "GET", "/items/99", "application/xml", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "item_not_found", decodeProblem(t, w).Code)
+}
+
+func TestNegotiateRequestFormats(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	bodies := []struct {
+		contentType string
+		body        []byte
+	}{
+		{"application/xml", []byte(`<item><name>xml item</name><tags><tag>a</tag><tag>b</tag></tags><price>1.50</price><quantity>2</quantity></item>`)},
+		{"application/yaml", []byte("name: yaml item\ntags: [a, b]\nprice: \"1.50\"\nquantity: 2\n")},
+		{"text/csv", []byte("name,tags,price,quantity\ncsv item,a;b,1.50,2\n")},
+	}
+	var msgpackBody []byte
+	codec.NewEncoderBytes(&msgpackBody, &codec.MsgpackHandle{}).Encode(map[string]interface{}{
+		"name": "msgpack item", "tags": []string{"a", "b"}, "price": "1.50", "quantity": 2,
+	})
+	bodies = append(bodies, struct {
+		contentType string
+		body        []byte
+	}{"application/msgpack", msgpackBody})
+
+	for _, b := range bodies {
+		w := sendAs(router, "POST", "/items", "", b.contentType, b.body)
+		if !assert.Equal(t, http.StatusCreated, w.Code, b.contentType) {
+			continue
+		}
+		var created schemas.Item
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, []string{"a", "b"}, created.Tags, b.contentType)
+		assert.Equal(t, "1.50", created.Price.String(), b.contentType)
+		assert.Equal(t, 2, created.Quantity, b.contentType)
+	}
+
+	w := sendAs(router, "PUT", "/items/1", "application/yaml", "application/xml", []byte(`<item><name>item one updated</name></item>`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "name: item one updated")
+
+	// Gli errori di validazione sono gli stessi del JSON
+	w = sendAs(router, "POST", "/items", "", "text/csv", []byte("name,quantity\nitem two,-1\n"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	errs := decodeValidationErrors(t, w)
+	assert.Equal(t, "unique", errs["name"])
+	assert.Equal(t, "min", errs["quantity"])
+
+	w = sendAs(router, "POST", "/items", "", "application/xml", []byte(`<item><name>x</name><quantity>many</quantity></item>`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "malformed_body", decodeProblem(t, w).Code)
+
+	w = sendAs(router, "POST", "/items", "", "text/csv", []byte("name\na\nb\n"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendAs(router, "POST", "/items", "", "text/plain", []byte("name"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "unsupported_media_type", decodeProblem(t, w).Code)
+}
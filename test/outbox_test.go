@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"context"
+	"gin-try/controllers"
+	"gin-try/repository"
+	"gin-try/schemas"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayOutbox(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	// Gli items iniziali non sono modifiche da pubblicare
+	published, err := controllers.RelayOutbox()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+
+	sendItem(router, "POST", "/items", `{"name": "item three"}`)
+	sendItem(router, "PUT", "/items/3", `{"name": "item three updated"}`)
+	deleteItem(router, "1")
+
+	published, err = controllers.RelayOutbox()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+
+	messages, err := client.XRange("items:stream", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, repository.EventItemCreated, messages[0].Values["type"])
+	assert.Equal(t, "3", messages[0].Values["item_id"])
+	assert.Equal(t, repository.EventItemDeleted, messages[2].Values["type"])
+
+	// Gli eventi pubblicati non vengono ripubblicati
+	published, err = controllers.RelayOutbox()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestMemoryOutboxDropsPublishedEvents(t *testing.T) {
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	repo := repository.NewMemoryItemRepository([]schemas.Item{{ID: 1, Name: "Lamp", CreatedAt: created}})
+	assert.Nil(t, repo.Create(schemas.Item{ID: 2, Name: "Desk", CreatedAt: created}))
+	assert.Nil(t, repo.Create(schemas.Item{ID: 3, Name: "Chair", CreatedAt: created}))
+
+	pending, err := repo.PendingEvents(10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+	assert.Nil(t, repo.MarkPublished(pending[0].Seq))
+
+	// Restano solo gli eventi successivi all'ultimo pubblicato
+	pending, _ = repo.PendingEvents(10)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 3, pending[0].ItemID)
+	assert.Nil(t, repo.MarkPublished(pending[0].Seq))
+	pending, _ = repo.PendingEvents(10)
+	assert.Empty(t, pending)
+
+	// La storia per ListAt non viene toccata
+	items, err := repo.ListAt(created)
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+}
+
+func TestRelayOutboxRedisDown(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/items", `{"name": "item three"}`)
+
+	// Con Redis irraggiungibile l'evento resta nell'outbox
+	mr.Close()
+	_, err := controllers.RelayOutbox()
+	assert.Error(t, err)
+
+	assert.NoError(t, mr.Restart())
+	published, err := controllers.RelayOutbox()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+}
+
+func TestEventSourcedOutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	repo, err := repository.OpenEventSourcedItemRepository(dir, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Create(schemas.Item{ID: 1, Name: "Lamp", CreatedAt: created, UpdatedAt: created}))
+	assert.Nil(t, repo.Create(schemas.Item{ID: 2, Name: "Desk", CreatedAt: created, UpdatedAt: created}))
+
+	pending, err := repo.PendingEvents(10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+	assert.Nil(t, repo.MarkPublished(pending[0].Seq))
+	assert.Nil(t, repo.Close())
+
+	// Dopo il riavvio resta da pubblicare solo il secondo evento, anche se è già nello snapshot
+	repo, err = repository.OpenEventSourcedItemRepository(dir, 1)
+	assert.Nil(t, err)
+	defer repo.Close()
+	pending, err = repo.PendingEvents(10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 2, pending[0].ItemID)
+}
+
+func TestCacheInvalidatorConsumerGroup(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetOutboxClaimIdle(50 * time.Millisecond)
+	defer controllers.SetOutboxClaimIdle(30 * time.Second)
+
+	// Un evento consegnato a un consumer che si è fermato prima di confermarlo
+	client.XGroupCreateMkStream("items:stream", "cache-invalidation", "0")
+	client.XAdd(&redis.XAddArgs{Stream: "items:stream", Values: map[string]interface{}{
+		"seq": 1, "type": repository.EventItemUpdated, "item_id": 2,
+		"event": `{"seq": 1, "type": "ItemUpdated", "item_id": 2, "item": {"id": 2, "name": "item two"}}`,
+	}})
+	client.XReadGroup(&redis.XReadGroupArgs{Group: "cache-invalidation", Consumer: "crashed", Streams: []string{"items:stream", ">"}, Block: -1})
+	client.Set("items:2", `{"id": 2, "name": "stale"}`, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, controllers.StartCacheInvalidator(ctx, "test"))
+
+	// Una modifica pubblicata dall'outbox invalida la cache dell'item
+	client.Set("items:1", `{"id": 1, "name": "stale"}`, 0)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one updated"}`)
+	client.Set("items:1", `{"id": 1, "name": "stale"}`, 0)
+	_, err := controllers.RelayOutbox()
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return !mr.Exists("items:1") && !mr.Exists("items:2")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Tutti gli eventi sono stati confermati
+	assert.Eventually(t, func() bool {
+		pending, err := client.XPending("items:stream", "cache-invalidation").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCacheInvalidatorCategories(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	setupRouter()
+	now := time.Now().UTC()
+	repo := repository.NewMemoryItemRepository([]schemas.Item{{ID: 1, Name: "Lamp", CategoryID: 1, Tags: []string{}, CreatedAt: now, UpdatedAt: now}})
+	controllers.SetItemRepository(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, controllers.StartCacheInvalidator(ctx, "test"))
+
+	// Le modifiche arrivano da un'altra replica: solo lo stream invalida la cache
+	client.Set("categories:1:items", "stale", 0)
+	client.Set("categories:2:items", "stale", 0)
+	item := repo.List()[0]
+	item.CategoryID = 2
+	assert.Nil(t, repo.Update(item))
+	_, err := controllers.RelayOutbox()
+	assert.NoError(t, err)
+	// L'item ha lasciato la categoria 1 ed è entrato nella 2
+	assert.Eventually(t, func() bool {
+		return !mr.Exists("categories:1:items") && !mr.Exists("categories:2:items")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Un evento di eliminazione non ha l'item, ma porta la categoria che aveva
+	client.Set("categories:2:items", "stale", 0)
+	assert.Nil(t, repo.Delete(1, time.Now().UTC()))
+	_, err = controllers.RelayOutbox()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return !mr.Exists("categories:2:items") }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) schemas.Problem {
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem schemas.Problem
+	err := json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Nil(t, err)
+	return problem
+}
+
+func TestItemNotFoundProblem(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/items/999", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	problem := decodeProblem(t, w)
+	assert.Equal(t, "item_not_found", problem.Code)
+	assert.Equal(t, "/problems/item_not_found", problem.Type)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "/items/999", problem.Instance)
+	assert.NotEmpty(t, problem.Title)
+}
+
+func TestCacheErrorDoesNotLeak(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	mr.SetError("READONLY internal redis detail")
+
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	problem := decodeProblem(t, w)
+	assert.Equal(t, "cache_error", problem.Code)
+	assert.NotContains(t, w.Body.String(), "internal redis detail")
+}
+
+func TestRouteNotFoundProblem(t *testing.T) {
+	router := setupRouter()
+	req, _ := http.NewRequest("GET", "/nowhere", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "route_not_found", decodeProblem(t, w).Code)
+}
+
+func TestAPIErrorUnwrap(t *testing.T) {
+	cause := errors.New("boom")
+	err := error(&controllers.APIError{Code: "internal_error", Err: cause})
+	assert.True(t, errors.Is(err, cause))
+}
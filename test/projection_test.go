@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldsProjection(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "description": "first", "price": "5.00"}`)
+
+	w := sendAs(router, "GET", "/items?fields=name,id", "", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var items []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	assert.Equal(t, []map[string]interface{}{
+		{"id": float64(1), "name": "item one"},
+		{"id": float64(2), "name": "item two"},
+	}, items)
+
+	// Ogni proiezione ha una voce di cache con i soli campi che le servono
+	assert.False(t, mr.Exists("items:all"))
+	val, err := client.HGet("items:fields:all", "category_id,id,name").Result()
+	assert.NoError(t, err)
+	var cached []map[string]interface{}
+	json.Unmarshal([]byte(val), &cached)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "name": "item one"}, cached[0])
+
+	w = sendAs(router, "GET", "/items", "", "", nil)
+	items = nil
+	json.Unmarshal(w.Body.Bytes(), &items)
+	assert.Equal(t, "first", items[0]["description"])
+
+	// Le modifiche invalidano anche le voci proiettate
+	sendItem(router, "PUT", "/items/1", `{"name": "item one renamed", "description": "first", "price": "5.00"}`)
+	assert.False(t, mr.Exists("items:fields:all"))
+	w = sendAs(router, "GET", "/items?fields=id,name", "", "", nil)
+	items = nil
+	json.Unmarshal(w.Body.Bytes(), &items)
+	assert.Equal(t, "item one renamed", items[0]["name"])
+
+	w = sendAs(router, "GET", "/items/1?fields=price", "", "", nil)
+	var item map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &item)
+	assert.Equal(t, map[string]interface{}{"price": "5.00"}, item)
+
+	w = sendAs(router, "GET", "/items/search?name=item&fields=id", "text/csv", "", nil)
+	assert.Equal(t, "id\n1\n2\n", w.Body.String())
+
+	// I campi ammessi sono quelli della versione richiesta
+	w = sendAs(router, "GET", "/v2/items/1?fields=id,in_stock", "", "", nil)
+	item = nil
+	json.Unmarshal(w.Body.Bytes(), &item)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "in_stock": false}, item)
+
+	// I campi della versione 2 sono ricavati da quelli salvati, anche dalla cache
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "PUT", "/items/2", `{"name": "item two", "quantity": 3, "category_id": 1}`)
+	for i := 0; i < 2; i++ {
+		w = sendAs(router, "GET", "/v2/items/2?fields=category,in_stock", "", "", nil)
+		item = nil
+		json.Unmarshal(w.Body.Bytes(), &item)
+		assert.Equal(t, map[string]interface{}{"category": map[string]interface{}{"id": float64(1), "name": "Office"}, "in_stock": true}, item)
+	}
+
+	// Una lista vuota in CSV ha l'intestazione della proiezione
+	deleteItem(router, "1")
+	deleteItem(router, "2")
+	w = sendAs(router, "GET", "/items?fields=name,id", "text/csv", "", nil)
+	assert.Equal(t, "id,name\n", w.Body.String())
+
+	for _, url := range []string{"/v1/items/1?fields=in_stock", "/items?fields=", "/items/search?name=item&fields=id,secret"} {
+		w = sendAs(router, "GET", url, "", "", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code, url)
+	}
+}
+
+func TestFieldsProjectionKeepsHALLinks(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "category_id": 1}`)
+
+	// La seconda risposta arriva dalla cache proiettata e ha gli stessi link
+	for i := 0; i < 2; i++ {
+		w := sendAs(router, "GET", "/items/1?fields=name", "application/hal+json", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var item map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+		assert.Equal(t, "item one", item["name"])
+		assert.NotContains(t, item, "category_id")
+		links := item["_links"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"href": "/items/1"}, links["self"])
+		assert.Equal(t, map[string]interface{}{"href": "/categories/1"}, links["category"])
+	}
+	assert.True(t, mr.Exists("items:fields:1"))
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialItems(t *testing.T, server *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/items/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) schemas.SubscriptionMessage {
+	var msg schemas.SubscriptionMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, req schemas.SubscriptionRequest) {
+	req.Type = schemas.MessageSubscribe
+	assert.NoError(t, conn.WriteJSON(req))
+	msg := readMessage(t, conn)
+	assert.Equal(t, schemas.MessageSubscribed, msg.Type)
+	assert.Equal(t, req.ID, msg.ID)
+}
+
+// readEvents legge n eventi e li indicizza per sottoscrizione, perché l'ordine
+// tra sottoscrizioni diverse non è garantito
+func readEvents(t *testing.T, conn *websocket.Conn, n int) map[string]schemas.ItemEvent {
+	events := map[string]schemas.ItemEvent{}
+	for i := 0; i < n; i++ {
+		msg := readMessage(t, conn)
+		if assert.Equal(t, schemas.MessageEvent, msg.Type) {
+			events[msg.ID] = *msg.Event
+		}
+	}
+	return events
+}
+
+func TestItemSubscriptions(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, controllers.StartItemEventRelay(ctx))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn := dialItems(t, server)
+	subscribe(t, conn, schemas.SubscriptionRequest{ID: "all"})
+	subscribe(t, conn, schemas.SubscriptionRequest{ID: "one", ItemID: 1})
+	subscribe(t, conn, schemas.SubscriptionRequest{ID: "chairs", Search: "CHAIR"})
+
+	sendItem(router, "POST", "/items", `{"name": "office chair"}`)
+	events := readEvents(t, conn, 2)
+	assert.Equal(t, schemas.EventCreated, events["all"].Type)
+	assert.Equal(t, 3, events["chairs"].ItemID)
+
+	sendItem(router, "PUT", "/items/1", `{"name": "item one updated"}`)
+	events = readEvents(t, conn, 2)
+	assert.Equal(t, schemas.EventUpdated, events["one"].Type)
+	assert.Equal(t, "item one updated", events["one"].Item.Name)
+	assert.Contains(t, events, "all")
+
+	// Un item rinominato che non corrisponde più alla ricerca viene comunque notificato
+	sendItem(router, "PUT", "/items/3", `{"name": "office desk"}`)
+	events = readEvents(t, conn, 2)
+	assert.Equal(t, "office desk", events["chairs"].Item.Name)
+
+	assert.NoError(t, conn.WriteJSON(schemas.SubscriptionRequest{Type: schemas.MessageUnsubscribe, ID: "all"}))
+	assert.Equal(t, schemas.MessageUnsubscribed, readMessage(t, conn).Type)
+
+	deleteItem(router, "1")
+	events = readEvents(t, conn, 1)
+	assert.Equal(t, schemas.EventDeleted, events["one"].Type)
+}
+
+func TestItemSubscriptionsAcrossReplicas(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, controllers.StartItemEventRelay(ctx))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn := dialItems(t, server)
+	subscribe(t, conn, schemas.SubscriptionRequest{ID: "two", ItemID: 2})
+
+	// Una modifica fatta da un'altra replica arriva tramite Redis
+	client.Publish("items:events", `{"event": {"id": 7, "type": "deleted", "item_id": 2, "item": {"id": 2, "name": "item two"}}}`)
+	events := readEvents(t, conn, 1)
+	assert.Equal(t, int64(7), events["two"].ID)
+	assert.Equal(t, schemas.EventDeleted, events["two"].Type)
+}
+
+func TestItemSubscriptionErrors(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn := dialItems(t, server)
+
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	msg := readMessage(t, conn)
+	assert.Equal(t, schemas.MessageError, msg.Type)
+	assert.Equal(t, "malformed_body", msg.Code)
+
+	conn.WriteJSON(schemas.SubscriptionRequest{Type: schemas.MessageSubscribe})
+	assert.Equal(t, "missing_parameter", readMessage(t, conn).Code)
+
+	conn.WriteJSON(schemas.SubscriptionRequest{Type: schemas.MessageSubscribe, ID: "x", ItemID: 1, Search: "item"})
+	msg = readMessage(t, conn)
+	assert.Equal(t, "invalid_parameter", msg.Code)
+	assert.Equal(t, "x", msg.ID)
+
+	conn.WriteJSON(schemas.SubscriptionRequest{Type: "publish", ID: "x"})
+	assert.Equal(t, "invalid_parameter", readMessage(t, conn).Code)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func deleteItem(router http.Handler, id string) int {
+	req, _ := http.NewRequest("DELETE", "/items/"+id, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+	assert.Equal(t, http.StatusNotFound, deleteItem(router, "1"))
+
+	var item schemas.Item
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/items/1", &item))
+
+	var trash []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/trash", &trash))
+	assert.Len(t, trash, 1)
+	assert.Equal(t, 1, trash[0].ID)
+	assert.NotNil(t, trash[0].DeletedAt)
+
+	// Il nuovo item non riusa l'ID di quello nel cestino
+	w := sendItem(router, "POST", "/items", `{"name": "item three"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":3`)
+
+	w = sendItem(router, "POST", "/items/1/restore", ``)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/1", &item))
+	assert.Nil(t, item.DeletedAt)
+
+	// Un item non presente nel cestino non può essere ripristinato
+	w = sendItem(router, "POST", "/items/1/restore", ``)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRestoreNameConflict(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+	sendItem(router, "POST", "/items", `{"name": "Item One"}`)
+
+	w := sendItem(router, "POST", "/items/1/restore", ``)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "item_name_conflict", decodeProblem(t, w).Code)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetTrashRetention(time.Hour)
+
+	assert.Equal(t, http.StatusNoContent, deleteItem(router, "1"))
+
+	// Prima della scadenza della retention non viene eliminato nulla
+	purged, err := controllers.PurgeTrash(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+	purged, err = controllers.PurgeTrash(time.Now().Add(2 * time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+
+	var trash []schemas.Item
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/items/trash", &trash))
+	assert.Len(t, trash, 0)
+
+	w := sendItem(router, "POST", "/items/1/restore", ``)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendItem(router http.Handler, method, url, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeValidationErrors(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	var response schemas.Problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	rules := map[string]string{}
+	for _, fe := range response.Errors {
+		rules[fe.Field] = fe.Rule
+		assert.NotEmpty(t, fe.Message)
+	}
+	return rules
+}
+
+func TestCreateItemValidation(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	cases := []struct {
+		payload string
+		rule    string
+	}{
+		{`{}`, "required"},
+		{`{"name": "` + strings.Repeat("a", 101) + `"}`, "max"},
+		{`{"name": "<script>"}`, "itemname"},
+		{`{"name": "ITEM ONE"}`, "unique"},
+	}
+
+	for _, tc := range cases {
+		w := sendItem(router, "POST", "/items", tc.payload)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, tc.payload)
+		assert.Equal(t, tc.rule, decodeValidationErrors(t, w)["name"], tc.payload)
+	}
+
+	// Il JSON malformato resta un 400
+	w := sendItem(router, "POST", "/items", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateItemValidation(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	// L'id nel body deve coincidere con quello dell'URL
+	w := sendItem(router, "PUT", "/items/1", `{"id": 2, "name": "Renamed"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "readonly", decodeValidationErrors(t, w)["id"])
+
+	// Il nome di un altro item non è disponibile
+	w = sendItem(router, "PUT", "/items/1", `{"name": "item two"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "unique", decodeValidationErrors(t, w)["name"])
+
+	// Un item può mantenere il proprio nome
+	w = sendItem(router, "PUT", "/items/1", `{"name": "item one"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
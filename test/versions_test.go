@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"gin-try/controllers"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getVersioned(router http.Handler, url, version string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	if version != "" {
+		req.Header.Set("API-Version", version)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIVersionRepresentations(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	sendItem(router, "POST", "/categories", `{"name": "Office"}`)
+	sendItem(router, "PUT", "/items/1", `{"name": "item one", "quantity": 2, "category_id": 1}`)
+
+	// La versione 1 è quella di sempre, con o senza prefisso
+	for _, url := range []string{"/items/1", "/v1/items/1"} {
+		w := getVersioned(router, url, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get("API-Version"))
+		var item map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &item)
+		assert.Equal(t, float64(1), item["category_id"], url)
+		assert.NotContains(t, item, "in_stock", url)
+	}
+
+	// La versione 2 include la categoria e in_stock, dal prefisso o dall'header
+	for _, w := range []*httptest.ResponseRecorder{getVersioned(router, "/v2/items/1", ""), getVersioned(router, "/items/1", "2")} {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("API-Version"))
+		assert.Empty(t, w.Header().Get("Deprecation"))
+		var item map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &item)
+		assert.Equal(t, map[string]interface{}{"id": float64(1), "name": "Office"}, item["category"])
+		assert.Equal(t, true, item["in_stock"])
+		assert.NotContains(t, item, "category_id")
+	}
+
+	var items []map[string]interface{}
+	json.Unmarshal(getVersioned(router, "/v2/items", "").Body.Bytes(), &items)
+	assert.Len(t, items, 2)
+	assert.Nil(t, items[1]["category"])
+	assert.Equal(t, false, items[1]["in_stock"])
+
+	// Le scritture in v2 rispondono con la rappresentazione v2
+	w := sendItem(router, "POST", "/v2/items", `{"name": "Lamp", "category_id": 1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "Office", created["category"].(map[string]interface{})["name"])
+}
+
+func TestAPIVersionDeprecationHeaders(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+	startJobWorkers(t)
+
+	// Di default nessuna versione è deprecata
+	w := getVersioned(router, "/v1/items/1", "")
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+	assert.Empty(t, w.Header().Get("Link"))
+
+	deprecation := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	controllers.SetAPIDeprecation(1, deprecation)
+	controllers.SetAPISunset(1, time.Date(2027, time.June, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(func() {
+		controllers.SetAPIDeprecation(1, time.Time{})
+		controllers.SetAPISunset(1, time.Time{})
+	})
+
+	w = getVersioned(router, "/v1/items/1", "")
+	assert.Equal(t, "@"+strconv.FormatInt(deprecation.Unix(), 10), w.Header().Get("Deprecation"))
+	assert.Equal(t, "Tue, 01 Jun 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v2/items/1>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = getVersioned(router, "/items/1", "")
+	assert.Equal(t, `</v2/items/1>; rel="successor-version"`, w.Header().Get("Link"))
+	assert.Contains(t, w.Header().Values("Vary"), "API-Version")
+
+	w = getVersioned(router, "/items/1", "3")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_parameter", decodeProblem(t, w).Code)
+
+	// Gli URL restituiti restano nella versione della richiesta
+	w = postImport(router, "/v2/items/import", "application/x-ndjson", "")
+	assert.Regexp(t, `^/v2/items/import/\w+$`, w.Header().Get("Location"))
+	waitForImport(t, router, w)
+}
+
+func TestStreamRoutesUnderVersionPrefixes(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	setupBlobStore(t)
+
+	for _, prefix := range []string{"/v1", "/v2"} {
+		// Non finiscono su /items/:id
+		w := getVersioned(router, prefix+"/items/export?format=csv", "")
+		assert.Equal(t, http.StatusOK, w.Code, prefix)
+		assert.Contains(t, w.Body.String(), "item one")
+
+		w = getVersioned(router, prefix+"/items/1/attachments/missing", "")
+		assert.Equal(t, http.StatusNotFound, w.Code, prefix)
+		assert.Equal(t, "attachment_not_found", decodeProblem(t, w).Code)
+
+		w = sendItem(router, "POST", prefix+"/graphql", `{"query": "{ item(id: 1) { name } }"}`)
+		assert.Equal(t, http.StatusOK, w.Code, prefix)
+		assert.JSONEq(t, `{"data": {"item": {"name": "item one"}}}`, w.Body.String())
+	}
+}
@@ -0,0 +1,297 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"gin-try/controllers"
+	"gin-try/schemas"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const webhookSecret = "0123456789abcdef0123456789abcdef"
+
+// startWebhookDispatcher avvia le consegne dei webhooks verso i server locali dei test
+func startWebhookDispatcher(t *testing.T) {
+	controllers.SetWebhookPrivateTargets(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	controllers.StartWebhookDispatcher(ctx, 5*time.Millisecond)
+}
+
+func createWebhook(t *testing.T, router http.Handler, payload string) schemas.Webhook {
+	w := sendItem(router, "POST", "/webhooks", payload)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var webhook schemas.Webhook
+	json.Unmarshal(w.Body.Bytes(), &webhook)
+	return webhook
+}
+
+func TestWebhookCRUD(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	w := sendItem(router, "POST", "/webhooks", `{"url": "ftp://example.com", "events": ["moved"], "secret": "short"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, map[string]string{"url": "http_url", "events[0]": "oneof", "secret": "min"}, decodeValidationErrors(t, w))
+
+	// Senza secret il server ne genera uno, restituito solo alla creazione
+	webhook := createWebhook(t, router, `{"url": "https://example.com/hooks"}`)
+	assert.Equal(t, 1, webhook.ID)
+	assert.Len(t, webhook.Secret, 64)
+	assert.Empty(t, webhook.Events)
+
+	var fetched schemas.Webhook
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/webhooks/1", &fetched))
+	assert.Empty(t, fetched.Secret)
+	assert.Equal(t, "https://example.com/hooks", fetched.URL)
+
+	w = sendItem(router, "PUT", "/webhooks/1", `{"url": "https://example.com/items", "events": ["deleted"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	var webhooks []schemas.Webhook
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/webhooks", &webhooks))
+	assert.Len(t, webhooks, 1)
+	assert.Equal(t, []string{"deleted"}, webhooks[0].Events)
+
+	w = sendItem(router, "DELETE", "/webhooks/1", ``)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, router, "/webhooks/1", &fetched))
+	w = sendItem(router, "DELETE", "/webhooks/1", ``)
+	assert.Equal(t, "webhook_not_found", decodeProblem(t, w).Code)
+
+	// Le sottoscrizioni sono in Redis e gli ID non vengono riusati
+	webhook = createWebhook(t, router, `{"url": "https://example.com/hooks"}`)
+	assert.Equal(t, 2, webhook.ID)
+	assert.True(t, mr.Exists("webhooks"))
+}
+
+func TestWebhookRejectsPrivateTargets(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+
+	for _, target := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://10.0.0.5/hooks",
+		"http://192.168.1.10/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hooks",
+		"http://[fe80::1]/hooks",
+		"http://0.0.0.0/hooks",
+	} {
+		w := sendItem(router, "POST", "/webhooks", `{"url": "`+target+`"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, target)
+		assert.Equal(t, map[string]string{"url": "public_url"}, decodeValidationErrors(t, w), target)
+	}
+
+	createWebhook(t, router, `{"url": "https://93.184.215.14/hooks"}`)
+	w := sendItem(router, "PUT", "/webhooks/1", `{"url": "http://172.16.0.1/hooks"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	startWebhookDispatcher(t)
+
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	createWebhook(t, router, `{"url": "`+receiver.URL+`", "events": ["created"], "secret": "`+webhookSecret+`"}`)
+
+	sendItem(router, "POST", "/items", `{"name": "item three"}`)
+	// Gli aggiornamenti non interessano al webhook
+	sendItem(router, "PUT", "/items/3", `{"name": "item three updated"}`)
+
+	var req *http.Request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	body := <-bodies
+
+	// Il destinatario verifica la firma con il secret condiviso
+	signature := controllers.SignWebhook(webhookSecret, req.Header.Get("X-Webhook-Timestamp"), body)
+	assert.Equal(t, signature, req.Header.Get("X-Webhook-Signature"))
+	assert.Equal(t, "created", req.Header.Get("X-Webhook-Event"))
+	assert.NotEmpty(t, req.Header.Get("X-Webhook-Delivery"))
+
+	var event schemas.ItemEvent
+	json.Unmarshal(body, &event)
+	assert.Equal(t, 3, event.ItemID)
+
+	var deliveries []schemas.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		getJSON(t, router, "/webhooks/1/deliveries", &deliveries)
+		return len(deliveries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, schemas.DeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].StatusCode)
+	assert.Equal(t, req.Header.Get("X-Webhook-Delivery"), deliveries[0].ID)
+
+	select {
+	case <-received:
+		t.Fatal("update delivered to a webhook that only wants created events")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetriesAndDeadLetter(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetWebhookRetries(3, time.Millisecond)
+	startWebhookDispatcher(t)
+
+	var attempts int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	createWebhook(t, router, `{"url": "`+receiver.URL+`", "secret": "`+webhookSecret+`"}`)
+	deleteItem(router, "1")
+
+	var deadLetters []schemas.DeadLetter
+	assert.Eventually(t, func() bool {
+		getJSON(t, router, "/webhooks/1/dead-letters", &deadLetters)
+		return len(deadLetters) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, 1, deadLetters[0].Event.ItemID)
+	assert.Equal(t, schemas.EventDeleted, deadLetters[0].Event.Type)
+	assert.Equal(t, "unexpected status 500", deadLetters[0].LastError)
+
+	// Il log delle consegne è dal più recente
+	var deliveries []schemas.WebhookDelivery
+	assert.Equal(t, http.StatusOK, getJSON(t, router, "/webhooks/1/deliveries", &deliveries))
+	assert.Len(t, deliveries, 3)
+	assert.Equal(t, 3, deliveries[0].Attempt)
+	assert.Equal(t, schemas.DeliveryDead, deliveries[0].Status)
+	assert.Equal(t, schemas.DeliveryFailed, deliveries[2].Status)
+
+	// Nessun tentativo resta in programma
+	assert.Eventually(t, func() bool { return !mr.Exists("webhooks:schedule") }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookDeliveryIsBlockedForPrivateTargets(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetWebhookRetries(1, time.Millisecond)
+	startWebhookDispatcher(t)
+
+	var attempts int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer receiver.Close()
+
+	// Il nome può risolversi in un indirizzo interno dopo la creazione: la connessione viene rifiutata comunque
+	createWebhook(t, router, `{"url": "`+receiver.URL+`"}`)
+	controllers.SetWebhookPrivateTargets(false)
+	deleteItem(router, "1")
+
+	var deadLetters []schemas.DeadLetter
+	assert.Eventually(t, func() bool {
+		getJSON(t, router, "/webhooks/1/dead-letters", &deadLetters)
+		return len(deadLetters) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, deadLetters[0].LastError, "loopback, private or link-local")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhookRetriesSurviveRestart(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetWebhookRetries(2, time.Millisecond)
+	controllers.SetWebhookPrivateTargets(true)
+
+	received := make(chan struct{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	createWebhook(t, router, `{"url": "`+receiver.URL+`"}`)
+	// Nessun dispatcher in esecuzione: la consegna resta in programma in Redis
+	deleteItem(router, "1")
+	assert.True(t, mr.Exists("webhooks:schedule"))
+
+	// Una replica avviata dopo esegue la consegna
+	startWebhookDispatcher(t)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled delivery not executed")
+	}
+}
+
+func TestWebhookDeadLettersAreTrimmed(t *testing.T) {
+	// Setup
+	mr, client := setupRedis()
+	defer mr.Close()
+	defer client.Close()
+
+	router := setupRouter()
+	controllers.SetWebhookRetries(1, time.Millisecond)
+	startWebhookDispatcher(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+	createWebhook(t, router, `{"url": "`+receiver.URL+`"}`)
+
+	for i := 0; i < 1005; i++ {
+		client.LPush("webhooks:1:dead-letters", `{"delivery_id": "old-`+strconv.Itoa(i)+`"}`)
+	}
+	deleteItem(router, "1")
+
+	assert.Eventually(t, func() bool {
+		first, _ := client.LIndex("webhooks:1:dead-letters", 0).Result()
+		return !strings.HasPrefix(first, `{"delivery_id": "old-`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1000), client.LLen("webhooks:1:dead-letters").Val())
+}